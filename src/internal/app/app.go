@@ -37,6 +37,10 @@ func Run() {
 
 	hikvisionClient, err := hikvision.NewClient(
 		hikvision.WithPoolSize(10),
+		hikvision.WithIdleTimeout(90*time.Second),
+		hikvision.WithTimeout(2*time.Second),
+		// pictures take longer to encode than regular ISAPI calls
+		hikvision.WithOperationTimeout(hikvision.OperationStreams, 5*time.Second),
 	)
 	if err != nil {
 		logger.SFatal("failed to create hikvision client", zap.Error(err))
@@ -47,6 +51,9 @@ func Run() {
 		hikvisionClient,
 		nil,
 		opengate.NewOpenGateHTTPAPIClient("http://localhost:5000"))
+	if err := commandService.LoadSoftLimits(globalConfigs.PTZ.SoftLimitsPath); err != nil {
+		logger.SFatal("failed to load PTZ software limits", zap.Error(err))
+	}
 	mediaService := service.NewMediaService()
 
 	mediaController := service.NewMediaController(mediaService)
@@ -55,14 +62,17 @@ func Run() {
 			OpenGate,
 		mediaService)
 
+	alertController := service.NewAlertController(hikvisionClient)
+
 	reconciler := reconciler.NewReconciler(
 		controlPlaneService,
 		&globalConfigs.DeviceInfo,
 		commandService,
 		mediaController,
 		processorController,
+		alertController,
 	)
-	sidecar := sidecar.NewHttpSidecar(commandService, reconciler)
+	sidecar := sidecar.NewHttpSidecar(commandService, mediaController, reconciler)
 
 	var wg sync.WaitGroup
 
@@ -95,6 +105,8 @@ func Run() {
 	}
 	reconcilerCancel()
 	wg.Wait()
+	// cameras left moving are stopped once no more commands can come in
+	commandService.Shutdown()
 	logger.SInfo("application shutdown complete")
 }
 
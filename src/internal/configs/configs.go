@@ -17,6 +17,7 @@ type Configs struct {
 	DeviceInfo DeviceInfoConfigs `json:"deviceInfo,omitempty" yaml:"deviceInfo,omitempty"`
 	Ffmpeg     FfmpegConfigs     `json:"ffmpeg,omitempty" yaml:"ffmpeg,omitempty"`
 	OpenGate   OpenGateConfigs   `json:"openGate,omitempty" yaml:"openGate,omitempty"`
+	PTZ        PTZConfigs        `json:"ptz,omitempty" yaml:"ptz,omitempty"`
 }
 
 func (c Configs) String() string {
@@ -84,6 +85,24 @@ type EventStoreConfigs struct {
 
 type FfmpegConfigs struct {
 	BinaryPath string `json:"binaryPath,omitempty" yaml:"binaryPath,omitempty"`
+	// defaults of the streams whose configuration leaves them unset
+	Fps                   int `json:"fps,omitempty" yaml:"fps,omitempty"`
+	Width                 int `json:"width,omitempty" yaml:"width,omitempty"`
+	Height                int `json:"height,omitempty" yaml:"height,omitempty"`
+	FfmpegEncodingConfigs `yaml:",inline"`
+}
+
+type FfmpegEncodingConfigs struct {
+	Codec   string `json:"codec,omitempty" yaml:"codec,omitempty"`
+	Preset  string `json:"preset,omitempty" yaml:"preset,omitempty"`
+	Tune    string `json:"tune,omitempty" yaml:"tune,omitempty"`
+	Bitrate string `json:"bitrate,omitempty" yaml:"bitrate,omitempty"`
+	// Crf is a pointer so that 0, lossless for libx264, can be set
+	Crf       *int   `json:"crf,omitempty" yaml:"crf,omitempty"`
+	Gop       int    `json:"gop,omitempty" yaml:"gop,omitempty"`
+	Container string `json:"container,omitempty" yaml:"container,omitempty"`
+	// HardwareAcceleration is cpu, vaapi or quicksync
+	HardwareAcceleration string `json:"hardwareAcceleration,omitempty" yaml:"hardwareAcceleration,omitempty"`
 }
 
 type DeviceInfoConfigs struct {
@@ -155,3 +174,8 @@ type OpenGateConfigs struct {
 	ConfigurationPath string   `json:"configurationPath,omitempty" yaml:"configurationPath,omitempty"`
 	PrepullImages     []string `json:"prepullImages,omitempty" yaml:"prepullImages,omitempty"`
 }
+
+type PTZConfigs struct {
+	// SoftLimitsPath is the file the software PTZ limits are kept in across restarts
+	SoftLimitsPath string `json:"softLimitsPath,omitempty" yaml:"softLimitsPath,omitempty"`
+}
@@ -1,8 +1,13 @@
 package custff
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type FFmpegHardwareAccelerationType string
@@ -13,17 +18,36 @@ var (
 	CPU       FFmpegHardwareAccelerationType = "cpu"
 )
 
+const renderDevice = "/dev/dri/renderD128"
+
+// Argument is an FFmpeg option, named without its leading dash, with its value if it takes one
+type Argument struct {
+	Name  string
+	Value string
+}
+
+func Arg(name string, value string) Argument {
+	return Argument{Name: name, Value: value}
+}
+
+// Flag is an option that takes no value
+func Flag(name string) Argument {
+	return Argument{Name: name}
+}
+
 type ffmpegCommand struct {
 	sourceUrl                string
 	destinationUrl           string
-	inputArguments           map[string]string
-	outputArguments          map[string]string
-	globalArguments          map[string]string
+	inputArguments           []Argument
+	outputArguments          []Argument
+	globalArguments          []Argument
 	hardwareAccelerationType FFmpegHardwareAccelerationType
 	fps                      int
 	width                    int
 	height                   int
 	binPath                  string
+	streamCopy               bool
+	progressPeriod           time.Duration
 }
 
 func NewFFmpegCommand() *ffmpegCommand {
@@ -35,17 +59,17 @@ func (c *ffmpegCommand) WithBinPath(path string) *ffmpegCommand {
 	return c
 }
 
-func (c *ffmpegCommand) WithInputArguments(args map[string]string) *ffmpegCommand {
+func (c *ffmpegCommand) WithInputArguments(args ...Argument) *ffmpegCommand {
 	c.inputArguments = args
 	return c
 }
 
-func (c *ffmpegCommand) WithOutputArguments(args map[string]string) *ffmpegCommand {
+func (c *ffmpegCommand) WithOutputArguments(args ...Argument) *ffmpegCommand {
 	c.outputArguments = args
 	return c
 }
 
-func (c *ffmpegCommand) WithGlobalArguments(args map[string]string) *ffmpegCommand {
+func (c *ffmpegCommand) WithGlobalArguments(args ...Argument) *ffmpegCommand {
 	c.globalArguments = args
 	return c
 }
@@ -72,66 +96,161 @@ func (c *ffmpegCommand) WithScale(fps int, width int, height int) *ffmpegCommand
 	return c
 }
 
-func (c *ffmpegCommand) String() (string, error) {
-	cmd := "ffmpeg"
+// WithStreamCopy remuxes the source video as is, skipping decoding, scaling and encoding
+func (c *ffmpegCommand) WithStreamCopy(enabled bool) *ffmpegCommand {
+	c.streamCopy = enabled
+	return c
+}
+
+func (c *ffmpegCommand) binary() string {
 	if c.binPath != "" {
-		cmd = c.binPath
+		return c.binPath
 	}
-	if c.globalArguments != nil {
-		cmd += " " + c.toArguments(c.globalArguments)
+	return "ffmpeg"
+}
+
+// Args returns the arguments FFmpeg is run with, in order and without the binary
+func (c *ffmpegCommand) Args() ([]string, error) {
+	if c.sourceUrl == "" {
+		return nil, fmt.Errorf("source URL is required")
 	}
-	cmd += c.buildDecodeHardwareArguments()
-	if c.inputArguments != nil {
-		cmd += " " + c.toArguments(c.inputArguments)
+	if c.destinationUrl == "" {
+		return nil, fmt.Errorf("destination URL is required")
 	}
-	if c.sourceUrl == "" {
-		return "", fmt.Errorf("source URL is required")
+	args := toArguments(c.globalArguments)
+	args = append(args, c.buildProgressArguments()...)
+	if !c.streamCopy {
+		args = append(args, c.buildDecodeHardwareArguments()...)
 	}
-	cmd += " -i " + fmt.Sprintf("'%s'", c.sourceUrl)
-	if c.fps > 0 && c.width > 0 && c.height > 0 {
-		cmd += c.buildScaleHardwareArguments(c.fps, c.width, c.height)
+	args = append(args, toArguments(c.inputArguments)...)
+	args = append(args, "-i", c.sourceUrl)
+	if !c.streamCopy && c.fps > 0 && c.width > 0 && c.height > 0 {
+		args = append(args, c.buildScaleHardwareArguments(c.fps, c.width, c.height)...)
 	}
-	if c.outputArguments != nil {
-		cmd += " " + c.toArguments(c.outputArguments)
+	args = append(args, toArguments(c.outputArguments)...)
+	// only the video is copied, G.711 audio of the cameras can't be muxed in
+	// MPEG-TS so audio is encoded as when transcoding
+	if c.streamCopy {
+		args = append(args, "-c:v", "copy")
 	}
-	if c.destinationUrl == "" {
-		return "", fmt.Errorf("destination URL is required")
+	args = append(args, c.destinationUrl)
+	return args, nil
+}
+
+// Command returns the process running FFmpeg directly, no shell parses its arguments
+func (c *ffmpegCommand) Command(ctx context.Context) (*exec.Cmd, error) {
+	args, err := c.Args()
+	if err != nil {
+		return nil, err
 	}
-	cmd += " " + fmt.Sprintf("'%s'", c.destinationUrl)
-	return cmd, nil
+	return exec.CommandContext(ctx, c.binary(), args...), nil
 }
 
-func (c *ffmpegCommand) buildDecodeHardwareArguments() string {
+// String describes the command for logs, the credentials of the URLs are redacted
+func (c *ffmpegCommand) String() string {
+	args, err := c.Args()
+	if err != nil {
+		return fmt.Sprintf("%s: %s", c.binary(), err)
+	}
+	described := []string{c.binary()}
+	for _, arg := range args {
+		if arg == c.sourceUrl || arg == c.destinationUrl {
+			arg = redactUrl(arg)
+		}
+		if strings.ContainsAny(arg, " \t\"'") {
+			arg = strconv.Quote(arg)
+		}
+		described = append(described, arg)
+	}
+	return strings.Join(described, " ")
+}
+
+// redactUrl hides the user info and the SRT passphrase of the URL
+func redactUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "xxxxx"
+	}
+	query := u.Query()
+	if query.Has("passphrase") {
+		query.Set("passphrase", "xxxxx")
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+func (c *ffmpegCommand) buildDecodeHardwareArguments() []string {
 	switch c.hardwareAccelerationType {
 	case VA_API:
-		return " -hwaccel vaapi -hwaccel_flags allow_profile_mismatch -hwaccel_device /dev/dri/renderD128 -hwaccel_output_format vaapi"
+		return []string{
+			"-hwaccel", "vaapi",
+			"-hwaccel_flags", "allow_profile_mismatch",
+			"-hwaccel_device", renderDevice,
+			"-hwaccel_output_format", "vaapi",
+		}
 	case QUICKSYNC:
-		return "-hwaccel qsv -qsv_device /dev/dri/renderD128 -hwaccel_output_format qsv -c:v h264_qsv"
+		return []string{
+			"-hwaccel", "qsv",
+			"-qsv_device", renderDevice,
+			"-hwaccel_output_format", "qsv",
+			"-c:v", "h264_qsv",
+		}
 	default:
-		return ""
+		return nil
+	}
+}
+
+// videoCodec is the encoder set in the output arguments
+func (c *ffmpegCommand) videoCodec() string {
+	codec := ""
+	for _, arg := range c.outputArguments {
+		switch arg.Name {
+		case "c:v", "codec:v", "vcodec":
+			codec = arg.Value
+		}
+	}
+	return codec
+}
+
+// encodesOnDevice tells whether the encoder takes the frames on the device they were
+// scaled on, e.g. h264_vaapi with vaapi, so they are not downloaded to memory
+func (c *ffmpegCommand) encodesOnDevice() bool {
+	switch c.hardwareAccelerationType {
+	case VA_API:
+		return strings.HasSuffix(c.videoCodec(), "_vaapi")
+	case QUICKSYNC:
+		return strings.HasSuffix(c.videoCodec(), "_qsv")
 	}
+	return false
 }
 
-func (c *ffmpegCommand) buildScaleHardwareArguments(fps int, width int, height int) string {
+func (c *ffmpegCommand) buildScaleHardwareArguments(fps int, width int, height int) []string {
+	// software encoders need the frames back in memory
+	download := ",hwdownload,format=nv12,format=yuv420p"
+	if c.encodesOnDevice() {
+		download = ""
+	}
 	switch c.hardwareAccelerationType {
 	case VA_API:
-		return fmt.Sprintf(" -r %d -vf fps=%d,scale_vaapi=w=%d:h=%d:format=nv12,hwdownload,format=nv12,format=yuv420p",
-			fps, fps, width, height)
+		return []string{"-r", strconv.Itoa(fps), "-vf",
+			fmt.Sprintf("fps=%d,scale_vaapi=w=%d:h=%d:format=nv12%s",
+				fps, width, height, download)}
 	case QUICKSYNC:
-		return fmt.Sprintf(" -r %d -vf vpp_qsv=framerate=%d:w=%d:h=%d:format=nv12,hwdownload,format=nv12,format=yuv420p",
-			fps, fps, width, height)
+		return []string{"-r", strconv.Itoa(fps), "-vf",
+			fmt.Sprintf("vpp_qsv=framerate=%d:w=%d:h=%d:format=nv12%s",
+				fps, width, height, download)}
 	default:
-		return fmt.Sprintf(" -r %d -vf scale=%d:%d", fps, width, height)
+		return []string{"-r", strconv.Itoa(fps), "-vf", fmt.Sprintf("scale=%d:%d", width, height)}
 	}
 }
 
-func (c *ffmpegCommand) toArguments(a map[string]string) string {
+func toArguments(a []Argument) []string {
 	var args []string
-	for k, v := range a {
-		args = append(args, fmt.Sprintf("-%s", k))
-		if v != "" {
-			args = append(args, v)
+	for _, arg := range a {
+		args = append(args, "-"+arg.Name)
+		if arg.Value != "" {
+			args = append(args, arg.Value)
 		}
 	}
-	return strings.Join(args, " ")
+	return args
 }
@@ -1,38 +1,121 @@
 package custff
 
-import "testing"
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
-func Test_FfmpegCommand(t *testing.T) {
-	ffmpegCommand := NewFFmpegCommand()
-	ffmpegCommand.
-		WithSourceUrl("./security_camera_01.mp4").
+var update = flag.Bool("update", false, "update the golden files")
+
+func newTestCommand() *ffmpegCommand {
+	return NewFFmpegCommand().
+		WithSourceUrl("rtsp://admin:it's a secret@192.168.1.64:554/Streaming/Channels/101").
 		WithGlobalArguments(
-			map[string]string{
-				"hide_banner": "",
-				"loglevel":    "info",
-				"threads":     "2",
-			},
+			Flag("hide_banner"),
+			Arg("loglevel", "info"),
+			Arg("threads", "2"),
+		).
+		WithInputArguments(
+			Arg("avoid_negative_ts", "make_zero"),
+			Arg("fflags", "+genpts+discardcorrupt"),
+			Arg("rtsp_transport", "tcp"),
+			Arg("use_wallclock_as_timestamps", "1"),
+			Arg("timeout", "5000000"),
 		).
-		WithInputArguments(map[string]string{
-			"avoid_negative_ts":           "make_zero",
-			"fflags":                      "+genpts+discardcorrupt",
-			"rtsp_transport":              "tcp",
-			"use_wallclock_as_timestamps": "1",
-			"timeout":                     "5000000",
-		}).
-		WithDestinationUrl("srt://103.165.142.15:8890?streamid=publish:test_ffmpeg").
-		WithOutputArguments(map[string]string{
-			"f":        "mpegts",
-			"c:v":      "libx264",
-			"preset:v": "faster",
-			"tune:v":   "zerolatency",
-		}).
-		WithScale(25, 1280, 720).
-		WithHardwareAccelerationType("")
-
-	res, err := ffmpegCommand.String()
+		WithDestinationUrl("srt://103.165.142.15:8890?streamid=publish:test_ffmpeg&passphrase=topsecret").
+		WithOutputArguments(
+			Arg("f", "mpegts"),
+			Arg("c:v", "libx264"),
+			Arg("preset:v", "faster"),
+			Arg("tune:v", "zerolatency"),
+		).
+		WithScale(25, 1280, 720)
+}
+
+func assertGolden(t *testing.T, name string, args []string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	got := strings.Join(args, "\n") + "\n"
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("arguments differ from %s\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func Test_FfmpegCommandGolden(t *testing.T) {
+	for _, accel := range []FFmpegHardwareAccelerationType{CPU, VA_API, QUICKSYNC} {
+		t.Run(string(accel), func(t *testing.T) {
+			args, err := newTestCommand().
+				WithHardwareAccelerationType(accel).
+				Args()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, string(accel), args)
+		})
+	}
+}
+
+func Test_FfmpegCommandHardwareEncoder(t *testing.T) {
+	encoders := map[FFmpegHardwareAccelerationType]string{
+		VA_API:    "h264_vaapi",
+		QUICKSYNC: "h264_qsv",
+	}
+	for accel, codec := range encoders {
+		t.Run(string(accel), func(t *testing.T) {
+			args, err := newTestCommand().
+				WithOutputArguments(
+					Arg("f", "mpegts"),
+					Arg("c:v", codec),
+				).
+				WithHardwareAccelerationType(accel).
+				Args()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, string(accel)+"_encode", args)
+		})
+	}
+}
+
+func Test_FfmpegCommandStreamCopy(t *testing.T) {
+	args, err := newTestCommand().
+		WithOutputArguments(Arg("f", "mpegts")).
+		WithHardwareAccelerationType(VA_API).
+		WithStreamCopy(true).
+		Args()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "copy", args)
+}
+
+func Test_FfmpegCommandString(t *testing.T) {
+	res := newTestCommand().String()
+	for _, secret := range []string{"secret@", "topsecret"} {
+		if strings.Contains(res, secret) {
+			t.Errorf("expected %q to be redacted from %s", secret, res)
+		}
+	}
+	if !strings.HasPrefix(res, "ffmpeg -hide_banner -loglevel info") {
+		t.Errorf("expected the arguments in order, got %s", res)
+	}
+}
+
+func Test_FfmpegCommandMissingUrl(t *testing.T) {
+	if _, err := NewFFmpegCommand().WithDestinationUrl("srt://server").Args(); err == nil {
+		t.Errorf("expected a missing source URL to fail")
 	}
-	t.Log(res)
 }
@@ -0,0 +1,80 @@
+package custff
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is a report FFmpeg writes with -progress every stats period
+type Progress struct {
+	Frame int64
+	Fps   float64
+	// Bitrate of the output in kbit/s
+	Bitrate    float64
+	TotalSize  int64
+	OutTime    time.Duration
+	DupFrames  int64
+	DropFrames int64
+	// Speed is the encoding speed relative to real time, below 1 the stream lags behind
+	Speed float64
+	// Ended is set on the last report, once FFmpeg stops
+	Ended bool
+}
+
+// WithProgress has FFmpeg write its progress to its standard output every period
+func (c *ffmpegCommand) WithProgress(period time.Duration) *ffmpegCommand {
+	c.progressPeriod = period
+	return c
+}
+
+func (c *ffmpegCommand) buildProgressArguments() []string {
+	if c.progressPeriod <= 0 {
+		return nil
+	}
+	return []string{
+		"-progress", "pipe:1",
+		"-stats_period", strconv.FormatFloat(c.progressPeriod.Seconds(), 'f', -1, 64),
+	}
+}
+
+// ReadProgress parses the key=value blocks of -progress until the reader ends,
+// each block is handed over once its progress line is read
+func ReadProgress(r io.Reader, onProgress func(*Progress)) error {
+	progress := &Progress{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "frame":
+			progress.Frame, _ = strconv.ParseInt(value, 10, 64)
+		case "fps":
+			progress.Fps, _ = strconv.ParseFloat(value, 64)
+		case "bitrate":
+			progress.Bitrate, _ = strconv.ParseFloat(strings.TrimSuffix(value, "kbits/s"), 64)
+		case "total_size":
+			progress.TotalSize, _ = strconv.ParseInt(value, 10, 64)
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				progress.OutTime = time.Duration(us) * time.Microsecond
+			}
+		case "dup_frames":
+			progress.DupFrames, _ = strconv.ParseInt(value, 10, 64)
+		case "drop_frames":
+			progress.DropFrames, _ = strconv.ParseInt(value, 10, 64)
+		case "speed":
+			progress.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "progress":
+			progress.Ended = value == "end"
+			onProgress(progress)
+			progress = &Progress{}
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,75 @@
+package custff
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const progressSample = `frame=250
+fps=25.01
+stream_0_0_q=23.0
+bitrate=1843.2kbits/s
+total_size=2304000
+out_time_us=10000000
+out_time=00:00:10.000000
+dup_frames=2
+drop_frames=5
+speed=1.01x
+progress=continue
+frame=N/A
+fps=0.00
+bitrate=N/A
+total_size=N/A
+out_time_us=N/A
+speed=N/A
+progress=end
+`
+
+func TestReadProgress(t *testing.T) {
+	var reports []*Progress
+	if err := ReadProgress(strings.NewReader(progressSample), func(p *Progress) {
+		reports = append(reports, p)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("expected a report per progress line, got %d", len(reports))
+	}
+
+	first := reports[0]
+	want := Progress{
+		Frame:      250,
+		Fps:        25.01,
+		Bitrate:    1843.2,
+		TotalSize:  2304000,
+		OutTime:    10 * time.Second,
+		DupFrames:  2,
+		DropFrames: 5,
+		Speed:      1.01,
+	}
+	if *first != want {
+		t.Errorf("expected %+v, got %+v", want, *first)
+	}
+
+	last := reports[1]
+	if !last.Ended {
+		t.Errorf("expected the last report to end the stream")
+	}
+	if last.Frame != 0 || last.Bitrate != 0 || last.Speed != 0 {
+		t.Errorf("expected unavailable values to be left unset, got %+v", *last)
+	}
+}
+
+func TestFfmpegCommandProgress(t *testing.T) {
+	args, err := newTestCommand().
+		WithProgress(2500 * time.Millisecond).
+		Args()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(args, " ")
+	if !strings.HasPrefix(got, "-hide_banner -loglevel info -threads 2 -progress pipe:1 -stats_period 2.5 ") {
+		t.Errorf("expected the progress arguments after the global ones, got %s", got)
+	}
+}
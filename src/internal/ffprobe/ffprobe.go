@@ -0,0 +1,234 @@
+package custprobe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CodecTypeVideo = "video"
+	CodecTypeAudio = "audio"
+)
+
+const defaultProbeTimeout = 10 * time.Second
+
+type ProbeResult struct {
+	Format  *Format   `json:"format,omitempty"`
+	Streams []*Stream `json:"streams"`
+}
+
+type Format struct {
+	FormatName string `json:"formatName"`
+	// BitRate of the whole source in bits per second, zero when unknown
+	BitRate    int64   `json:"bitRate,omitempty"`
+	StartTime  float64 `json:"startTime"`
+	ProbeScore int     `json:"probeScore"`
+}
+
+type Stream struct {
+	Index     int    `json:"index"`
+	CodecType string `json:"codecType"`
+	CodecName string `json:"codecName"`
+	Profile   string `json:"profile,omitempty"`
+	// BitRate of the stream in bits per second, zero when unknown
+	BitRate  int64  `json:"bitRate,omitempty"`
+	TimeBase string `json:"timeBase,omitempty"`
+
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+	Fps         float64 `json:"fps,omitempty"`
+	PixelFormat string  `json:"pixelFormat,omitempty"`
+
+	SampleRate int `json:"sampleRate,omitempty"`
+	Channels   int `json:"channels,omitempty"`
+}
+
+// Video returns the first video stream of the source
+func (r *ProbeResult) Video() *Stream {
+	for _, stream := range r.Streams {
+		if stream.CodecType == CodecTypeVideo {
+			return stream
+		}
+	}
+	return nil
+}
+
+// Audio returns the audio tracks of the source
+func (r *ProbeResult) Audio() []*Stream {
+	var tracks []*Stream
+	for _, stream := range r.Streams {
+		if stream.CodecType == CodecTypeAudio {
+			tracks = append(tracks, stream)
+		}
+	}
+	return tracks
+}
+
+// probeOutput is the JSON printed by ffprobe, numbers are mostly given as strings
+type probeOutput struct {
+	Format  *probeFormat   `json:"format"`
+	Streams []*probeStream `json:"streams"`
+}
+
+type probeFormat struct {
+	FormatName string `json:"format_name"`
+	BitRate    string `json:"bit_rate"`
+	StartTime  string `json:"start_time"`
+	ProbeScore int    `json:"probe_score"`
+}
+
+type probeStream struct {
+	Index        int    `json:"index"`
+	CodecType    string `json:"codec_type"`
+	CodecName    string `json:"codec_name"`
+	Profile      string `json:"profile"`
+	BitRate      string `json:"bit_rate"`
+	TimeBase     string `json:"time_base"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	AvgFrameRate string `json:"avg_frame_rate"`
+	RFrameRate   string `json:"r_frame_rate"`
+	PixFmt       string `json:"pix_fmt"`
+	SampleRate   string `json:"sample_rate"`
+	Channels     int    `json:"channels"`
+}
+
+func (o *probeOutput) result() *ProbeResult {
+	result := &ProbeResult{Streams: make([]*Stream, 0, len(o.Streams))}
+	if o.Format != nil {
+		startTime, _ := strconv.ParseFloat(o.Format.StartTime, 64)
+		result.Format = &Format{
+			FormatName: o.Format.FormatName,
+			BitRate:    parseInt(o.Format.BitRate),
+			StartTime:  startTime,
+			ProbeScore: o.Format.ProbeScore,
+		}
+	}
+	for _, s := range o.Streams {
+		stream := &Stream{
+			Index:     s.Index,
+			CodecType: s.CodecType,
+			CodecName: s.CodecName,
+			Profile:   s.Profile,
+			BitRate:   parseInt(s.BitRate),
+			TimeBase:  s.TimeBase,
+		}
+		switch s.CodecType {
+		case CodecTypeVideo:
+			stream.Width = s.Width
+			stream.Height = s.Height
+			stream.PixelFormat = s.PixFmt
+			// the average rate is 0/0 on some live sources, the base rate is the best guess then
+			stream.Fps = parseRational(s.AvgFrameRate)
+			if stream.Fps == 0 {
+				stream.Fps = parseRational(s.RFrameRate)
+			}
+		case CodecTypeAudio:
+			stream.SampleRate = int(parseInt(s.SampleRate))
+			stream.Channels = s.Channels
+		}
+		result.Streams = append(result.Streams, stream)
+	}
+	return result
+}
+
+func parseInt(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+// parseRational parses the num/den rates of ffprobe, 0/0 is zero
+func parseRational(value string) float64 {
+	num, den, found := strings.Cut(value, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !found {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// redact hides the credentials of the source in the messages of ffprobe
+func redact(message string, sourceUrl string) string {
+	u, err := url.Parse(sourceUrl)
+	if err != nil || u.User == nil {
+		return message
+	}
+	return strings.ReplaceAll(message, sourceUrl, u.Redacted())
+}
+
+type Prober struct {
+	binPath string
+	timeout time.Duration
+}
+
+type ProberOptioner func(p *Prober)
+
+func WithBinPath(path string) ProberOptioner {
+	return func(p *Prober) {
+		p.binPath = path
+	}
+}
+
+// WithTimeout bounds how long a probe may take, a camera that does not answer
+// would otherwise keep ffprobe waiting
+func WithTimeout(timeout time.Duration) ProberOptioner {
+	return func(p *Prober) {
+		p.timeout = timeout
+	}
+}
+
+func NewProber(opts ...ProberOptioner) *Prober {
+	p := &Prober{
+		binPath: "ffprobe",
+		timeout: defaultProbeTimeout,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Probe inspects the format and the streams of the source
+func (p *Prober) Probe(ctx context.Context, sourceUrl string) (*ProbeResult, error) {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	args := []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams"}
+	if strings.HasPrefix(sourceUrl, "rtsp://") {
+		args = append(args, "-rtsp_transport", "tcp")
+	}
+	args = append(args, sourceUrl)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.binPath, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("ffprobe did not finish: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("ffprobe failed: %w: %s", err, redact(strings.TrimSpace(stderr.String()), sourceUrl))
+	}
+
+	var output probeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+	return output.result(), nil
+}
@@ -2,8 +2,10 @@ package hikvision
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
@@ -17,10 +19,17 @@ type Client interface {
 	Event(credentials *Credentials) EventApiInterface
 	System(credentials *Credentials) SystemApiInterface
 	Streams(credentials *Credentials) StreamsApiInterface
+	Image(credentials *Credentials) ImageApiInterface
+	Forget(credentials *Credentials)
 }
 
 type client struct {
 	options *hikvisionOptions
+
+	mu sync.Mutex
+	// one transport per camera so keep-alive connections are reused across
+	// sub-clients, each switches to digest auth when basic auth is refused
+	transports map[string]*custhttp.AuthTransport
 }
 
 func NewClient(options ...HikvisionClientOptioner) (Client, error) {
@@ -29,7 +38,8 @@ func NewClient(options ...HikvisionClientOptioner) (Client, error) {
 		o(&opts)
 	}
 	return &client{
-		options: &opts,
+		options:    &opts,
+		transports: make(map[string]*custhttp.AuthTransport),
 	}, nil
 }
 
@@ -41,7 +51,47 @@ type Credentials struct {
 	Ip               string `json:"ip"`
 }
 
-func (c *client) getRestClient(opts *Credentials) (*http.Client, string) {
+func (c *client) getTransport(host string) *custhttp.AuthTransport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if transport, found := c.transports[host]; found {
+		return transport
+	}
+	poolSize := c.options.poolSize()
+	transport := custhttp.NewAuthTransport(&http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   c.options.dialTimeout(),
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        poolSize,
+		MaxIdleConnsPerHost: poolSize,
+		IdleConnTimeout:     c.options.idleTimeout(),
+	})
+	c.transports[host] = transport
+	logger.SDebug("created camera transport",
+		zap.String("host", host),
+		zap.Int("poolSize", poolSize))
+	return transport
+}
+
+// Forget drops the transport of a camera no longer managed and closes its idle connections
+func (c *client) Forget(credentials *Credentials) {
+	c.mu.Lock()
+	transport, found := c.transports[credentials.Ip]
+	delete(c.transports, credentials.Ip)
+	c.mu.Unlock()
+	if found {
+		transport.CloseIdleConnections()
+		logger.SDebug("removed camera transport",
+			zap.String("host", credentials.Ip))
+	}
+}
+
+// getRestClient returns the client and ISAPI base URL of the camera,
+// credentials are sent by each request and never embedded in the URL.
+// A zero timeout means the client is used for long-lived streams
+func (c *client) getRestClient(opts *Credentials, timeout time.Duration) (*http.Client, string) {
 	ip := opts.Ip
 
 	if opts.Username != "" && opts.Password != "" {
@@ -52,19 +102,19 @@ func (c *client) getRestClient(opts *Credentials) (*http.Client, string) {
 		}
 		u = u.JoinPath("/ISAPI")
 		u.Scheme = "http"
-		u.User = url.UserPassword(opts.Username, opts.Password)
 		ip = u.String()
 	}
 
 	httpClient := custhttp.NewHttpClient(
 		context.Background(),
-		custhttp.WithTimeout(2*time.Second))
+		custhttp.WithTimeout(timeout),
+		custhttp.WithTransport(c.getTransport(opts.Ip)))
 
 	return httpClient, ip
 }
 
 func (c *client) PtzCtrl(credentials *Credentials) PtzApiClientInterface {
-	client, ip := c.getRestClient(credentials)
+	client, ip := c.getRestClient(credentials, c.options.timeoutOf(OperationPtz))
 	return &ptzApiClient{
 		httpClient: client,
 		ip:         ip,
@@ -74,7 +124,7 @@ func (c *client) PtzCtrl(credentials *Credentials) PtzApiClientInterface {
 }
 
 func (c *client) Smart(credentials *Credentials) SmartApiInterface {
-	client, ip := c.getRestClient(credentials)
+	client, ip := c.getRestClient(credentials, c.options.timeoutOf(OperationSmart))
 	return &smartApiClient{
 		httpClient: client,
 		ip:         ip,
@@ -84,17 +134,19 @@ func (c *client) Smart(credentials *Credentials) SmartApiInterface {
 }
 
 func (c *client) Event(credentials *Credentials) EventApiInterface {
-	client, ip := c.getRestClient(credentials)
+	client, ip := c.getRestClient(credentials, c.options.timeoutOf(OperationEvent))
+	streamClient, _ := c.getRestClient(credentials, 0)
 	return &eventApiClient{
-		httpClient: client,
-		ip:         ip,
-		username:   credentials.Username,
-		password:   credentials.Password,
+		httpClient:   client,
+		streamClient: streamClient,
+		ip:           ip,
+		username:     credentials.Username,
+		password:     credentials.Password,
 	}
 }
 
 func (c *client) System(credentials *Credentials) SystemApiInterface {
-	client, ip := c.getRestClient(credentials)
+	client, ip := c.getRestClient(credentials, c.options.timeoutOf(OperationSystem))
 	return &systemApiClient{
 		httpClient: client,
 		ip:         ip,
@@ -104,7 +156,7 @@ func (c *client) System(credentials *Credentials) SystemApiInterface {
 }
 
 func (c *client) Streams(credentials *Credentials) StreamsApiInterface {
-	client, ip := c.getRestClient(credentials)
+	client, ip := c.getRestClient(credentials, c.options.timeoutOf(OperationStreams))
 	return &streamApiClient{
 		ip:         ip,
 		httpClient: client,
@@ -112,3 +164,13 @@ func (c *client) Streams(credentials *Credentials) StreamsApiInterface {
 		password:   credentials.Password,
 	}
 }
+
+func (c *client) Image(credentials *Credentials) ImageApiInterface {
+	client, ip := c.getRestClient(credentials, c.options.timeoutOf(OperationImage))
+	return &imageApiClient{
+		httpClient: client,
+		ip:         ip,
+		username:   credentials.Username,
+		password:   credentials.Password,
+	}
+}
@@ -0,0 +1,39 @@
+package hikvision
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClient_TransportPerCamera(t *testing.T) {
+	c, _ := NewClient(
+		WithPoolSize(4),
+		WithTimeout(3*time.Second),
+		WithOperationTimeout(OperationStreams, 5*time.Second))
+	hc := c.(*client)
+
+	first := &Credentials{Ip: "10.0.0.2", Username: "admin", Password: "secret"}
+	second := &Credentials{Ip: "10.0.0.3", Username: "admin", Password: "secret"}
+
+	ptz := hc.PtzCtrl(first).(*ptzApiClient)
+	system := hc.System(first).(*systemApiClient)
+	if ptz.httpClient.Transport != system.httpClient.Transport {
+		t.Fatalf("sub-clients of the same camera must share a transport")
+	}
+	other := hc.PtzCtrl(second).(*ptzApiClient)
+	if ptz.httpClient.Transport == other.httpClient.Transport {
+		t.Fatalf("cameras must not share a transport")
+	}
+
+	if ptz.httpClient.Timeout != 3*time.Second {
+		t.Fatalf("expected default timeout of 3s, got %s", ptz.httpClient.Timeout)
+	}
+	streams := hc.Streams(first).(*streamApiClient)
+	if streams.httpClient.Timeout != 5*time.Second {
+		t.Fatalf("expected streams timeout of 5s, got %s", streams.httpClient.Timeout)
+	}
+	event := hc.Event(first).(*eventApiClient)
+	if event.streamClient.Timeout != 0 {
+		t.Fatalf("alert stream client must not time out, got %s", event.streamClient.Timeout)
+	}
+}
@@ -2,57 +2,173 @@ package hikvision
 
 import (
 	"encoding/xml"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
 	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
 )
 
 type Status struct {
-	ID            string `xml:"id,omitempty"`
-	StatusCode    int    `xml:"statusCode"`
-	StatusString  string `xml:"statusString"`
-	SubStatusCode string `xml:"subStatusCode"`
+	ID            string `xml:"id,omitempty" json:"id,omitempty"`
+	StatusCode    int    `xml:"statusCode" json:"statusCode"`
+	StatusString  string `xml:"statusString" json:"statusString"`
+	SubStatusCode string `xml:"subStatusCode" json:"subStatusCode"`
 }
 
 type AdditionalError struct {
-	StatusList []Status `xml:"Status"`
+	StatusList []Status `xml:"Status" json:"statusList"`
 }
 
 type ResponseStatus struct {
-	XMLName       xml.Name         `xml:"ResponseStatus"`
-	Version       string           `xml:"version,attr"`
-	RequestURL    string           `xml:"requestURL"`
-	StatusCode    int              `xml:"statusCode"`
-	StatusString  string           `xml:"statusString"`
-	ID            int              `xml:"id,omitempty"`
-	SubStatusCode string           `xml:"subStatusCode"`
-	ErrorCode     int              `xml:"errorCode,omitempty"`
-	ErrorMsg      string           `xml:"errorMsg,omitempty"`
-	AdditionalErr *AdditionalError `xml:"AdditionalErr,omitempty"`
+	XMLName       xml.Name         `xml:"ResponseStatus" json:"-"`
+	Version       string           `xml:"version,attr" json:"-"`
+	RequestURL    string           `xml:"requestURL" json:"requestUrl"`
+	StatusCode    int              `xml:"statusCode" json:"statusCode"`
+	StatusString  string           `xml:"statusString" json:"statusString"`
+	ID            int              `xml:"id,omitempty" json:"id,omitempty"`
+	SubStatusCode string           `xml:"subStatusCode" json:"subStatusCode"`
+	ErrorCode     int              `xml:"errorCode,omitempty" json:"errorCode,omitempty"`
+	ErrorMsg      string           `xml:"errorMsg,omitempty" json:"errorMsg,omitempty"`
+	AdditionalErr *AdditionalError `xml:"AdditionalErr,omitempty" json:"additionalErr,omitempty"`
+}
+
+// ResponseStatus.StatusCode values
+const (
+	StatusOK                = 1
+	StatusDeviceBusy        = 2
+	StatusDeviceError       = 3
+	StatusInvalidOperation  = 4
+	StatusInvalidXMLFormat  = 5
+	StatusInvalidXMLContent = 6
+	StatusRebootRequired    = 7
+)
+
+// ISAPIError is an error reported by the device, it matches the
+// custerror code it is mapped onto with errors.Is
+type ISAPIError struct {
+	*custerror.CustomError
+	HttpStatus int             `json:"httpStatus"`
+	Response   *ResponseStatus `json:"response,omitempty"`
+}
+
+func (e *ISAPIError) Unwrap() error {
+	return e.CustomError
+}
+
+// closeResponse drains what is left of the body before closing it, a body closed
+// unread would close the connection instead of returning it to the pool
+func closeResponse(resp *http.Response) {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
 }
 
 func handleError(resp *http.Response) error {
-	switch resp.StatusCode {
-	case 400:
-		var parsedResp ResponseStatus
-		if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+	// the body is only worth parsing when it is XML, it is closed either way
+	defer closeResponse(resp)
+	// devices answer errors with a ResponseStatus body, except for
+	// authentication failures which usually come back as HTML
+	var parsedResp *ResponseStatus
+	if isXMLResponse(resp) {
+		parsedResp = &ResponseStatus{}
+		if err := custhttp.XMLResponse(resp, parsedResp); err != nil {
+			parsedResp = nil
+		}
+	}
+	return newISAPIError(resp.StatusCode, parsedResp)
+}
+
+func isXMLResponse(resp *http.Response) bool {
+	contentType := resp.Header.Get("Content-Type")
+	return contentType == "" || strings.Contains(contentType, "xml")
+}
+
+func newISAPIError(httpStatus int, status *ResponseStatus) *ISAPIError {
+	base := errorOfStatus(httpStatus, status)
+	msg := base.Msg
+	if status != nil {
+		detail := status.StatusString
+		if status.SubStatusCode != "" {
+			detail = fmt.Sprintf("%s (%s)", detail, status.SubStatusCode)
+		}
+		if status.ErrorMsg != "" {
+			detail = fmt.Sprintf("%s: %s", detail, status.ErrorMsg)
+		}
+		msg = fmt.Sprintf("%s: %s", msg, detail)
+	}
+	return &ISAPIError{
+		CustomError: custerror.NewError(msg, base.Code),
+		HttpStatus:  httpStatus,
+		Response:    status,
+	}
+}
+
+// errorOfStatus maps the device status onto a custerror code, the sub status
+// is the most specific and is looked at first, then the HTTP status and
+// finally the ISAPI status code
+func errorOfStatus(httpStatus int, status *ResponseStatus) *custerror.CustomError {
+	if status != nil {
+		if err := errorOfSubStatus(status.SubStatusCode); err != nil {
 			return err
 		}
-		return custerror.FormatInvalidArgument(parsedResp.StatusString)
-	case 401:
+	}
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return custerror.ErrorInvalidArgument
+	case http.StatusUnauthorized, http.StatusForbidden:
 		return custerror.ErrorPermissionDenied
-	case 404:
+	case http.StatusNotFound:
 		return custerror.ErrorNotFound
-	case 409:
-		var parsedResp ResponseStatus
-		if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
-			return err
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return custerror.ErrorUnimplemented
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return custerror.ErrorTimeout
+	case http.StatusConflict:
+		return custerror.ErrorAlreadyExists
+	case http.StatusLocked, http.StatusPreconditionFailed:
+		return custerror.ErrorFailedPrecondition
+	case http.StatusTooManyRequests:
+		return custerror.ErrorTooManyRequest
+	case http.StatusServiceUnavailable:
+		return custerror.ErrorUnavailable
+	}
+	if status != nil {
+		switch status.StatusCode {
+		case StatusDeviceBusy:
+			return custerror.ErrorUnavailable
+		case StatusInvalidOperation:
+			return custerror.ErrorFailedPrecondition
+		case StatusInvalidXMLFormat, StatusInvalidXMLContent:
+			return custerror.ErrorInvalidArgument
 		}
-		return custerror.FormatAlreadyExists(parsedResp.StatusString)
-	case 500:
-		return custerror.ErrorInternal
 	}
+	return custerror.ErrorInternal
+}
 
+func errorOfSubStatus(subStatusCode string) *custerror.CustomError {
+	switch subStatusCode {
+	case "", "ok":
+		return nil
+	case "notSupport", "methodNotAllowed", "UnSupportCapture":
+		return custerror.ErrorUnimplemented
+	case "lowPrivilege", "badAuthorization", "notActivated":
+		return custerror.ErrorPermissionDenied
+	case "deviceBusy", "upgrading", "serviceUnavailable", "noMemory", "reConnectIpc":
+		return custerror.ErrorUnavailable
+	case "invalidOperation":
+		return custerror.ErrorFailedPrecondition
+	case "badXmlFormat", "badXmlContent", "badParameters", "badPort":
+		return custerror.ErrorInvalidArgument
+	}
+	// PTZ control held by a user with a higher priority,
+	// reported as ptzLocked or ptzLockedByHigherPriority depending on firmware
+	if strings.HasPrefix(strings.ToLower(subStatusCode), "ptzlock") {
+		return custerror.ErrorFailedPrecondition
+	}
 	return nil
 }
@@ -0,0 +1,111 @@
+package hikvision
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+)
+
+const testResponseStatus = `<ResponseStatus version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<requestURL>/ISAPI/PTZCtrl/channels/1/continuous</requestURL>
+<statusCode>%s</statusCode>
+<statusString>%s</statusString>
+<subStatusCode>%s</subStatusCode>
+</ResponseStatus>`
+
+func newTestResponse(status int, contentType string, body string) *http.Response {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func newTestStatusResponse(status int, statusCode string, statusString string, subStatusCode string) *http.Response {
+	body := fmt.Sprintf(testResponseStatus, statusCode, statusString, subStatusCode)
+	return newTestResponse(status, "application/xml", body)
+}
+
+func TestHandleError_Success(t *testing.T) {
+	if err := handleError(newTestResponse(http.StatusOK, "application/xml", "")); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestHandleError_Mapping(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *http.Response
+		want *custerror.CustomError
+	}{
+		{"unauthorized html", newTestResponse(http.StatusUnauthorized, "text/html", "<html></html>"), custerror.ErrorPermissionDenied},
+		{"forbidden", newTestStatusResponse(http.StatusForbidden, "4", "Invalid Operation", "lowPrivilege"), custerror.ErrorPermissionDenied},
+		{"not supported", newTestStatusResponse(http.StatusForbidden, "4", "Invalid Operation", "notSupport"), custerror.ErrorUnimplemented},
+		{"ptz locked", newTestStatusResponse(http.StatusForbidden, "4", "Invalid Operation", "ptzLockedByHigherPriority"), custerror.ErrorFailedPrecondition},
+		{"locked status", newTestResponse(http.StatusLocked, "text/html", ""), custerror.ErrorFailedPrecondition},
+		{"busy", newTestStatusResponse(http.StatusServiceUnavailable, "2", "Device Busy", "deviceBusy"), custerror.ErrorUnavailable},
+		{"bad xml", newTestStatusResponse(http.StatusBadRequest, "5", "Invalid XML Format", "badXmlFormat"), custerror.ErrorInvalidArgument},
+		{"not found", newTestResponse(http.StatusNotFound, "text/html", ""), custerror.ErrorNotFound},
+		{"device error", newTestStatusResponse(http.StatusInternalServerError, "3", "Device Error", "deviceError"), custerror.ErrorInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handleError(tt.resp)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			var isapiErr *ISAPIError
+			if !errors.As(err, &isapiErr) {
+				t.Fatalf("expected an ISAPIError, got %T", err)
+			}
+			if isapiErr.HttpStatus != tt.resp.StatusCode {
+				t.Errorf("expected HTTP status %d, got %d", tt.resp.StatusCode, isapiErr.HttpStatus)
+			}
+		})
+	}
+}
+
+func TestHandleError_KeepsResponseStatus(t *testing.T) {
+	err := handleError(newTestStatusResponse(http.StatusForbidden, "4", "Invalid Operation", "ptzLocked"))
+	var isapiErr *ISAPIError
+	if !errors.As(err, &isapiErr) {
+		t.Fatalf("expected an ISAPIError, got %T", err)
+	}
+	if isapiErr.Response == nil || isapiErr.Response.SubStatusCode != "ptzLocked" {
+		t.Fatalf("expected the parsed response status, got %+v", isapiErr.Response)
+	}
+	if !strings.Contains(err.Error(), "ptzLocked") {
+		t.Errorf("expected the sub status in the message, got %q", err.Error())
+	}
+}
+
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestHandleError_ClosesBody(t *testing.T) {
+	for _, contentType := range []string{"text/html", "application/xml"} {
+		body := &trackedBody{Reader: strings.NewReader("<html>Unauthorized</html>")}
+		resp := newTestResponse(http.StatusUnauthorized, contentType, "")
+		resp.Body = body
+		if err := handleError(resp); !errors.Is(err, custerror.ErrorPermissionDenied) {
+			t.Errorf("%s: expected permission denied, got %v", contentType, err)
+		}
+		if !body.closed {
+			t.Errorf("%s: expected the error body to be closed", contentType)
+		}
+	}
+}
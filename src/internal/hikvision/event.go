@@ -2,23 +2,35 @@ package hikvision
 
 import (
 	"context"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
 )
 
 type EventApiInterface interface {
 	Capabilities(ctx context.Context) (*EventCapabilitiesResponse, error)
 	CapabilitiesChannel(ctx context.Context, channelId string) (*EventCapabilitiesOfChannelResponse, error)
+	AlertStream(ctx context.Context) <-chan *EventNotificationAlert
 }
 
 type eventApiClient struct {
 	httpClient *http.Client
-	username   string
-	password   string
-	ip         string
+	// streamClient has no timeout since the alert stream is held open
+	streamClient *http.Client
+	username     string
+	password     string
+	ip           string
 }
 
 func (c *eventApiClient) getBaseUrl() string {
@@ -48,6 +60,7 @@ func (c *eventApiClient) Capabilities(ctx context.Context) (*EventCapabilitiesRe
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(response)
 
 	if err := handleError(response); err != nil {
 		return nil, err
@@ -80,6 +93,7 @@ func (c *eventApiClient) CapabilitiesChannel(ctx context.Context, channelId stri
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
@@ -92,3 +106,188 @@ func (c *eventApiClient) CapabilitiesChannel(ctx context.Context, channelId stri
 
 	return &parsedResp, nil
 }
+
+type EventType string
+
+const (
+	EventTypeMotion       EventType = "VMD"
+	EventTypeLineCrossing EventType = "linedetection"
+	EventTypeIntrusion    EventType = "fielddetection"
+	EventTypeTamper       EventType = "shelteralarm"
+	EventTypeVideoLoss    EventType = "videoloss"
+	EventTypeIO           EventType = "IO"
+)
+
+const (
+	EventStateActive   = "active"
+	EventStateInactive = "inactive"
+)
+
+type EventNotificationAlert struct {
+	XMLName             xml.Name             `xml:"EventNotificationAlert" json:"-"`
+	IPAddress           string               `xml:"ipAddress" json:"ipAddress"`
+	PortNo              int                  `xml:"portNo" json:"portNo"`
+	Protocol            string               `xml:"protocol" json:"protocol"`
+	MacAddress          string               `xml:"macAddress" json:"macAddress"`
+	ChannelID           int                  `xml:"channelID" json:"channelId"`
+	DateTime            string               `xml:"dateTime" json:"dateTime"`
+	ActivePostCount     int                  `xml:"activePostCount" json:"activePostCount"`
+	EventType           EventType            `xml:"eventType" json:"eventType"`
+	EventState          string               `xml:"eventState" json:"eventState"`
+	EventDescription    string               `xml:"eventDescription" json:"eventDescription"`
+	InputIOPortID       int                  `xml:"inputIOPortID,omitempty" json:"inputIOPortId,omitempty"`
+	DetectionRegionList *DetectionRegionList `xml:"DetectionRegionList,omitempty" json:"detectionRegionList,omitempty"`
+}
+
+// IsHeartbeat reports whether the alert is the periodic keep-alive, cameras send
+// an inactive video loss alert that was never posted when nothing happens, a video
+// restored once lost is posted at least once and is a real alert
+func (a *EventNotificationAlert) IsHeartbeat() bool {
+	return a.EventType == EventTypeVideoLoss &&
+		a.EventState == EventStateInactive &&
+		a.ActivePostCount == 0
+}
+
+type DetectionRegionList struct {
+	DetectionRegionEntry []DetectionRegionEntry `xml:"DetectionRegionEntry" json:"entries"`
+}
+
+type DetectionRegionEntry struct {
+	RegionID              string                `xml:"regionID" json:"regionId"`
+	SensitivityLevel      int                   `xml:"sensitivityLevel" json:"sensitivityLevel"`
+	RegionCoordinatesList []RegionCoordinates   `xml:"RegionCoordinatesList>RegionCoordinates" json:"regionCoordinates"`
+	DetectionTarget       string                `xml:"detectionTarget,omitempty" json:"detectionTarget,omitempty"`
+	TargetRect            *AlertTargetRectangle `xml:"TargetRect,omitempty" json:"targetRect,omitempty"`
+}
+
+type RegionCoordinates struct {
+	PositionX int `xml:"positionX" json:"positionX"`
+	PositionY int `xml:"positionY" json:"positionY"`
+}
+
+type AlertTargetRectangle struct {
+	X      float64 `xml:"X" json:"x"`
+	Y      float64 `xml:"Y" json:"y"`
+	Width  float64 `xml:"width" json:"width"`
+	Height float64 `xml:"height" json:"height"`
+}
+
+const (
+	alertStreamMinBackoff = time.Second
+	alertStreamMaxBackoff = time.Minute
+)
+
+// AlertStream subscribes to the camera alert stream and delivers every alert
+// except heartbeats on the returned channel, the subscription reconnects
+// with exponential backoff until ctx is cancelled, then the channel is closed
+func (c *eventApiClient) AlertStream(ctx context.Context) <-chan *EventNotificationAlert {
+	alerts := make(chan *EventNotificationAlert, 16)
+	go func() {
+		defer close(alerts)
+		backoff := alertStreamMinBackoff
+		for {
+			startedAt := time.Now()
+			err := c.readAlertStream(ctx, alerts)
+			if ctx.Err() != nil {
+				return
+			}
+			// a stream that stayed up for a while is a fresh failure
+			if time.Since(startedAt) > alertStreamMaxBackoff {
+				backoff = alertStreamMinBackoff
+			}
+			logger.SError("alert stream disconnected",
+				zap.String("ip", c.ip),
+				zap.Duration("retryAfter", backoff),
+				zap.Error(err))
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, alertStreamMaxBackoff)
+		}
+	}()
+	return alerts
+}
+
+func (c *eventApiClient) readAlertStream(ctx context.Context, alerts chan<- *EventNotificationAlert) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/notification/alertStream", c.getBaseUrl()))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password))
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.streamClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	deliver := func(alert *EventNotificationAlert) error {
+		if alert.IsHeartbeat() {
+			return nil
+		}
+		select {
+		case alerts <- alert:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") {
+		return readMultipartAlerts(multipart.NewReader(resp.Body, params["boundary"]), deliver)
+	}
+	return readXMLAlerts(resp.Body, deliver)
+}
+
+func readMultipartAlerts(reader *multipart.Reader, deliver func(alert *EventNotificationAlert) error) error {
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		// pictures attached to smart events are not forwarded
+		if contentType := part.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "xml") {
+			continue
+		}
+		var alert EventNotificationAlert
+		if err := xml.NewDecoder(part).Decode(&alert); err != nil {
+			logger.SDebug("failed to parse alert stream part",
+				zap.Error(err))
+			continue
+		}
+		if err := deliver(&alert); err != nil {
+			return err
+		}
+	}
+}
+
+func readXMLAlerts(body io.Reader, deliver func(alert *EventNotificationAlert) error) error {
+	decoder := xml.NewDecoder(body)
+	for {
+		var alert EventNotificationAlert
+		if err := decoder.Decode(&alert); err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if err := deliver(&alert); err != nil {
+			return err
+		}
+	}
+}
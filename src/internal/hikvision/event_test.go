@@ -0,0 +1,91 @@
+package hikvision
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testAlertPart = `<EventNotificationAlert version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<ipAddress>10.0.0.2</ipAddress>
+<channelID>1</channelID>
+<dateTime>2024-05-01T10:00:00+07:00</dateTime>
+<activePostCount>%d</activePostCount>
+<eventType>%s</eventType>
+<eventState>%s</eventState>
+<eventDescription>test</eventDescription>
+</EventNotificationAlert>`
+
+func TestEvent_AlertStreamMultipart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ISAPI/Event/notification/alertStream" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "multipart/mixed; boundary=boundary")
+		fmt.Fprintf(w, "--boundary\r\nContent-Type: application/xml\r\n\r\n"+testAlertPart+"\r\n",
+			0, EventTypeVideoLoss, EventStateInactive)
+		fmt.Fprintf(w, "--boundary\r\nContent-Type: image/jpeg\r\n\r\nnot-a-picture\r\n")
+		fmt.Fprintf(w, "--boundary\r\nContent-Type: application/xml\r\n\r\n"+testAlertPart+"\r\n",
+			1, EventTypeMotion, EventStateActive)
+		fmt.Fprintf(w, "--boundary--\r\n")
+	}))
+	defer server.Close()
+
+	c := &eventApiClient{
+		streamClient: server.Client(),
+		ip:           server.URL + "/ISAPI",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	alerts := c.AlertStream(ctx)
+	alert, ok := <-alerts
+	if !ok {
+		t.Fatalf("alert stream closed before delivering an alert")
+	}
+	if alert.EventType != EventTypeMotion || alert.EventState != EventStateActive {
+		t.Fatalf("expected an active motion alert, got %+v", alert)
+	}
+	if alert.ChannelID != 1 {
+		t.Fatalf("expected channel 1, got %d", alert.ChannelID)
+	}
+
+	cancel()
+	for range alerts {
+	}
+}
+
+func TestEventNotificationAlert_IsHeartbeat(t *testing.T) {
+	cases := []struct {
+		name  string
+		alert EventNotificationAlert
+		want  bool
+	}{
+		{
+			name:  "keep-alive",
+			alert: EventNotificationAlert{EventType: EventTypeVideoLoss, EventState: EventStateInactive},
+			want:  true,
+		},
+		{
+			name:  "video restored",
+			alert: EventNotificationAlert{EventType: EventTypeVideoLoss, EventState: EventStateInactive, ActivePostCount: 1},
+		},
+		{
+			name:  "video lost",
+			alert: EventNotificationAlert{EventType: EventTypeVideoLoss, EventState: EventStateActive, ActivePostCount: 1},
+		},
+		{
+			name:  "motion ended",
+			alert: EventNotificationAlert{EventType: EventTypeMotion, EventState: EventStateInactive},
+		},
+	}
+	for _, c := range cases {
+		if got := c.alert.IsHeartbeat(); got != c.want {
+			t.Errorf("%s: expected heartbeat %t, got %t", c.name, c.want, got)
+		}
+	}
+}
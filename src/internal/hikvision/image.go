@@ -0,0 +1,158 @@
+package hikvision
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
+)
+
+type ImageApiInterface interface {
+	Channel(ctx context.Context, channelId string) (*ImageChannel, error)
+	UpdateChannel(ctx context.Context, channelId string, patch *ImageChannelPatch) error
+}
+
+type imageApiClient struct {
+	httpClient *http.Client
+	ip         string
+	username   string
+	password   string
+}
+
+func (c *imageApiClient) getBaseUrl() string {
+	return c.ip + "/Image"
+}
+
+type ImageChannel struct {
+	XMLName      xml.Name      `xml:"ImageChannel" json:"-"`
+	ID           string        `xml:"id" json:"id"`
+	Enabled      bool          `xml:"enabled" json:"enabled"`
+	VideoInputID string        `xml:"videoInputID" json:"videoInputId"`
+	IrcutFilter  *IrcutFilter  `xml:"IrcutFilter,omitempty" json:"ircutFilter,omitempty"`
+	WDR          *WDR          `xml:"WDR,omitempty" json:"wdr,omitempty"`
+	Exposure     *Exposure     `xml:"Exposure,omitempty" json:"exposure,omitempty"`
+	Shutter      *Shutter      `xml:"Shutter,omitempty" json:"shutter,omitempty"`
+	Gain         *Gain         `xml:"Gain,omitempty" json:"gain,omitempty"`
+	WhiteBalance *WhiteBalance `xml:"WhiteBalance,omitempty" json:"whiteBalance,omitempty"`
+	Color        *Color        `xml:"Color,omitempty" json:"color,omitempty"`
+	Sharpness    *Sharpness    `xml:"Sharpness,omitempty" json:"sharpness,omitempty"`
+}
+
+type IrcutFilter struct {
+	// IrcutFilterType is day, night or auto
+	IrcutFilterType       string `xml:"IrcutFilterType" json:"ircutFilterType"`
+	NightToDayFilterLevel int    `xml:"nightToDayFilterLevel,omitempty" json:"nightToDayFilterLevel,omitempty"`
+	NightToDayFilterTime  int    `xml:"nightToDayFilterTime,omitempty" json:"nightToDayFilterTime,omitempty"`
+}
+
+type WDR struct {
+	// Mode is open, close or auto
+	Mode     string `xml:"mode" json:"mode"`
+	WDRLevel int    `xml:"WDRLevel,omitempty" json:"wdrLevel,omitempty"`
+}
+
+type Exposure struct {
+	ExposureType string `xml:"ExposureType" json:"exposureType"`
+}
+
+type Shutter struct {
+	ShutterLevel string `xml:"ShutterLevel" json:"shutterLevel"`
+}
+
+type Gain struct {
+	GainLevel int `xml:"GainLevel" json:"gainLevel"`
+}
+
+type WhiteBalance struct {
+	WhiteBalanceStyle string `xml:"WhiteBalanceStyle" json:"whiteBalanceStyle"`
+	WhiteBalanceRed   int    `xml:"WhiteBalanceRed,omitempty" json:"whiteBalanceRed,omitempty"`
+	WhiteBalanceBlue  int    `xml:"WhiteBalanceBlue,omitempty" json:"whiteBalanceBlue,omitempty"`
+}
+
+type Color struct {
+	BrightnessLevel int `xml:"brightnessLevel" json:"brightnessLevel"`
+	ContrastLevel   int `xml:"contrastLevel" json:"contrastLevel"`
+	SaturationLevel int `xml:"saturationLevel" json:"saturationLevel"`
+}
+
+type Sharpness struct {
+	SharpnessLevel int `xml:"SharpnessLevel" json:"sharpnessLevel"`
+}
+
+// ImageChannelPatch lists the image settings to change,
+// nil fields are left as configured on the camera
+type ImageChannelPatch struct {
+	DayNightMode        *string `json:"dayNightMode,omitempty"`
+	DayNightSensitivity *int    `json:"dayNightSensitivity,omitempty"`
+	WDRMode             *string `json:"wdrMode,omitempty"`
+	WDRLevel            *int    `json:"wdrLevel,omitempty"`
+	ExposureType        *string `json:"exposureType,omitempty"`
+	ShutterLevel        *string `json:"shutterLevel,omitempty"`
+	GainLevel           *int    `json:"gainLevel,omitempty"`
+	WhiteBalanceStyle   *string `json:"whiteBalanceStyle,omitempty"`
+	WhiteBalanceRed     *int    `json:"whiteBalanceRed,omitempty"`
+	WhiteBalanceBlue    *int    `json:"whiteBalanceBlue,omitempty"`
+	Brightness          *int    `json:"brightness,omitempty"`
+	Contrast            *int    `json:"contrast,omitempty"`
+	Saturation          *int    `json:"saturation,omitempty"`
+	Sharpness           *int    `json:"sharpness,omitempty"`
+}
+
+func (p *ImageChannelPatch) apply(node *xmlNode) error {
+	node.setString("IrcutFilter/IrcutFilterType", p.DayNightMode)
+	node.setInt("IrcutFilter/nightToDayFilterLevel", p.DayNightSensitivity)
+	node.setString("WDR/mode", p.WDRMode)
+	node.setInt("WDR/WDRLevel", p.WDRLevel)
+	node.setString("Exposure/ExposureType", p.ExposureType)
+	node.setString("Shutter/ShutterLevel", p.ShutterLevel)
+	node.setInt("Gain/GainLevel", p.GainLevel)
+	node.setString("WhiteBalance/WhiteBalanceStyle", p.WhiteBalanceStyle)
+	node.setInt("WhiteBalance/WhiteBalanceRed", p.WhiteBalanceRed)
+	node.setInt("WhiteBalance/WhiteBalanceBlue", p.WhiteBalanceBlue)
+	node.setInt("Color/brightnessLevel", p.Brightness)
+	node.setInt("Color/contrastLevel", p.Contrast)
+	node.setInt("Color/saturationLevel", p.Saturation)
+	node.setInt("Sharpness/SharpnessLevel", p.Sharpness)
+	return nil
+}
+
+func (c *imageApiClient) Channel(ctx context.Context, channelId string) (*ImageChannel, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/channels/%s", c.getBaseUrl(), channelId))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp ImageChannel
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+// UpdateChannel changes the image settings of the video channel,
+// settings missing from the patch are preserved
+func (c *imageApiClient) UpdateChannel(ctx context.Context, channelId string, patch *ImageChannelPatch) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/channels/%s", c.getBaseUrl(), channelId))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, patch.apply)
+}
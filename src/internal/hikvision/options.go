@@ -1,13 +1,88 @@
 package hikvision
 
+import "time"
+
 type HikvisionClientOptioner func(o *hikvisionOptions)
 
+// Operation groups the ISAPI calls that share a timeout
+type Operation string
+
+const (
+	OperationPtz     Operation = "ptz"
+	OperationSmart   Operation = "smart"
+	OperationEvent   Operation = "event"
+	OperationSystem  Operation = "system"
+	OperationStreams Operation = "streams"
+	OperationImage   Operation = "image"
+)
+
+const (
+	defaultTimeout     = 2 * time.Second
+	defaultIdleTimeout = 90 * time.Second
+	defaultPoolSize    = 2
+)
+
+// WithPoolSize sets the number of idle keep-alive connections kept per camera
 func WithPoolSize(size int) HikvisionClientOptioner {
 	return func(o *hikvisionOptions) {
 		o.Poolsize = size
 	}
 }
 
+// WithIdleTimeout sets how long an idle connection to a camera is kept open
+func WithIdleTimeout(timeout time.Duration) HikvisionClientOptioner {
+	return func(o *hikvisionOptions) {
+		o.IdleTimeout = timeout
+	}
+}
+
+// WithTimeout sets the request timeout of operations without their own timeout
+func WithTimeout(timeout time.Duration) HikvisionClientOptioner {
+	return func(o *hikvisionOptions) {
+		o.Timeout = timeout
+	}
+}
+
+func WithOperationTimeout(op Operation, timeout time.Duration) HikvisionClientOptioner {
+	return func(o *hikvisionOptions) {
+		if o.OperationTimeouts == nil {
+			o.OperationTimeouts = make(map[Operation]time.Duration)
+		}
+		o.OperationTimeouts[op] = timeout
+	}
+}
+
 type hikvisionOptions struct {
-	Poolsize int    `json:"poolSize"`
+	Poolsize          int                         `json:"poolSize"`
+	IdleTimeout       time.Duration               `json:"idleTimeout"`
+	Timeout           time.Duration               `json:"timeout"`
+	OperationTimeouts map[Operation]time.Duration `json:"operationTimeouts"`
+}
+
+func (o *hikvisionOptions) poolSize() int {
+	if o.Poolsize > 0 {
+		return o.Poolsize
+	}
+	return defaultPoolSize
+}
+
+func (o *hikvisionOptions) idleTimeout() time.Duration {
+	if o.IdleTimeout > 0 {
+		return o.IdleTimeout
+	}
+	return defaultIdleTimeout
+}
+
+func (o *hikvisionOptions) dialTimeout() time.Duration {
+	if o.Timeout > 0 {
+		return o.Timeout
+	}
+	return defaultTimeout
+}
+
+func (o *hikvisionOptions) timeoutOf(op Operation) time.Duration {
+	if timeout, found := o.OperationTimeouts[op]; found {
+		return timeout
+	}
+	return o.dialTimeout()
 }
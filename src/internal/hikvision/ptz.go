@@ -4,10 +4,11 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
-	"time"
 
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
 	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
 	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
 	"gonum.org/v1/gonum/interp"
@@ -19,9 +20,33 @@ type PtzApiClientInterface interface {
 	Channels(ctx context.Context) (*PTZCtrlChannelsResponse, error)
 	Capabilities(ctx context.Context, channelId string) (*PTZChannelCapabilities, error)
 	RawContinuous(ctx context.Context, req *PtzCtrlRawContinousRequest) error
-	ContinousWithReset(ctx context.Context, req *PtzCtrlContinousWithResetRequest) error
 	Status(ctx context.Context, req *PtzCtrlStatusRequest) (*PTZStatus, error)
+	TrackStatus(ctx context.Context, channelId string) (*PTZTrackStatus, error)
 	Relative(ctx context.Context, req *PTZCtrlRelativeRequest) error
+	Absolute(ctx context.Context, req *PtzCtrlAbsoluteRequest) error
+	Focus(ctx context.Context, req *PtzCtrlFocusRequest) error
+	Iris(ctx context.Context, req *PtzCtrlIrisRequest) error
+	Presets(ctx context.Context, channelId string) (*PTZPresetList, error)
+	Preset(ctx context.Context, req *PtzCtrlPresetRequest) (*PTZPreset, error)
+	SetPreset(ctx context.Context, req *PtzCtrlSetPresetRequest) error
+	DeletePreset(ctx context.Context, req *PtzCtrlPresetRequest) error
+	GotoPreset(ctx context.Context, req *PtzCtrlPresetRequest) error
+	SetHomePosition(ctx context.Context, channelId string) error
+	GotoHomePosition(ctx context.Context, channelId string) error
+	ParkAction(ctx context.Context, channelId string) (*PTZParkAction, error)
+	SetParkAction(ctx context.Context, channelId string, req *PTZParkAction) error
+	TimeTask(ctx context.Context, channelId string) (*PTZTimeTask, error)
+	SetTimeTask(ctx context.Context, channelId string, req *PTZTimeTask) error
+	Patrols(ctx context.Context, channelId string) (*PTZPatrolList, error)
+	SetPatrol(ctx context.Context, req *PtzCtrlSetPatrolRequest) error
+	DeletePatrol(ctx context.Context, req *PtzCtrlPatrolRequest) error
+	StartPatrol(ctx context.Context, req *PtzCtrlPatrolRequest) error
+	StopPatrol(ctx context.Context, req *PtzCtrlPatrolRequest) error
+	Pattern(ctx context.Context, req *PtzCtrlPatternRequest) error
+	Limits(ctx context.Context, channelId string) (*PTZLimitList, error)
+	SetLimit(ctx context.Context, req *PtzCtrlLimitRequest, patch *PTZLimitPatch) error
+	SetLimitStop(ctx context.Context, req *PtzCtrlLimitStopRequest) error
+	ClearLimit(ctx context.Context, req *PtzCtrlLimitRequest) error
 }
 
 type ptzApiClient struct {
@@ -40,6 +65,15 @@ func (c *ptzApiClient) getUrlWithChannel(id string) string {
 }
 
 type PTZCtrlChannelsResponse struct {
+	XMLName  xml.Name     `xml:"PTZChannelList" json:"-"`
+	Channels []PTZChannel `xml:"PTZChannel" json:"channels"`
+}
+
+type PTZChannel struct {
+	ID              string `xml:"id" json:"id"`
+	Enabled         bool   `xml:"enabled" json:"enabled"`
+	VideoInputID    string `xml:"videoInputID,omitempty" json:"videoInputId,omitempty"`
+	ControlProtocol string `xml:"controlProtocol,omitempty" json:"controlProtocol,omitempty"`
 }
 
 func (c *ptzApiClient) Channels(ctx context.Context) (*PTZCtrlChannelsResponse, error) {
@@ -59,6 +93,7 @@ func (c *ptzApiClient) Channels(ctx context.Context) (*PTZCtrlChannelsResponse,
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
@@ -198,23 +233,23 @@ type ThermometryCap struct {
 }
 
 type EmissivityRange struct {
-	Min float64 `xml:"min,attr"`
-	Max float64 `xml:"max,attr"`
+	Min float64 `xml:"Min"`
+	Max float64 `xml:"Max"`
 }
 
 type RelativeHumidityRange struct {
-	Min float64 `xml:"min,attr"`
-	Max float64 `xml:"max,attr"`
+	Min float64 `xml:"Min"`
+	Max float64 `xml:"Max"`
 }
 
 type AtmosphericPressureRange struct {
-	Min float64 `xml:"min,attr"`
-	Max float64 `xml:"max,attr"`
+	Min float64 `xml:"Min"`
+	Max float64 `xml:"Max"`
 }
 
 type TemperatureRange struct {
-	Min float64 `xml:"min,attr"`
-	Max float64 `xml:"max,attr"`
+	Min float64 `xml:"Min"`
+	Max float64 `xml:"Max"`
 }
 
 type TrackingRatio struct {
@@ -246,18 +281,18 @@ type FocusSpeed struct {
 }
 
 type XRange struct {
-	Min float64 `xml:"min,attr"`
-	Max float64 `xml:"max,attr"`
+	Min float64 `xml:"Min"`
+	Max float64 `xml:"Max"`
 }
 
 type YRange struct {
-	Min float64 `xml:"min,attr"`
-	Max float64 `xml:"max,attr"`
+	Min float64 `xml:"Min"`
+	Max float64 `xml:"Max"`
 }
 
 type ZRange struct {
-	Min float64 `xml:"min,attr"`
-	Max float64 `xml:"max,attr"`
+	Min float64 `xml:"Min"`
+	Max float64 `xml:"Max"`
 }
 
 func (c *ptzApiClient) Capabilities(ctx context.Context, channelId string) (*PTZChannelCapabilities, error) {
@@ -277,6 +312,7 @@ func (c *ptzApiClient) Capabilities(ctx context.Context, channelId string) (*PTZ
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
@@ -299,6 +335,7 @@ type PtzCtrlContinousOptions struct {
 	XMLName xml.Name `xml:"PTZData"`
 	Pan     int      `xml:"pan"`  // + is right, - is left
 	Tilt    int      `xml:"tilt"` // + is up, - is down
+	Zoom    int      `xml:"zoom"` // + is in, - is out
 }
 
 func (c *ptzApiClient) RawContinuous(ctx context.Context, req *PtzCtrlRawContinousRequest) error {
@@ -320,6 +357,7 @@ func (c *ptzApiClient) RawContinuous(ctx context.Context, req *PtzCtrlRawContino
 	if err != nil {
 		return err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return err
@@ -328,120 +366,97 @@ func (c *ptzApiClient) RawContinuous(ctx context.Context, req *PtzCtrlRawContino
 	return nil
 }
 
-type PtzCtrlContinousWithResetRequest struct {
-	ChannelId  string
-	Options    *PtzCtrlContinousOptions
-	ResetAfter time.Duration
+type PtzCtrlStatusRequest struct {
+	ChannelId string
 }
 
-var ptzCtrlResetRequestBody PtzCtrlContinousOptions = PtzCtrlContinousOptions{
-	Pan:  0,
-	Tilt: 0,
+type PTZStatus struct {
+	XMLName      xml.Name     `xml:"PTZStatus"`
+	Version      string       `xml:"version,attr"`
+	AbsoluteHigh AbsoluteHigh `xml:"AbsoluteHigh"`
 }
 
-func (c *ptzApiClient) ContinousWithReset(ctx context.Context, req *PtzCtrlContinousWithResetRequest) error {
-	p, _ := url.Parse(fmt.Sprintf("%s/continuous", c.getUrlWithChannel(req.ChannelId)))
+type AbsoluteHigh struct {
+	Elevation    int `xml:"elevation" json:"elevation"`
+	Azimuth      int `xml:"azimuth" json:"azimuth"`
+	AbsoluteZoom int `xml:"absoluteZoom" json:"absoluteZoom"`
+}
 
-	resetRequest, err := custhttp.NewHttpRequest(
-		context.Background(),
-		p,
-		http.MethodPut,
-		custhttp.WithBasicAuth(c.username, c.password),
-		custhttp.WithContentType("application/xml"),
-		custhttp.WithXMLBody(ptzCtrlResetRequestBody),
-	)
-	if err != nil {
-		return err
-	}
+func (c *ptzApiClient) Status(ctx context.Context, req *PtzCtrlStatusRequest) (*PTZStatus, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/status", c.getUrlWithChannel(req.ChannelId)))
+	logger.SDebug("PTZ status request", zap.String("url", p.String()))
 
-	continousRequest, err := custhttp.NewHttpRequest(
+	statusRequest, err := custhttp.NewHttpRequest(
 		ctx,
 		p,
-		http.MethodPut,
+		http.MethodGet,
 		custhttp.WithBasicAuth(c.username, c.password),
 		custhttp.WithContentType("application/xml"),
-		custhttp.WithXMLBody(req.Options),
+		custhttp.WithXMLBody(req),
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	resp, err := c.httpClient.Do(continousRequest)
+	resp, err := c.httpClient.Do(statusRequest)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
-		return err
+		return nil, err
 	}
 
-	go func() {
-		<-time.After(req.ResetAfter)
-		logger.SDebug("PTZ Control continuous request start")
-
-		resp, err := c.httpClient.Do(resetRequest)
-		if err != nil {
-			logger.SError("failed to send PTZ Control continuous reset request",
-				zap.Error(err))
-			return
-		}
-
-		if err := handleError(resp); err != nil {
-			logger.SError("failed to send PTZ Control continuous reset request",
-				zap.Error(err))
-			return
-		}
-
-		logger.SDebug("PTZ Control continuous request reset completed",
-			zap.String("channelId", req.ChannelId),
-			zap.Duration("after", req.ResetAfter))
-	}()
+	var parsedResp PTZStatus
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
 
-	return nil
+	return &parsedResp, nil
 }
 
-type PtzCtrlStatusRequest struct {
-	ChannelId string
-}
+// track states, the channel is moving in any state but normal
+const (
+	PTZTrackStatusNormal     = "normal"
+	PTZTrackStatusFollowMove = "followMove"
+)
 
-type PTZStatus struct {
-	XMLName      xml.Name     `xml:"PTZStatus"`
-	Version      string       `xml:"version,attr"`
-	AbsoluteHigh AbsoluteHigh `xml:"AbsoluteHigh"`
+type PTZTrackStatus struct {
+	XMLName     xml.Name `xml:"PTZTrackStatus" json:"-"`
+	TrackStatus string   `xml:"trackStatus" json:"trackStatus"`
 }
 
-type AbsoluteHigh struct {
-	Elevation    int `xml:"elevation"`
-	Azimuth      int `xml:"azimuth"`
-	AbsoluteZoom int `xml:"absoluteZoom"`
+func (s *PTZTrackStatus) Moving() bool {
+	return s.TrackStatus != "" && s.TrackStatus != PTZTrackStatusNormal
 }
 
-func (c *ptzApiClient) Status(ctx context.Context, req *PtzCtrlStatusRequest) (*PTZStatus, error) {
-	p, _ := url.Parse(fmt.Sprintf("%s/status", c.getUrlWithChannel(req.ChannelId)))
-	logger.SDebug("PTZ status request", zap.String("url", p.String()))
+// TrackStatus reports whether the channel is moving, supported when the
+// capabilities of the channel have IsSupportPTZTrackStatus
+func (c *ptzApiClient) TrackStatus(ctx context.Context, channelId string) (*PTZTrackStatus, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/PTZTrackStatus", c.getUrlWithChannel(channelId)))
 
-	statusRequest, err := custhttp.NewHttpRequest(
+	request, err := custhttp.NewHttpRequest(
 		ctx,
 		p,
 		http.MethodGet,
 		custhttp.WithBasicAuth(c.username, c.password),
-		custhttp.WithContentType("application/xml"),
-		custhttp.WithXMLBody(req),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := c.httpClient.Do(statusRequest)
+	resp, err := c.httpClient.Do(request)
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
 	}
 
-	var parsedResp PTZStatus
+	var parsedResp PTZTrackStatus
 	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
 		return nil, err
 	}
@@ -450,9 +465,10 @@ func (c *ptzApiClient) Status(ctx context.Context, req *PtzCtrlStatusRequest) (*
 }
 
 type PTZCtrlRelativeRequest struct {
-	XMLName  xml.Name   `xml:"PTZData" json:"-"`
-	Relative Relative   `xml:"Relative" json:"relative"`
-	Frame    FrameSpecs `xml:"-" json:"frame"`
+	XMLName   xml.Name   `xml:"PTZData" json:"-"`
+	ChannelId string     `xml:"-" json:"channelId,omitempty"`
+	Relative  Relative   `xml:"Relative" json:"relative"`
+	Frame     FrameSpecs `xml:"-" json:"frame"`
 }
 
 type FrameSpecs struct {
@@ -481,18 +497,35 @@ func (r *PTZCtrlRelativeRequest) toMove3D() *Move3DRequest {
 	scaler.Fit([]float64{0, float64(width)}, []float64{0, 255})
 	move3DDestX := scaler.Predict(relCoordX)
 
+	// a box drawn from top-left to bottom-right zooms in,
+	// drawn from bottom-right to top-left zooms out
+	zoom := math.Max(-1, math.Min(1, float64(r.Relative.RelativeZoom)))
+	half := 0.0
+	if zoom != 0 {
+		half = math.Max(1, move3DMax/2*(1-math.Abs(zoom)))
+	}
+	if zoom < 0 {
+		half = -half
+	}
+
 	return &Move3DRequest{
 		StartPoint: Position3D{
-			PositionX: int32(move3DDestX),
-			PositionY: int32(move3DDestY),
+			PositionX: clampMove3D(move3DDestX - half),
+			PositionY: clampMove3D(move3DDestY - half),
 		},
 		EndPoint: Position3D{
-			PositionX: int32(move3DDestX),
-			PositionY: int32(move3DDestY),
+			PositionX: clampMove3D(move3DDestX + half),
+			PositionY: clampMove3D(move3DDestY + half),
 		},
 	}
 }
 
+const move3DMax = 255
+
+func clampMove3D(v float64) int32 {
+	return int32(math.Round(math.Max(0, math.Min(move3DMax, v))))
+}
+
 type Relative struct {
 	PositionX    float32 `xml:"positionX" json:"positionX"`
 	PositionY    float32 `xml:"positionY" json:"positionY"`
@@ -512,7 +545,7 @@ type Position3D struct {
 
 func (c *ptzApiClient) Relative(ctx context.Context, req *PTZCtrlRelativeRequest) error {
 	p, _ := url.Parse(fmt.Sprintf("%s/position3D",
-		c.getUrlWithChannel("1")))
+		c.getUrlWithChannel(req.ChannelId)))
 	logger.SDebug("PTZ relative request",
 		zap.String("url", p.String()))
 
@@ -537,6 +570,7 @@ func (c *ptzApiClient) Relative(ctx context.Context, req *PTZCtrlRelativeRequest
 		logger.SDebug("PTZ relative request failed", zap.Error(err))
 		return err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		logger.SDebug("PTZ relative request failed", zap.Error(err))
@@ -545,3 +579,163 @@ func (c *ptzApiClient) Relative(ctx context.Context, req *PTZCtrlRelativeRequest
 
 	return nil
 }
+
+type PtzCtrlAbsoluteRequest struct {
+	ChannelId string
+	Position  *AbsoluteHigh
+}
+
+type ptzAbsoluteData struct {
+	XMLName      xml.Name      `xml:"PTZData"`
+	AbsoluteHigh *AbsoluteHigh `xml:"AbsoluteHigh"`
+}
+
+// ValidateAbsolute checks the position against the absolute pan/tilt and zoom
+// spaces reported by the channel, spaces that are not reported are not checked
+func (c *PTZChannelCapabilities) ValidateAbsolute(pos *AbsoluteHigh) error {
+	if space := c.AbsolutePanTiltPositionSpace; space != nil {
+		if r := space.XRange; r != nil {
+			if float64(pos.Azimuth) < r.Min || float64(pos.Azimuth) > r.Max {
+				return custerror.FormatInvalidArgument("azimuth %d is out of range [%v, %v]", pos.Azimuth, r.Min, r.Max)
+			}
+		}
+		if r := space.YRange; r != nil {
+			if float64(pos.Elevation) < r.Min || float64(pos.Elevation) > r.Max {
+				return custerror.FormatInvalidArgument("elevation %d is out of range [%v, %v]", pos.Elevation, r.Min, r.Max)
+			}
+		}
+	}
+	if space := c.AbsoluteZoomPositionSpace; space != nil {
+		if r := space.ZRange; r != nil {
+			if float64(pos.AbsoluteZoom) < r.Min || float64(pos.AbsoluteZoom) > r.Max {
+				return custerror.FormatInvalidArgument("zoom %d is out of range [%v, %v]", pos.AbsoluteZoom, r.Min, r.Max)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *ptzApiClient) Absolute(ctx context.Context, req *PtzCtrlAbsoluteRequest) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/absolute", c.getUrlWithChannel(req.ChannelId)))
+	logger.SDebug("PTZ absolute request",
+		zap.String("url", p.String()),
+		zap.Reflect("position", req.Position))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(c.username, c.password),
+		custhttp.WithContentType("application/xml"),
+		custhttp.WithXMLBody(&ptzAbsoluteData{
+			AbsoluteHigh: req.Position,
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		logger.SDebug("PTZ absolute request failed", zap.Error(err))
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		logger.SDebug("PTZ absolute request failed", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// SupportsContinuousZoom reports whether the channel has a motorised zoom
+func (c *PTZChannelCapabilities) SupportsContinuousZoom() bool {
+	return c.ContinuousZoomSpace != nil || c.PqrsZoom != nil
+}
+
+// SupportsLensControl reports whether the channel allows manual focus and iris
+func (c *PTZChannelCapabilities) SupportsLensControl() bool {
+	return c.MnstFocus != nil
+}
+
+type PtzCtrlFocusRequest struct {
+	ChannelId string
+	Options   *PtzCtrlFocusOptions
+}
+
+type PtzCtrlFocusOptions struct {
+	XMLName xml.Name `xml:"FocusData"`
+	Focus   int      `xml:"focus"` // + is far, - is near
+}
+
+type PtzCtrlIrisRequest struct {
+	ChannelId string
+	Options   *PtzCtrlIrisOptions
+}
+
+type PtzCtrlIrisOptions struct {
+	XMLName xml.Name `xml:"IrisData"`
+	Iris    int      `xml:"iris"` // + is open, - is close
+}
+
+func (c *ptzApiClient) getVideoInputUrl(channelId string) string {
+	return fmt.Sprintf("%s/System/Video/inputs/channels/%s", c.ip, channelId)
+}
+
+func (c *ptzApiClient) Focus(ctx context.Context, req *PtzCtrlFocusRequest) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/focus", c.getVideoInputUrl(req.ChannelId)))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(c.username, c.password),
+		custhttp.WithContentType("application/xml"),
+		custhttp.WithXMLBody(req.Options),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *ptzApiClient) Iris(ctx context.Context, req *PtzCtrlIrisRequest) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/iris", c.getVideoInputUrl(req.ChannelId)))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(c.username, c.password),
+		custhttp.WithContentType("application/xml"),
+		custhttp.WithXMLBody(req.Options),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
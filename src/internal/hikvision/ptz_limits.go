@@ -0,0 +1,151 @@
+package hikvision
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
+)
+
+// limit modes, manual stops bound manual moves and scan stops bound scans
+const (
+	PTZLimitModeManual = "manual"
+	PTZLimitModeScan   = "scan"
+)
+
+// limit stops, set from the current position of the channel
+const (
+	PTZLimitStopLeft  = "left"
+	PTZLimitStopRight = "right"
+	PTZLimitStopUp    = "up"
+	PTZLimitStopDown  = "down"
+)
+
+type PTZLimitList struct {
+	XMLName xml.Name    `xml:"PTZLimitList" json:"-"`
+	Limits  []*PTZLimit `xml:"PTZLimit" json:"limits"`
+}
+
+type PTZLimit struct {
+	XMLName xml.Name `xml:"PTZLimit" json:"-"`
+	ID      int      `xml:"id" json:"id"`
+	Enabled bool     `xml:"enabled" json:"enabled"`
+	Mode    string   `xml:"mode,omitempty" json:"mode,omitempty"`
+}
+
+type PTZLimitPatch struct {
+	Enabled *bool
+	Mode    *string
+}
+
+func (p *PTZLimitPatch) apply(node *xmlNode) error {
+	node.setBool("enabled", p.Enabled)
+	node.setString("mode", p.Mode)
+	return nil
+}
+
+type PtzCtrlLimitRequest struct {
+	ChannelId string
+	LimitId   int
+}
+
+type PtzCtrlLimitStopRequest struct {
+	ChannelId string
+	LimitId   int
+	// Stop is one of the PTZLimitStop directions
+	Stop string
+}
+
+// ValidateLimit checks the limit against the limits reported by the channel
+func (c *PTZChannelCapabilities) ValidateLimit(limitId int) error {
+	if !c.IsSupportPtzlimiteds {
+		return custerror.FormatUnimplemented("camera does not support PTZ limits")
+	}
+	if limitId < 1 || (c.MaxLimitesNum > 0 && limitId > c.MaxLimitesNum) {
+		return custerror.FormatInvalidArgument("limit %d is out of range [1, %d]", limitId, c.MaxLimitesNum)
+	}
+	return nil
+}
+
+func (c *ptzApiClient) getLimitUrl(channelId string, limitId int) string {
+	return fmt.Sprintf("%s/limits/%d", c.getUrlWithChannel(channelId), limitId)
+}
+
+func (c *ptzApiClient) Limits(ctx context.Context, channelId string) (*PTZLimitList, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/limits", c.getUrlWithChannel(channelId)))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp PTZLimitList
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+// SetLimit enables or disables the limit, the stops already saved are preserved
+func (c *ptzApiClient) SetLimit(ctx context.Context, req *PtzCtrlLimitRequest, patch *PTZLimitPatch) error {
+	p, _ := url.Parse(c.getLimitUrl(req.ChannelId, req.LimitId))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, patch.apply)
+}
+
+// SetLimitStop saves the current position of the channel as a stop of the limit
+func (c *ptzApiClient) SetLimitStop(ctx context.Context, req *PtzCtrlLimitStopRequest) error {
+	switch req.Stop {
+	case PTZLimitStopLeft, PTZLimitStopRight, PTZLimitStopUp, PTZLimitStopDown:
+	default:
+		return custerror.FormatInvalidArgument("unknown PTZ limit stop %q", req.Stop)
+	}
+	p, _ := url.Parse(fmt.Sprintf("%s/%s", c.getLimitUrl(req.ChannelId, req.LimitId), req.Stop))
+	return c.put(ctx, p)
+}
+
+// ClearLimit removes the stops saved for the limit
+func (c *ptzApiClient) ClearLimit(ctx context.Context, req *PtzCtrlLimitRequest) error {
+	p, _ := url.Parse(c.getLimitUrl(req.ChannelId, req.LimitId))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodDelete,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package hikvision
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+// PTZ actions a park action or a time task can run
+const (
+	PTZActionPreset     = "preset"
+	PTZActionPatrol     = "patrol"
+	PTZActionPattern    = "pattern"
+	PTZActionAutoScan   = "autoscan"
+	PTZActionFrameScan  = "framescan"
+	PTZActionRandomScan = "randomscan"
+	PTZActionPanorama   = "panoramascan"
+	PTZActionTiltScan   = "tiltscan"
+)
+
+const timeTaskClockLayout = "15:04"
+
+type PTZAction struct {
+	ActionType string `xml:"ActionType" json:"actionType"`
+	// ActionNum is the preset, patrol or pattern to run, unused by scans
+	ActionNum int `xml:"ActionNum,omitempty" json:"actionNum,omitempty"`
+}
+
+// PTZParkAction runs the action once the channel has been idle for ParkTime seconds
+type PTZParkAction struct {
+	XMLName  xml.Name  `xml:"ParkAction" json:"-"`
+	Enabled  bool      `xml:"enabled" json:"enabled"`
+	ParkTime int       `xml:"Parktime" json:"parkTime"`
+	Action   PTZAction `xml:"Action" json:"action"`
+}
+
+type PTZTimeTask struct {
+	XMLName  xml.Name            `xml:"TimeTask" json:"-"`
+	Enabled  bool                `xml:"enabled" json:"enabled"`
+	ParkTime int                 `xml:"Parktime,omitempty" json:"parkTime,omitempty"`
+	Blocks   []*PTZTimeTaskBlock `xml:"TimeTaskList>TimeTaskBlock" json:"blocks"`
+}
+
+// PTZTimeTaskBlock holds the tasks of a day, days of week go from 1 (Monday) to 7 (Sunday)
+type PTZTimeTaskBlock struct {
+	DayOfWeek int                 `xml:"dayOfWeek" json:"dayOfWeek"`
+	Ranges    []*PTZTimeTaskRange `xml:"TimeTaskRange" json:"ranges"`
+}
+
+// PTZTimeTaskRange runs the action between BeginTime and EndTime, formatted as hh:mm
+type PTZTimeTaskRange struct {
+	ID        int       `xml:"id" json:"id"`
+	Action    PTZAction `xml:"Task" json:"action"`
+	BeginTime string    `xml:"beginTime" json:"beginTime"`
+	EndTime   string    `xml:"endTime" json:"endTime"`
+}
+
+type ptzParkActionAction struct {
+	XMLName xml.Name `xml:"Action"`
+	PTZAction
+}
+
+type ptzTimeTaskList struct {
+	XMLName xml.Name            `xml:"TimeTaskList"`
+	Blocks  []*PTZTimeTaskBlock `xml:"TimeTaskBlock"`
+}
+
+// ValidateAction checks the preset, patrol or pattern number against the channel limits
+func (c *PTZChannelCapabilities) ValidateAction(action *PTZAction) error {
+	limit := 0
+	switch action.ActionType {
+	case PTZActionPreset:
+		limit = c.MaxPresetNum
+	case PTZActionPatrol:
+		limit = c.MaxPatrolNum
+	case PTZActionPattern:
+		limit = c.MaxPatternNum
+	case PTZActionAutoScan, PTZActionFrameScan, PTZActionRandomScan, PTZActionPanorama, PTZActionTiltScan:
+		return nil
+	default:
+		return custerror.FormatInvalidArgument("unknown PTZ action %q", action.ActionType)
+	}
+	if action.ActionNum < 1 || (limit > 0 && action.ActionNum > limit) {
+		return custerror.FormatInvalidArgument("%s %d is out of range [1, %d]", action.ActionType, action.ActionNum, limit)
+	}
+	return nil
+}
+
+// ValidateTimeTask checks every task and the number of tasks against the channel limit
+func (c *PTZChannelCapabilities) ValidateTimeTask(task *PTZTimeTask) error {
+	count := 0
+	for _, block := range task.Blocks {
+		if block.DayOfWeek < 1 || block.DayOfWeek > 7 {
+			return custerror.FormatInvalidArgument("day of week must be between 1 and 7, got %d", block.DayOfWeek)
+		}
+		for _, r := range block.Ranges {
+			if err := c.ValidateAction(&r.Action); err != nil {
+				return err
+			}
+			begin, beginErr := time.Parse(timeTaskClockLayout, r.BeginTime)
+			end, endErr := time.Parse(timeTaskClockLayout, r.EndTime)
+			if beginErr != nil || endErr != nil || !begin.Before(end) {
+				return custerror.FormatInvalidArgument("time task %d must run between hh:mm times, got %q to %q", r.ID, r.BeginTime, r.EndTime)
+			}
+			count++
+		}
+	}
+	if c.MaxTimeTaskNum > 0 && count > c.MaxTimeTaskNum {
+		return custerror.FormatInvalidArgument("at most %d time tasks are supported, got %d", c.MaxTimeTaskNum, count)
+	}
+	return nil
+}
+
+// SetHomePosition saves the current position of the channel as its home position
+func (c *ptzApiClient) SetHomePosition(ctx context.Context, channelId string) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/homeposition", c.getUrlWithChannel(channelId)))
+	return c.put(ctx, p)
+}
+
+func (c *ptzApiClient) GotoHomePosition(ctx context.Context, channelId string) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/homeposition/goto", c.getUrlWithChannel(channelId)))
+	return c.put(ctx, p)
+}
+
+func (c *ptzApiClient) ParkAction(ctx context.Context, channelId string) (*PTZParkAction, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/parkaction", c.getUrlWithChannel(channelId)))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp PTZParkAction
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+func (c *ptzApiClient) SetParkAction(ctx context.Context, channelId string, req *PTZParkAction) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/parkaction", c.getUrlWithChannel(channelId)))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, func(node *xmlNode) error {
+		node.set("enabled", strconv.FormatBool(req.Enabled))
+		node.set("Parktime", strconv.Itoa(req.ParkTime))
+		return node.replace(&ptzParkActionAction{PTZAction: req.Action})
+	})
+}
+
+func (c *ptzApiClient) TimeTask(ctx context.Context, channelId string) (*PTZTimeTask, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/timetask", c.getUrlWithChannel(channelId)))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp PTZTimeTask
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+// SetTimeTask replaces the scheduled tasks of the channel
+func (c *ptzApiClient) SetTimeTask(ctx context.Context, channelId string, req *PTZTimeTask) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/timetask", c.getUrlWithChannel(channelId)))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, func(node *xmlNode) error {
+		node.set("enabled", strconv.FormatBool(req.Enabled))
+		if req.ParkTime > 0 {
+			node.set("Parktime", strconv.Itoa(req.ParkTime))
+		}
+		return node.replace(&ptzTimeTaskList{Blocks: req.Blocks})
+	})
+}
+
+// put sends a body-less PUT, used by the PTZ commands that only trigger an action
+func (c *ptzApiClient) put(ctx context.Context, p *url.URL) error {
+	logger.SDebug("PTZ action request",
+		zap.String("url", p.String()))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package hikvision
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestPTZParkAction_Replace(t *testing.T) {
+	var node xmlNode
+	if err := xml.Unmarshal([]byte(`<ParkAction><enabled>false</enabled><Parktime>5</Parktime><Action><ActionType>autoscan</ActionType></Action></ParkAction>`), &node); err != nil {
+		t.Fatalf("unable to parse park action: %v", err)
+	}
+	node.set("enabled", "true")
+	if err := node.replace(&ptzParkActionAction{PTZAction: PTZAction{ActionType: PTZActionPreset, ActionNum: 3}}); err != nil {
+		t.Fatalf("unable to replace action: %v", err)
+	}
+	data, err := xml.Marshal(&node)
+	if err != nil {
+		t.Fatalf("unable to marshal park action: %v", err)
+	}
+
+	var parkAction PTZParkAction
+	if err := xml.Unmarshal(data, &parkAction); err != nil {
+		t.Fatalf("unable to parse patched park action: %v", err)
+	}
+	if !parkAction.Enabled || parkAction.ParkTime != 5 {
+		t.Errorf("expected an enabled park action after 5 seconds, got %+v", parkAction)
+	}
+	if parkAction.Action != (PTZAction{ActionType: PTZActionPreset, ActionNum: 3}) {
+		t.Errorf("expected the action to be replaced, got %+v in %s", parkAction.Action, data)
+	}
+}
+
+func TestPTZChannelCapabilities_ValidateTimeTask(t *testing.T) {
+	capabilities := &PTZChannelCapabilities{MaxPresetNum: 8, MaxTimeTaskNum: 1}
+	taskOf := func(ranges ...*PTZTimeTaskRange) *PTZTimeTask {
+		return &PTZTimeTask{Blocks: []*PTZTimeTaskBlock{{DayOfWeek: 1, Ranges: ranges}}}
+	}
+	preset := PTZAction{ActionType: PTZActionPreset, ActionNum: 1}
+
+	cases := []struct {
+		name    string
+		task    *PTZTimeTask
+		wantErr bool
+	}{
+		{"valid", taskOf(&PTZTimeTaskRange{ID: 1, Action: preset, BeginTime: "08:00", EndTime: "18:00"}), false},
+		{"scan without number", taskOf(&PTZTimeTaskRange{ID: 1, Action: PTZAction{ActionType: PTZActionAutoScan}, BeginTime: "08:00", EndTime: "18:00"}), false},
+		{"preset out of range", taskOf(&PTZTimeTaskRange{ID: 1, Action: PTZAction{ActionType: PTZActionPreset, ActionNum: 9}, BeginTime: "08:00", EndTime: "18:00"}), true},
+		{"unknown action", taskOf(&PTZTimeTaskRange{ID: 1, Action: PTZAction{ActionType: "dance"}, BeginTime: "08:00", EndTime: "18:00"}), true},
+		{"reversed range", taskOf(&PTZTimeTaskRange{ID: 1, Action: preset, BeginTime: "18:00", EndTime: "08:00"}), true},
+		{"too many tasks", taskOf(
+			&PTZTimeTaskRange{ID: 1, Action: preset, BeginTime: "08:00", EndTime: "12:00"},
+			&PTZTimeTaskRange{ID: 2, Action: preset, BeginTime: "13:00", EndTime: "18:00"},
+		), true},
+		{"invalid day", &PTZTimeTask{Blocks: []*PTZTimeTaskBlock{{DayOfWeek: 8}}}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := capabilities.ValidateTimeTask(c.task)
+			if (err != nil) != c.wantErr {
+				t.Errorf("expected error %v, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
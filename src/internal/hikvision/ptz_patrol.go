@@ -0,0 +1,207 @@
+package hikvision
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	maxPatrolSequence = 32
+	minPatrolSpeed    = 1
+	maxPatrolSpeed    = 40
+)
+
+// pattern commands, named after the path segment of the ISAPI resource
+const (
+	PTZPatternRecordStart = "recordstart"
+	PTZPatternRecordStop  = "recordstop"
+	PTZPatternRun         = "run"
+	PTZPatternStop        = "stop"
+)
+
+type PTZPatrolList struct {
+	XMLName xml.Name     `xml:"PTZPatrolList" json:"-"`
+	Patrols []*PTZPatrol `xml:"PTZPatrol" json:"patrols"`
+}
+
+type PTZPatrol struct {
+	XMLName    xml.Name             `xml:"PTZPatrol" json:"-"`
+	ID         int                  `xml:"id" json:"id"`
+	PatrolName string               `xml:"patrolName,omitempty" json:"patrolName,omitempty"`
+	Sequence   []*PTZPatrolSequence `xml:"PatrolSequenceList>PatrolSequence" json:"sequence"`
+}
+
+// PTZPatrolSequence is a stop of the patrol, the camera moves to the preset
+// at the given speed and stays there for Delay seconds
+type PTZPatrolSequence struct {
+	PresetID int `xml:"presetID" json:"presetId"`
+	Speed    int `xml:"speed" json:"speed"`
+	Delay    int `xml:"delay" json:"delay"`
+}
+
+type PtzCtrlPatrolRequest struct {
+	ChannelId string
+	PatrolId  int
+}
+
+type PtzCtrlSetPatrolRequest struct {
+	ChannelId string
+	Patrol    *PTZPatrol
+}
+
+type PtzCtrlPatternRequest struct {
+	ChannelId string
+	PatternId int
+	// Command is one of the PTZPattern commands
+	Command string
+}
+
+// ValidatePatrol checks the patrol and its presets against the limits reported by the channel
+func (c *PTZChannelCapabilities) ValidatePatrol(patrol *PTZPatrol) error {
+	if patrol.ID < 1 || (c.MaxPatrolNum > 0 && patrol.ID > c.MaxPatrolNum) {
+		return custerror.FormatInvalidArgument("patrol %d is out of range [1, %d]", patrol.ID, c.MaxPatrolNum)
+	}
+	if len(patrol.Sequence) == 0 || len(patrol.Sequence) > maxPatrolSequence {
+		return custerror.FormatInvalidArgument("patrol must have between 1 and %d presets, got %d", maxPatrolSequence, len(patrol.Sequence))
+	}
+	for _, sequence := range patrol.Sequence {
+		if err := c.ValidatePreset(&PTZPreset{ID: sequence.PresetID}); err != nil {
+			return err
+		}
+		if sequence.Speed < minPatrolSpeed || sequence.Speed > maxPatrolSpeed {
+			return custerror.FormatInvalidArgument("patrol speed must be between %d and %d, got %d", minPatrolSpeed, maxPatrolSpeed, sequence.Speed)
+		}
+		if sequence.Delay < 0 {
+			return custerror.FormatInvalidArgument("patrol delay must not be negative, got %d", sequence.Delay)
+		}
+	}
+	return nil
+}
+
+// ValidatePattern checks the pattern number against the channel limit
+func (c *PTZChannelCapabilities) ValidatePattern(patternId int) error {
+	return c.ValidateAction(&PTZAction{ActionType: PTZActionPattern, ActionNum: patternId})
+}
+
+func (c *ptzApiClient) getPatrolUrl(channelId string, patrolId int) string {
+	return fmt.Sprintf("%s/patrols/%d", c.getUrlWithChannel(channelId), patrolId)
+}
+
+func (c *ptzApiClient) Patrols(ctx context.Context, channelId string) (*PTZPatrolList, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/patrols", c.getUrlWithChannel(channelId)))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp PTZPatrolList
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+// SetPatrol replaces the presets the patrol goes through
+func (c *ptzApiClient) SetPatrol(ctx context.Context, req *PtzCtrlSetPatrolRequest) error {
+	p, _ := url.Parse(c.getPatrolUrl(req.ChannelId, req.Patrol.ID))
+	logger.SDebug("PTZ set patrol request",
+		zap.String("url", p.String()),
+		zap.Int("patrolId", req.Patrol.ID))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(c.username, c.password),
+		custhttp.WithContentType("application/xml"),
+		custhttp.WithXMLBody(req.Patrol),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *ptzApiClient) DeletePatrol(ctx context.Context, req *PtzCtrlPatrolRequest) error {
+	p, _ := url.Parse(c.getPatrolUrl(req.ChannelId, req.PatrolId))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodDelete,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *ptzApiClient) StartPatrol(ctx context.Context, req *PtzCtrlPatrolRequest) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/start", c.getPatrolUrl(req.ChannelId, req.PatrolId)))
+	return c.put(ctx, p)
+}
+
+func (c *ptzApiClient) StopPatrol(ctx context.Context, req *PtzCtrlPatrolRequest) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/stop", c.getPatrolUrl(req.ChannelId, req.PatrolId)))
+	return c.put(ctx, p)
+}
+
+// Pattern records or plays back the pattern, a recording keeps every
+// move made between the record start and stop commands
+func (c *ptzApiClient) Pattern(ctx context.Context, req *PtzCtrlPatternRequest) error {
+	switch req.Command {
+	case PTZPatternRecordStart, PTZPatternRecordStop, PTZPatternRun, PTZPatternStop:
+	default:
+		return custerror.FormatInvalidArgument("unknown PTZ pattern command %q", req.Command)
+	}
+	p, _ := url.Parse(fmt.Sprintf("%s/patterns/%d/%s", c.getUrlWithChannel(req.ChannelId), req.PatternId, req.Command))
+	return c.put(ctx, p)
+}
@@ -0,0 +1,63 @@
+package hikvision
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestPTZPatrol_Marshal(t *testing.T) {
+	patrol := &PTZPatrol{
+		ID:         1,
+		PatrolName: "perimeter",
+		Sequence: []*PTZPatrolSequence{
+			{PresetID: 2, Speed: 20, Delay: 10},
+			{PresetID: 1, Speed: 30, Delay: 5},
+		},
+	}
+	data, err := xml.Marshal(patrol)
+	if err != nil {
+		t.Fatalf("unable to marshal patrol: %v", err)
+	}
+	expected := "<PTZPatrol><id>1</id><patrolName>perimeter</patrolName><PatrolSequenceList>" +
+		"<PatrolSequence><presetID>2</presetID><speed>20</speed><delay>10</delay></PatrolSequence>" +
+		"<PatrolSequence><presetID>1</presetID><speed>30</speed><delay>5</delay></PatrolSequence>" +
+		"</PatrolSequenceList></PTZPatrol>"
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
+
+func TestPTZChannelCapabilities_ValidatePatrol(t *testing.T) {
+	capabilities := &PTZChannelCapabilities{MaxPresetNum: 8, MaxPatrolNum: 4}
+	patrolOf := func(id int, sequence ...*PTZPatrolSequence) *PTZPatrol {
+		return &PTZPatrol{ID: id, Sequence: sequence}
+	}
+
+	cases := []struct {
+		name    string
+		patrol  *PTZPatrol
+		wantErr string
+	}{
+		{"valid", patrolOf(1, &PTZPatrolSequence{PresetID: 1, Speed: 10, Delay: 5}), ""},
+		{"patrol out of range", patrolOf(5, &PTZPatrolSequence{PresetID: 1, Speed: 10}), "patrol 5"},
+		{"no presets", patrolOf(1), "between 1 and"},
+		{"unknown preset", patrolOf(1, &PTZPatrolSequence{PresetID: 9, Speed: 10}), "preset id 9"},
+		{"speed too high", patrolOf(1, &PTZPatrolSequence{PresetID: 1, Speed: 41}), "speed"},
+		{"negative delay", patrolOf(1, &PTZPatrolSequence{PresetID: 1, Speed: 10, Delay: -1}), "delay"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := capabilities.ValidatePatrol(c.patrol)
+			if c.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("expected error containing %q, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package hikvision
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+type PTZPresetList struct {
+	XMLName xml.Name     `xml:"PTZPresetList" json:"-"`
+	Version string       `xml:"version,attr,omitempty" json:"-"`
+	Presets []*PTZPreset `xml:"PTZPreset" json:"presets"`
+}
+
+type PTZPreset struct {
+	XMLName    xml.Name `xml:"PTZPreset" json:"-"`
+	ID         int      `xml:"id" json:"id"`
+	PresetName string   `xml:"presetName,omitempty" json:"presetName,omitempty"`
+	Enabled    *bool    `xml:"enabled,omitempty" json:"enabled,omitempty"`
+}
+
+type PtzCtrlPresetRequest struct {
+	ChannelId string
+	PresetId  int
+}
+
+type PtzCtrlSetPresetRequest struct {
+	ChannelId string
+	Preset    *PTZPreset
+}
+
+// ValidatePreset checks the preset against the limits reported by the channel
+func (c *PTZChannelCapabilities) ValidatePreset(preset *PTZPreset) error {
+	if preset.ID < 1 {
+		return custerror.FormatInvalidArgument("preset id must be positive, got %d", preset.ID)
+	}
+	if c.MaxPresetNum > 0 && preset.ID > c.MaxPresetNum {
+		return custerror.FormatInvalidArgument("preset id %d exceeds maximum of %d", preset.ID, c.MaxPresetNum)
+	}
+	if preset.PresetName != "" && c.PresetNameCap != nil && !c.PresetNameCap.PresetNameSupport {
+		return custerror.FormatInvalidArgument("preset names are not supported by this channel")
+	}
+	return nil
+}
+
+func (c *ptzApiClient) getPresetUrl(channelId string, presetId int) string {
+	return fmt.Sprintf("%s/presets/%d", c.getUrlWithChannel(channelId), presetId)
+}
+
+func (c *ptzApiClient) Presets(ctx context.Context, channelId string) (*PTZPresetList, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/presets", c.getUrlWithChannel(channelId)))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp PTZPresetList
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+func (c *ptzApiClient) Preset(ctx context.Context, req *PtzCtrlPresetRequest) (*PTZPreset, error) {
+	p, _ := url.Parse(c.getPresetUrl(req.ChannelId, req.PresetId))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp PTZPreset
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+// SetPreset saves the current position of the channel as the given preset,
+// creating it or overwriting its position and name
+func (c *ptzApiClient) SetPreset(ctx context.Context, req *PtzCtrlSetPresetRequest) error {
+	p, _ := url.Parse(c.getPresetUrl(req.ChannelId, req.Preset.ID))
+	logger.SDebug("PTZ set preset request",
+		zap.String("url", p.String()),
+		zap.Int("presetId", req.Preset.ID))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(c.username, c.password),
+		custhttp.WithContentType("application/xml"),
+		custhttp.WithXMLBody(req.Preset),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *ptzApiClient) DeletePreset(ctx context.Context, req *PtzCtrlPresetRequest) error {
+	p, _ := url.Parse(c.getPresetUrl(req.ChannelId, req.PresetId))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodDelete,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *ptzApiClient) GotoPreset(ctx context.Context, req *PtzCtrlPresetRequest) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/goto", c.getPresetUrl(req.ChannelId, req.PresetId)))
+	logger.SDebug("PTZ goto preset request",
+		zap.String("url", p.String()))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
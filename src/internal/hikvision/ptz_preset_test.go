@@ -0,0 +1,79 @@
+package hikvision
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+)
+
+func TestPTZChannelCapabilities_ValidatePreset(t *testing.T) {
+	capabilities := &PTZChannelCapabilities{
+		MaxPresetNum:  256,
+		PresetNameCap: &PresetNameCap{PresetNameSupport: false},
+	}
+	cases := []struct {
+		name   string
+		preset PTZPreset
+		valid  bool
+	}{
+		{name: "in range", preset: PTZPreset{ID: 1}, valid: true},
+		{name: "upper bound", preset: PTZPreset{ID: 256}, valid: true},
+		{name: "zero", preset: PTZPreset{ID: 0}},
+		{name: "above maximum", preset: PTZPreset{ID: 257}},
+		{name: "unsupported name", preset: PTZPreset{ID: 2, PresetName: "gate"}},
+	}
+	for _, c := range cases {
+		err := capabilities.ValidatePreset(&c.preset)
+		if c.valid && err != nil {
+			t.Errorf("%s: expected a valid preset, got %v", c.name, err)
+		}
+		if !c.valid && !errors.Is(err, custerror.ErrorInvalidArgument) {
+			t.Errorf("%s: expected an invalid argument, got %v", c.name, err)
+		}
+	}
+
+	capabilities.PresetNameCap.PresetNameSupport = true
+	if err := capabilities.ValidatePreset(&PTZPreset{ID: 2, PresetName: "gate"}); err != nil {
+		t.Errorf("expected names to be accepted once supported, got %v", err)
+	}
+}
+
+func TestPTZPreset_MarshalXML(t *testing.T) {
+	body, err := xml.Marshal(&PTZPreset{ID: 3, PresetName: "gate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<PTZPreset><id>3</id><presetName>gate</presetName></PTZPreset>"
+	if string(body) != want {
+		t.Errorf("expected %s, got %s", want, body)
+	}
+
+	body, err = xml.Marshal(&PTZPreset{ID: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "presetName") || strings.Contains(string(body), "enabled") {
+		t.Errorf("expected unset fields to be omitted, got %s", body)
+	}
+}
+
+func TestPTZPresetList_UnmarshalXML(t *testing.T) {
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<PTZPresetList version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+	<PTZPreset><id>1</id><presetName>gate</presetName><enabled>true</enabled></PTZPreset>
+	<PTZPreset><id>2</id><presetName>yard</presetName><enabled>false</enabled></PTZPreset>
+</PTZPresetList>`
+	var list PTZPresetList
+	if err := xml.Unmarshal([]byte(body), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Presets) != 2 || list.Presets[1].ID != 2 || list.Presets[1].PresetName != "yard" {
+		t.Fatalf("unexpected presets %+v", list.Presets)
+	}
+	if list.Presets[1].Enabled == nil || *list.Presets[1].Enabled {
+		t.Errorf("expected the second preset to be disabled")
+	}
+}
@@ -1,6 +1,7 @@
 package hikvision
 
 import (
+	"encoding/xml"
 	"fmt"
 	"testing"
 
@@ -52,3 +53,123 @@ func TestMove3D_Interpolation2(t *testing.T) {
 
 	fmt.Println(width3d, height3d)
 }
+
+func TestCapabilities_ValidateAbsolute(t *testing.T) {
+	capabilities := &PTZChannelCapabilities{
+		AbsolutePanTiltPositionSpace: &PanTiltPosition{
+			XRange: &XRange{Min: 0, Max: 3600},
+			YRange: &YRange{Min: -900, Max: 2700},
+		},
+		AbsoluteZoomPositionSpace: &ZoomPosition{
+			ZRange: &ZRange{Min: 10, Max: 250},
+		},
+	}
+	if err := capabilities.ValidateAbsolute(&AbsoluteHigh{
+		Azimuth:      1800,
+		Elevation:    100,
+		AbsoluteZoom: 10,
+	}); err != nil {
+		t.Fatalf("expected position to be valid, got %s", err)
+	}
+	if err := capabilities.ValidateAbsolute(&AbsoluteHigh{
+		Azimuth:      3700,
+		Elevation:    100,
+		AbsoluteZoom: 10,
+	}); err == nil {
+		t.Fatalf("expected azimuth to be out of range")
+	}
+	if err := capabilities.ValidateAbsolute(&AbsoluteHigh{
+		Azimuth:      1800,
+		Elevation:    100,
+		AbsoluteZoom: 5,
+	}); err == nil {
+		t.Fatalf("expected zoom to be out of range")
+	}
+}
+
+func TestCapabilities_Unmarshal(t *testing.T) {
+	payload := `<?xml version="1.0" encoding="UTF-8"?>
+<PTZChanelCap version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<AbsolutePanTiltPositionSpace>
+<XRange><Min>0</Min><Max>3600</Max></XRange>
+<YRange><Min>-900</Min><Max>2700</Max></YRange>
+</AbsolutePanTiltPositionSpace>
+<AbsoluteZoomPositionSpace>
+<ZRange><Min>10</Min><Max>250</Max></ZRange>
+</AbsoluteZoomPositionSpace>
+<ContinuousPanTiltSpace>
+<XRange><Min>-100</Min><Max>100</Max></XRange>
+<YRange><Min>-100</Min><Max>100</Max></YRange>
+</ContinuousPanTiltSpace>
+<maxPresetNum>300</maxPresetNum>
+</PTZChanelCap>`
+	var capabilities PTZChannelCapabilities
+	if err := xml.Unmarshal([]byte(payload), &capabilities); err != nil {
+		t.Fatal(err)
+	}
+	if r := capabilities.AbsolutePanTiltPositionSpace.XRange; r.Min != 0 || r.Max != 3600 {
+		t.Errorf("expected the azimuth range to be read, got %+v", r)
+	}
+	if r := capabilities.AbsoluteZoomPositionSpace.ZRange; r.Min != 10 || r.Max != 250 {
+		t.Errorf("expected the zoom range to be read, got %+v", r)
+	}
+	if err := capabilities.ValidateAbsolute(&AbsoluteHigh{
+		Azimuth:      1800,
+		Elevation:    -450,
+		AbsoluteZoom: 40,
+	}); err != nil {
+		t.Errorf("expected position to be valid, got %s", err)
+	}
+	if err := capabilities.ValidateAbsolute(&AbsoluteHigh{
+		Azimuth:      1800,
+		Elevation:    100,
+		AbsoluteZoom: 300,
+	}); err == nil {
+		t.Errorf("expected zoom to be out of range")
+	}
+}
+
+func TestMove3D_RelativeZoomBox(t *testing.T) {
+	req := &PTZCtrlRelativeRequest{
+		Relative: Relative{PositionX: 0, PositionY: 0, RelativeZoom: 0.5},
+		Frame:    FrameSpecs{Width: 640, Height: 480},
+	}
+	zoomIn := req.toMove3D()
+	if zoomIn.StartPoint.PositionX >= zoomIn.EndPoint.PositionX ||
+		zoomIn.StartPoint.PositionY >= zoomIn.EndPoint.PositionY {
+		t.Fatalf("zoom in box must go from top-left to bottom-right, got %+v", zoomIn)
+	}
+	if sum := zoomIn.StartPoint.PositionX + zoomIn.EndPoint.PositionX; sum < 254 || sum > 256 {
+		t.Fatalf("zoom box must be centered on the target, got %+v", zoomIn)
+	}
+
+	req.Relative.RelativeZoom = -0.5
+	zoomOut := req.toMove3D()
+	if zoomOut.StartPoint.PositionX <= zoomOut.EndPoint.PositionX ||
+		zoomOut.StartPoint.PositionY <= zoomOut.EndPoint.PositionY {
+		t.Fatalf("zoom out box must go from bottom-right to top-left, got %+v", zoomOut)
+	}
+
+	req.Relative.RelativeZoom = 0
+	move := req.toMove3D()
+	if move.StartPoint != move.EndPoint {
+		t.Fatalf("move without zoom must be a single point, got %+v", move)
+	}
+}
+
+func TestPTZTrackStatus_Moving(t *testing.T) {
+	cases := map[string]bool{
+		PTZTrackStatusNormal:     false,
+		PTZTrackStatusFollowMove: true,
+	}
+	for state, moving := range cases {
+		body := fmt.Sprintf(`<PTZTrackStatus version="2.0" xmlns="http://www.isapi.org/ver20/XMLSchema"><trackStatus>%s</trackStatus></PTZTrackStatus>`, state)
+		var status PTZTrackStatus
+		if err := xml.Unmarshal([]byte(body), &status); err != nil {
+			t.Fatalf("failed to parse track status: %v", err)
+		}
+		if status.Moving() != moving {
+			t.Errorf("expected %s to report moving %v", state, moving)
+		}
+	}
+}
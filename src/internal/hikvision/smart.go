@@ -11,6 +11,12 @@ import (
 
 type SmartApiInterface interface {
 	Capabilities(ctx context.Context) (*SmartCapabilitiesResponse, error)
+	MotionDetection(ctx context.Context, channelId string) (*MotionDetection, error)
+	SetMotionDetection(ctx context.Context, channelId string, patch *MotionDetectionPatch) error
+	LineDetection(ctx context.Context, channelId string) (*LineDetection, error)
+	SetLineDetection(ctx context.Context, channelId string, req *LineDetection) error
+	FieldDetection(ctx context.Context, channelId string) (*FieldDetection, error)
+	SetFieldDetection(ctx context.Context, channelId string, req *FieldDetection) error
 }
 
 type smartApiClient struct {
@@ -43,6 +49,7 @@ func (c *smartApiClient) Capabilities(ctx context.Context) (*SmartCapabilitiesRe
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
@@ -0,0 +1,318 @@
+package hikvision
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
+)
+
+// NormalizedPoint follows the ONVIF convention, x is [-1, 1] (left, right)
+// and y is [-1, 1] (down, up)
+type NormalizedPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// NormalizedScreenSize is the screen regions and overlays are drawn on,
+// with the origin at the bottom-left
+type NormalizedScreenSize struct {
+	Width  int `xml:"normalizedScreenWidth"`
+	Height int `xml:"normalizedScreenHeight"`
+}
+
+// detection regions are always drawn on a 1000x1000 screen
+var detectionScreenSize = NormalizedScreenSize{Width: 1000, Height: 1000}
+
+func (s NormalizedScreenSize) Coordinates(p NormalizedPoint) RegionCoordinates {
+	scale := func(v float64, size int) int {
+		v = math.Max(-1, math.Min(1, v))
+		return int(math.Round((v + 1) / 2 * float64(size)))
+	}
+	return RegionCoordinates{
+		PositionX: scale(p.X, s.Width),
+		PositionY: scale(p.Y, s.Height),
+	}
+}
+
+func (s NormalizedScreenSize) Normalized(c RegionCoordinates) NormalizedPoint {
+	scale := func(v int, size int) float64 {
+		return float64(v)/float64(size)*2 - 1
+	}
+	return NormalizedPoint{
+		X: scale(c.PositionX, s.Width),
+		Y: scale(c.PositionY, s.Height),
+	}
+}
+
+func (p NormalizedPoint) toRegionCoordinates() RegionCoordinates {
+	return detectionScreenSize.Coordinates(p)
+}
+
+func (c RegionCoordinates) Normalized() NormalizedPoint {
+	return detectionScreenSize.Normalized(c)
+}
+
+func RegionOf(points []NormalizedPoint) []RegionCoordinates {
+	region := make([]RegionCoordinates, 0, len(points))
+	for _, point := range points {
+		region = append(region, point.toRegionCoordinates())
+	}
+	return region
+}
+
+func NormalizedOf(region []RegionCoordinates) []NormalizedPoint {
+	points := make([]NormalizedPoint, 0, len(region))
+	for _, coordinates := range region {
+		points = append(points, coordinates.Normalized())
+	}
+	return points
+}
+
+type MotionDetection struct {
+	XMLName    xml.Name               `xml:"MotionDetection"`
+	Enabled    bool                   `xml:"enabled"`
+	RegionType string                 `xml:"regionType,omitempty"`
+	Grid       *MotionDetectionGrid   `xml:"Grid,omitempty"`
+	Layout     *MotionDetectionLayout `xml:"MotionDetectionLayout,omitempty"`
+}
+
+type MotionDetectionGrid struct {
+	RowGranularity    int `xml:"rowGranularity"`
+	ColumnGranularity int `xml:"columnGranularity"`
+}
+
+type MotionDetectionLayout struct {
+	SensitivityLevel int    `xml:"sensitivityLevel"`
+	GridMap          string `xml:"layout>gridMap"`
+}
+
+// Cells decodes the grid map, each row is a bitmap padded to whole bytes
+func (m *MotionDetection) Cells() ([][]bool, error) {
+	if m.Grid == nil || m.Layout == nil {
+		return nil, nil
+	}
+	gridMap, err := hex.DecodeString(m.Layout.GridMap)
+	if err != nil {
+		return nil, custerror.FormatInvalidArgument("malformed motion grid map: %s", err)
+	}
+	rowBytes := (m.Grid.ColumnGranularity + 7) / 8
+	cells := make([][]bool, m.Grid.RowGranularity)
+	for row := range cells {
+		cells[row] = make([]bool, m.Grid.ColumnGranularity)
+		for col := range cells[row] {
+			i := row*rowBytes + col/8
+			if i < len(gridMap) {
+				cells[row][col] = gridMap[i]&(0x80>>(col%8)) != 0
+			}
+		}
+	}
+	return cells, nil
+}
+
+// GridMapOf encodes the cells into a grid map of the given granularity
+func GridMapOf(grid *MotionDetectionGrid, cells [][]bool) (string, error) {
+	if len(cells) != grid.RowGranularity {
+		return "", custerror.FormatInvalidArgument("motion grid must have %d rows, got %d", grid.RowGranularity, len(cells))
+	}
+	rowBytes := (grid.ColumnGranularity + 7) / 8
+	gridMap := make([]byte, grid.RowGranularity*rowBytes)
+	for row, cols := range cells {
+		if len(cols) != grid.ColumnGranularity {
+			return "", custerror.FormatInvalidArgument("motion grid must have %d columns, got %d in row %d", grid.ColumnGranularity, len(cols), row)
+		}
+		for col, on := range cols {
+			if on {
+				gridMap[row*rowBytes+col/8] |= 0x80 >> (col % 8)
+			}
+		}
+	}
+	return hex.EncodeToString(gridMap), nil
+}
+
+type MotionDetectionPatch struct {
+	Enabled          *bool
+	SensitivityLevel *int
+	GridMap          *string
+}
+
+func (p *MotionDetectionPatch) apply(node *xmlNode) error {
+	node.setBool("enabled", p.Enabled)
+	node.setInt("MotionDetectionLayout/sensitivityLevel", p.SensitivityLevel)
+	if p.GridMap != nil {
+		regionType := "grid"
+		node.setString("regionType", &regionType)
+		node.setString("MotionDetectionLayout/layout/gridMap", p.GridMap)
+	}
+	return nil
+}
+
+type LineDetection struct {
+	XMLName  xml.Name    `xml:"LineDetection"`
+	ID       string      `xml:"id,omitempty"`
+	Enabled  bool        `xml:"enabled"`
+	LineItem []*LineItem `xml:"LineItemList>LineItem"`
+}
+
+type LineItem struct {
+	ID               int  `xml:"id"`
+	Enabled          bool `xml:"enabled"`
+	SensitivityLevel int  `xml:"sensitivityLevel"`
+	// DirectionSensitivity is any, left-right or right-left
+	DirectionSensitivity string              `xml:"directionSensitivity"`
+	Coordinates          []RegionCoordinates `xml:"CoordinatesList>Coordinates"`
+}
+
+type lineItemList struct {
+	XMLName  xml.Name    `xml:"LineItemList"`
+	LineItem []*LineItem `xml:"LineItem"`
+}
+
+type FieldDetection struct {
+	XMLName xml.Name                `xml:"FieldDetection"`
+	ID      string                  `xml:"id,omitempty"`
+	Enabled bool                    `xml:"enabled"`
+	Regions []*FieldDetectionRegion `xml:"FieldDetectionRegionList>FieldDetectionRegion"`
+}
+
+type FieldDetectionRegion struct {
+	ID               int  `xml:"id"`
+	Enabled          bool `xml:"enabled"`
+	SensitivityLevel int  `xml:"sensitivityLevel"`
+	// TimeThreshold is how long in seconds a target stays in the region before alerting
+	TimeThreshold     int                 `xml:"timeThreshold"`
+	RegionCoordinates []RegionCoordinates `xml:"RegionCoordinatesList>RegionCoordinates"`
+}
+
+type fieldDetectionRegionList struct {
+	XMLName xml.Name                `xml:"FieldDetectionRegionList"`
+	Regions []*FieldDetectionRegion `xml:"FieldDetectionRegion"`
+}
+
+func (c *smartApiClient) getMotionDetectionUrl(channelId string) string {
+	return fmt.Sprintf("%s/System/Video/inputs/channels/%s/motionDetection", c.ip, channelId)
+}
+
+func (c *smartApiClient) MotionDetection(ctx context.Context, channelId string) (*MotionDetection, error) {
+	p, _ := url.Parse(c.getMotionDetectionUrl(channelId))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp MotionDetection
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+// SetMotionDetection changes the motion detection settings,
+// settings missing from the patch are preserved
+func (c *smartApiClient) SetMotionDetection(ctx context.Context, channelId string, patch *MotionDetectionPatch) error {
+	p, _ := url.Parse(c.getMotionDetectionUrl(channelId))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, patch.apply)
+}
+
+func (c *smartApiClient) LineDetection(ctx context.Context, channelId string) (*LineDetection, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/LineDetection/%s", c.getBaseUrl(), channelId))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp LineDetection
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+// SetLineDetection replaces the detection lines of the channel,
+// other line detection settings are preserved
+func (c *smartApiClient) SetLineDetection(ctx context.Context, channelId string, req *LineDetection) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/LineDetection/%s", c.getBaseUrl(), channelId))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, func(node *xmlNode) error {
+		node.set("enabled", strconv.FormatBool(req.Enabled))
+		return node.replace(&lineItemList{LineItem: req.LineItem})
+	})
+}
+
+func (c *smartApiClient) FieldDetection(ctx context.Context, channelId string) (*FieldDetection, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/FieldDetection/%s", c.getBaseUrl(), channelId))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp FieldDetection
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+// SetFieldDetection replaces the intrusion regions of the channel,
+// other intrusion detection settings are preserved
+func (c *smartApiClient) SetFieldDetection(ctx context.Context, channelId string, req *FieldDetection) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/FieldDetection/%s", c.getBaseUrl(), channelId))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, func(node *xmlNode) error {
+		node.set("enabled", strconv.FormatBool(req.Enabled))
+		return node.replace(&fieldDetectionRegionList{Regions: req.Regions})
+	})
+}
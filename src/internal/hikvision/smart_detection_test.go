@@ -0,0 +1,57 @@
+package hikvision
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizedPoint_RegionCoordinates(t *testing.T) {
+	tests := []struct {
+		point NormalizedPoint
+		want  RegionCoordinates
+	}{
+		{NormalizedPoint{X: -1, Y: -1}, RegionCoordinates{PositionX: 0, PositionY: 0}},
+		{NormalizedPoint{X: 0, Y: 0}, RegionCoordinates{PositionX: 500, PositionY: 500}},
+		{NormalizedPoint{X: 1, Y: 0.5}, RegionCoordinates{PositionX: 1000, PositionY: 750}},
+		{NormalizedPoint{X: 2, Y: -3}, RegionCoordinates{PositionX: 1000, PositionY: 0}},
+	}
+	for _, tt := range tests {
+		got := tt.point.toRegionCoordinates()
+		if got != tt.want {
+			t.Errorf("converting %+v, expected %+v, got %+v", tt.point, tt.want, got)
+		}
+	}
+	if got := (RegionCoordinates{PositionX: 250, PositionY: 1000}).Normalized(); got != (NormalizedPoint{X: -0.5, Y: 1}) {
+		t.Errorf("expected (-0.5, 1), got %+v", got)
+	}
+}
+
+func TestMotionDetection_GridMap(t *testing.T) {
+	grid := &MotionDetectionGrid{RowGranularity: 2, ColumnGranularity: 10}
+	cells := [][]bool{
+		{true, false, false, false, false, false, false, false, true, false},
+		{false, false, false, false, false, false, false, false, false, true},
+	}
+	gridMap, err := GridMapOf(grid, cells)
+	if err != nil {
+		t.Fatalf("unable to encode grid: %v", err)
+	}
+	if gridMap != "80800040" {
+		t.Fatalf("expected 80800040, got %s", gridMap)
+	}
+
+	decoded, err := (&MotionDetection{
+		Grid:   grid,
+		Layout: &MotionDetectionLayout{GridMap: gridMap},
+	}).Cells()
+	if err != nil {
+		t.Fatalf("unable to decode grid: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, cells) {
+		t.Errorf("expected %v, got %v", cells, decoded)
+	}
+
+	if _, err := GridMapOf(grid, cells[:1]); err == nil {
+		t.Errorf("expected an error for a grid with missing rows")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 
@@ -13,6 +14,9 @@ import (
 type StreamsApiInterface interface {
 	Channels(ctx context.Context, req *StreamChannelsRequest) (*StreamingChannelList, error)
 	Status(ctx context.Context, req *StreamingStatusRequest) (*StreamingStatusResponse, error)
+	Snapshot(ctx context.Context, channelId string, width int, height int) ([]byte, error)
+	Channel(ctx context.Context, channelId string) (*StreamingChannel, error)
+	UpdateChannel(ctx context.Context, channelId string, patch *StreamingChannelPatch) error
 }
 
 type streamApiClient struct {
@@ -23,7 +27,7 @@ type streamApiClient struct {
 }
 
 func (c *streamApiClient) getBaseUrl() string {
-	return c.ip + "/Stream"
+	return c.ip + "/Streaming"
 }
 
 type StreamChannelsRequest struct {
@@ -56,6 +60,7 @@ func (c *streamApiClient) Channels(ctx context.Context, req *StreamChannelsReque
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
@@ -69,6 +74,78 @@ func (c *streamApiClient) Channels(ctx context.Context, req *StreamChannelsReque
 	return &parsedResp, nil
 }
 
+func (c *streamApiClient) Channel(ctx context.Context, channelId string) (*StreamingChannel, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/channels/%s", c.getBaseUrl(), channelId))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp StreamingChannel
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+// StreamingChannelPatch lists the encoding settings to change,
+// nil fields are left as configured on the camera
+type StreamingChannelPatch struct {
+	Enabled        *bool   `json:"enabled,omitempty"`
+	VideoCodecType *string `json:"videoCodecType,omitempty"`
+	Width          *int    `json:"width,omitempty"`
+	Height         *int    `json:"height,omitempty"`
+	// BitrateControl is either CBR or VBR
+	BitrateControl *string `json:"bitrateControl,omitempty"`
+	// ConstantBitRate and VBRUpperCap are in kbps
+	ConstantBitRate *int `json:"constantBitRate,omitempty"`
+	VBRUpperCap     *int `json:"vbrUpperCap,omitempty"`
+	// MaxFrameRate is in hundredths of a frame per second, 2500 is 25 fps
+	MaxFrameRate *int    `json:"maxFrameRate,omitempty"`
+	GovLength    *int    `json:"govLength,omitempty"`
+	H264Profile  *string `json:"h264Profile,omitempty"`
+	SmartCodec   *bool   `json:"smartCodec,omitempty"`
+}
+
+func (p *StreamingChannelPatch) apply(node *xmlNode) error {
+	node.setBool("enabled", p.Enabled)
+	node.setString("Video/videoCodecType", p.VideoCodecType)
+	node.setInt("Video/videoResolutionWidth", p.Width)
+	node.setInt("Video/videoResolutionHeight", p.Height)
+	node.setString("Video/videoQualityControlType", p.BitrateControl)
+	node.setInt("Video/constantBitRate", p.ConstantBitRate)
+	node.setInt("Video/vbrUpperCap", p.VBRUpperCap)
+	node.setInt("Video/maxFrameRate", p.MaxFrameRate)
+	node.setInt("Video/GovLength", p.GovLength)
+	node.setString("Video/H264Profile", p.H264Profile)
+	node.setBool("Video/SmartCodec/enabled", p.SmartCodec)
+	return nil
+}
+
+// UpdateChannel changes the encoding settings of the streaming channel,
+// settings missing from the patch are preserved
+func (c *streamApiClient) UpdateChannel(ctx context.Context, channelId string, patch *StreamingChannelPatch) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/channels/%s", c.getBaseUrl(), channelId))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, patch.apply)
+}
+
 func (c *streamApiClient) Status(ctx context.Context, req *StreamingStatusRequest) (*StreamingStatusResponse, error) {
 	p, _ := url.Parse(fmt.Sprintf("%s/status", c.getBaseUrl()))
 
@@ -86,6 +163,7 @@ func (c *streamApiClient) Status(ctx context.Context, req *StreamingStatusReques
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
@@ -99,6 +177,40 @@ func (c *streamApiClient) Status(ctx context.Context, req *StreamingStatusReques
 	return &parsedResp, nil
 }
 
+// Snapshot captures a JPEG picture from the streaming channel,
+// zero width and height keep the resolution of the channel
+func (c *streamApiClient) Snapshot(ctx context.Context, channelId string, width int, height int) ([]byte, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/channels/%s/picture", c.getBaseUrl(), channelId))
+	if width > 0 && height > 0 {
+		q := p.Query()
+		q.Add("videoResolutionWidth", fmt.Sprintf("%d", width))
+		q.Add("videoResolutionHeight", fmt.Sprintf("%d", height))
+		p.RawQuery = q.Encode()
+	}
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
 type StreamingStatusRequest struct {
 }
 
@@ -0,0 +1,45 @@
+package hikvision
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+)
+
+func TestStreams_Snapshot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ISAPI/Streaming/channels/101/picture" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("videoResolutionWidth") != "640" || query.Get("videoResolutionHeight") != "360" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg"))
+	}))
+	defer server.Close()
+
+	c := &streamApiClient{
+		httpClient: server.Client(),
+		ip:         server.URL + "/ISAPI",
+	}
+	picture, err := c.Snapshot(context.Background(), "101", 640, 360)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(picture) != "jpeg" {
+		t.Errorf("expected the picture body, got %q", picture)
+	}
+
+	_, err = c.Snapshot(context.Background(), "201", 640, 360)
+	if !errors.Is(err, custerror.ErrorNotFound) {
+		t.Errorf("expected a missing channel to be not found, got %v", err)
+	}
+}
@@ -16,6 +16,16 @@ type SystemApiInterface interface {
 	DeviceInfo(ctx context.Context) (*SystemDeviceInfoResponse, error)
 	Hardware(ctx context.Context) (*SystemHardwareResponse, error)
 	Status(ctx context.Context) (*SystemStatus, error)
+	Reboot(ctx context.Context) error
+	Time(ctx context.Context) (*SystemTime, error)
+	SetTime(ctx context.Context, req *SystemTime) error
+	NTPServers(ctx context.Context) (*NTPServerList, error)
+	SetNTPServer(ctx context.Context, req *NTPServer) error
+	PrivacyMask(ctx context.Context, channelId string) (*PrivacyMask, error)
+	SetPrivacyMask(ctx context.Context, channelId string, req *PrivacyMask) error
+	Overlays(ctx context.Context, channelId string) (*VideoOverlay, error)
+	SetOverlays(ctx context.Context, channelId string, patch *VideoOverlayPatch) error
+	SetChannelName(ctx context.Context, channelId string, name string) error
 }
 
 type systemApiClient struct {
@@ -49,6 +59,7 @@ func (c *systemApiClient) Capabilities(ctx context.Context) (*SystemCapabilities
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
@@ -79,6 +90,7 @@ func (c *systemApiClient) DeviceInfo(ctx context.Context) (*SystemDeviceInfoResp
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
@@ -111,6 +123,7 @@ func (c *systemApiClient) Hardware(ctx context.Context) (*SystemHardwareResponse
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
@@ -140,6 +153,7 @@ func (c *systemApiClient) Status(ctx context.Context) (*SystemStatus, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer closeResponse(resp)
 
 	if err := handleError(resp); err != nil {
 		return nil, err
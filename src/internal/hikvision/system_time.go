@@ -0,0 +1,265 @@
+package hikvision
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	TimeModeManual = "manual"
+	TimeModeNTP    = "NTP"
+)
+
+const (
+	AddressingFormatHostname  = "hostname"
+	AddressingFormatIpAddress = "ipaddress"
+)
+
+// devices report their local time with or without the UTC offset
+var systemTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+}
+
+type SystemTime struct {
+	XMLName   xml.Name `xml:"Time" json:"-"`
+	Version   string   `xml:"version,attr,omitempty" json:"-"`
+	XMLNS     string   `xml:"xmlns,attr,omitempty" json:"-"`
+	TimeMode  string   `xml:"timeMode" json:"timeMode"`
+	LocalTime string   `xml:"localTime,omitempty" json:"localTime,omitempty"`
+	TimeZone  string   `xml:"timeZone,omitempty" json:"timeZone,omitempty"`
+}
+
+// timeZonePattern matches the standard part of a POSIX time zone as devices report it,
+// e.g. CST-7:00:00, the daylight saving rules following it are not applied
+var timeZonePattern = regexp.MustCompile(`^([A-Za-z]+|<[^>]+>)([+-]?)(\d{1,2})(?::(\d{1,2}))?(?::(\d{1,2}))?`)
+
+// Location returns the time zone of the device, UTC when the device does not report one.
+// The POSIX offset is west of UTC, so CST-7:00:00 is UTC+7
+func (t *SystemTime) Location() (*time.Location, error) {
+	if t.TimeZone == "" {
+		return time.UTC, nil
+	}
+	match := timeZonePattern.FindStringSubmatch(t.TimeZone)
+	if match == nil {
+		return nil, custerror.FormatInvalidArgument("unknown time zone %q", t.TimeZone)
+	}
+	offset := 0
+	for i, unit := range []int{3600, 60, 1} {
+		if match[3+i] == "" {
+			continue
+		}
+		value, _ := strconv.Atoi(match[3+i])
+		offset += value * unit
+	}
+	if match[2] != "-" {
+		offset = -offset
+	}
+	return time.FixedZone(match[1], offset), nil
+}
+
+// Format sets the local time to now in the time zone of the device
+func (t *SystemTime) Format(now time.Time) error {
+	loc, err := t.Location()
+	if err != nil {
+		return err
+	}
+	t.LocalTime = now.In(loc).Format(time.RFC3339)
+	return nil
+}
+
+// Parse returns the device local time, a missing offset is read in the time zone of the device
+func (t *SystemTime) Parse() (time.Time, error) {
+	loc, err := t.Location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, layout := range systemTimeLayouts {
+		var parsed time.Time
+		parsed, err = time.ParseInLocation(layout, t.LocalTime, loc)
+		if err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+type NTPServerList struct {
+	XMLName    xml.Name     `xml:"NTPServerList" json:"-"`
+	Version    string       `xml:"version,attr,omitempty" json:"-"`
+	NTPServers []*NTPServer `xml:"NTPServer" json:"ntpServers"`
+}
+
+type NTPServer struct {
+	XMLName              xml.Name `xml:"NTPServer" json:"-"`
+	Version              string   `xml:"version,attr,omitempty" json:"-"`
+	XMLNS                string   `xml:"xmlns,attr,omitempty" json:"-"`
+	ID                   string   `xml:"id" json:"id"`
+	AddressingFormatType string   `xml:"addressingFormatType" json:"addressingFormatType"`
+	HostName             string   `xml:"hostName,omitempty" json:"hostName,omitempty"`
+	IpAddress            string   `xml:"ipAddress,omitempty" json:"ipAddress,omitempty"`
+	PortNo               int      `xml:"portNo,omitempty" json:"portNo,omitempty"`
+	SynchronizeInterval  int      `xml:"synchronizeInterval,omitempty" json:"synchronizeInterval,omitempty"`
+}
+
+func (c *systemApiClient) Reboot(ctx context.Context) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/reboot", c.getBaseUrl()))
+	logger.SInfo("system reboot request",
+		zap.String("url", p.String()))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *systemApiClient) Time(ctx context.Context) (*SystemTime, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/time", c.getBaseUrl()))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp SystemTime
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+func (c *systemApiClient) SetTime(ctx context.Context, req *SystemTime) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/time", c.getBaseUrl()))
+	logger.SDebug("system set time request",
+		zap.String("url", p.String()),
+		zap.String("timeMode", req.TimeMode))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(c.username, c.password),
+		custhttp.WithContentType("application/xml"),
+		custhttp.WithXMLBody(req),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *systemApiClient) NTPServers(ctx context.Context) (*NTPServerList, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/time/ntpServers", c.getBaseUrl()))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp NTPServerList
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+func (c *systemApiClient) SetNTPServer(ctx context.Context, req *NTPServer) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/time/ntpServers/%s", c.getBaseUrl(), req.ID))
+	logger.SDebug("system set NTP server request",
+		zap.String("url", p.String()))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(c.username, c.password),
+		custhttp.WithContentType("application/xml"),
+		custhttp.WithXMLBody(req),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
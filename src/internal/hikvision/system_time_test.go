@@ -0,0 +1,78 @@
+package hikvision
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSystemTime_Parse(t *testing.T) {
+	tests := []struct {
+		localTime string
+		timeZone  string
+		want      time.Time
+	}{
+		{"2024-05-01T10:00:00+07:00", "", time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)},
+		{"2024-05-01T10:00:00", "", time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{"2024-05-01T10:00:00", "CST-7:00:00", time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)},
+		{"2024-05-01T10:00:00+07:00", "CST+5:00:00", time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := (&SystemTime{LocalTime: tt.localTime, TimeZone: tt.timeZone}).Parse()
+		if err != nil {
+			t.Fatalf("unable to parse %q: %v", tt.localTime, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parsing %q, expected %v, got %v", tt.localTime, tt.want, got)
+		}
+	}
+
+	if _, err := (&SystemTime{LocalTime: "yesterday"}).Parse(); err == nil {
+		t.Errorf("expected an error for a malformed time")
+	}
+}
+
+func TestSystemTime_Location(t *testing.T) {
+	tests := []struct {
+		timeZone string
+		offset   int
+	}{
+		{"", 0},
+		{"CST-7:00:00", 7 * 3600},
+		{"CST-8", 8 * 3600},
+		{"IST-5:30:00", 5*3600 + 30*60},
+		{"EST+5:00:00", -5 * 3600},
+		{"EST5:00:00EDT,M3.2.0,M11.1.0", -5 * 3600},
+		{"<+07>-7", 7 * 3600},
+	}
+	for _, tt := range tests {
+		loc, err := (&SystemTime{TimeZone: tt.timeZone}).Location()
+		if err != nil {
+			t.Fatalf("unable to read time zone %q: %v", tt.timeZone, err)
+		}
+		if _, offset := time.Date(2024, 1, 1, 0, 0, 0, 0, loc).Zone(); offset != tt.offset {
+			t.Errorf("time zone %q, expected offset %d, got %d", tt.timeZone, tt.offset, offset)
+		}
+	}
+
+	if _, err := (&SystemTime{TimeZone: "+7"}).Location(); err == nil {
+		t.Errorf("expected an error for a malformed time zone")
+	}
+}
+
+func TestSystemTime_Format(t *testing.T) {
+	now := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	st := &SystemTime{TimeZone: "CST-7:00:00"}
+	if err := st.Format(now); err != nil {
+		t.Fatal(err)
+	}
+	if st.LocalTime != "2024-05-01T10:00:00+07:00" {
+		t.Errorf("expected the local time of the device, got %q", st.LocalTime)
+	}
+	parsed, err := st.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.Equal(now) {
+		t.Errorf("expected %v back, got %v", now, parsed)
+	}
+}
@@ -0,0 +1,206 @@
+package hikvision
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
+)
+
+// overlays and privacy masks are drawn on a 704x576 screen unless the device says otherwise
+var defaultVideoScreenSize = NormalizedScreenSize{Width: 704, Height: 576}
+
+func screenSizeOrDefault(size *NormalizedScreenSize) NormalizedScreenSize {
+	if size == nil || size.Width == 0 || size.Height == 0 {
+		return defaultVideoScreenSize
+	}
+	return *size
+}
+
+type PrivacyMask struct {
+	XMLName    xml.Name              `xml:"PrivacyMask"`
+	Enabled    bool                  `xml:"enabled"`
+	ScreenSize *NormalizedScreenSize `xml:"normalizedScreenSize,omitempty"`
+	Regions    []*PrivacyMaskRegion  `xml:"PrivacyMaskRegionList>PrivacyMaskRegion"`
+}
+
+func (m *PrivacyMask) NormalizedScreenSize() NormalizedScreenSize {
+	return screenSizeOrDefault(m.ScreenSize)
+}
+
+type PrivacyMaskRegion struct {
+	ID                int                 `xml:"id"`
+	Enabled           bool                `xml:"enabled"`
+	RegionCoordinates []RegionCoordinates `xml:"RegionCoordinatesList>RegionCoordinates"`
+}
+
+type privacyMaskRegionList struct {
+	XMLName xml.Name             `xml:"PrivacyMaskRegionList"`
+	Regions []*PrivacyMaskRegion `xml:"PrivacyMaskRegion"`
+}
+
+type VideoOverlay struct {
+	XMLName            xml.Name              `xml:"VideoOverlay"`
+	ScreenSize         *NormalizedScreenSize `xml:"normalizedScreenSize,omitempty"`
+	TextOverlays       []*TextOverlay        `xml:"TextOverlayList>TextOverlay"`
+	DateTimeOverlay    *DateTimeOverlay      `xml:"DateTimeOverlay,omitempty"`
+	ChannelNameOverlay *ChannelNameOverlay   `xml:"channelNameOverlay,omitempty"`
+}
+
+func (o *VideoOverlay) NormalizedScreenSize() NormalizedScreenSize {
+	return screenSizeOrDefault(o.ScreenSize)
+}
+
+type TextOverlay struct {
+	ID          int    `xml:"id"`
+	Enabled     bool   `xml:"enabled"`
+	PositionX   int    `xml:"positionX"`
+	PositionY   int    `xml:"positionY"`
+	DisplayText string `xml:"displayText"`
+}
+
+type textOverlayList struct {
+	XMLName      xml.Name       `xml:"TextOverlayList"`
+	TextOverlays []*TextOverlay `xml:"TextOverlay"`
+}
+
+type DateTimeOverlay struct {
+	Enabled     bool   `xml:"enabled"`
+	PositionX   int    `xml:"positionX"`
+	PositionY   int    `xml:"positionY"`
+	DateStyle   string `xml:"dateStyle,omitempty"`
+	TimeStyle   string `xml:"timeStyle,omitempty"`
+	DisplayWeek bool   `xml:"displayWeek"`
+}
+
+type ChannelNameOverlay struct {
+	Enabled   bool `xml:"enabled"`
+	PositionX int  `xml:"positionX"`
+	PositionY int  `xml:"positionY"`
+}
+
+type PositionOverlayPatch struct {
+	Enabled  *bool
+	Position *RegionCoordinates
+}
+
+func (p *PositionOverlayPatch) apply(node *xmlNode, element string) {
+	if p == nil {
+		return
+	}
+	node.setBool(element+"/enabled", p.Enabled)
+	if p.Position != nil {
+		node.set(element+"/positionX", strconv.Itoa(p.Position.PositionX))
+		node.set(element+"/positionY", strconv.Itoa(p.Position.PositionY))
+	}
+}
+
+// VideoOverlayPatch lists the overlays to change, nil overlays are left as configured,
+// the text overlays are replaced as a whole when not nil
+type VideoOverlayPatch struct {
+	ChannelName  *PositionOverlayPatch
+	DateTime     *PositionOverlayPatch
+	TextOverlays []*TextOverlay
+}
+
+func (p *VideoOverlayPatch) apply(node *xmlNode) error {
+	p.ChannelName.apply(node, "channelNameOverlay")
+	p.DateTime.apply(node, "DateTimeOverlay")
+	if p.TextOverlays != nil {
+		return node.replace(&textOverlayList{TextOverlays: p.TextOverlays})
+	}
+	return nil
+}
+
+func (c *systemApiClient) getVideoInputUrl(channelId string) string {
+	return fmt.Sprintf("%s/Video/inputs/channels/%s", c.getBaseUrl(), channelId)
+}
+
+func (c *systemApiClient) PrivacyMask(ctx context.Context, channelId string) (*PrivacyMask, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/privacyMask", c.getVideoInputUrl(channelId)))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp PrivacyMask
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+// SetPrivacyMask replaces the privacy mask regions of the channel
+func (c *systemApiClient) SetPrivacyMask(ctx context.Context, channelId string, req *PrivacyMask) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/privacyMask", c.getVideoInputUrl(channelId)))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, func(node *xmlNode) error {
+		node.set("enabled", strconv.FormatBool(req.Enabled))
+		return node.replace(&privacyMaskRegionList{Regions: req.Regions})
+	})
+}
+
+func (c *systemApiClient) Overlays(ctx context.Context, channelId string) (*VideoOverlay, error) {
+	p, _ := url.Parse(fmt.Sprintf("%s/overlays", c.getVideoInputUrl(channelId)))
+
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(c.username, c.password),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return nil, err
+	}
+
+	var parsedResp VideoOverlay
+	if err := custhttp.XMLResponse(resp, &parsedResp); err != nil {
+		return nil, err
+	}
+
+	return &parsedResp, nil
+}
+
+func (c *systemApiClient) SetOverlays(ctx context.Context, channelId string, patch *VideoOverlayPatch) error {
+	p, _ := url.Parse(fmt.Sprintf("%s/overlays", c.getVideoInputUrl(channelId)))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, patch.apply)
+}
+
+// SetChannelName renames the video input channel, the name is what the channel name overlay shows
+func (c *systemApiClient) SetChannelName(ctx context.Context, channelId string, name string) error {
+	p, _ := url.Parse(c.getVideoInputUrl(channelId))
+	return readModifyWrite(ctx, c.httpClient, p, c.username, c.password, func(node *xmlNode) error {
+		node.set("name", name)
+		return nil
+	})
+}
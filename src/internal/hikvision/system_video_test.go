@@ -0,0 +1,58 @@
+package hikvision
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+const testVideoOverlay = `<VideoOverlay version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<normalizedScreenSize><normalizedScreenWidth>704</normalizedScreenWidth><normalizedScreenHeight>576</normalizedScreenHeight></normalizedScreenSize>
+<attribute><transparent>false</transparent></attribute>
+<TextOverlayList><TextOverlay><id>1</id><enabled>true</enabled><positionX>16</positionX><positionY>32</positionY><displayText>old</displayText></TextOverlay></TextOverlayList>
+<DateTimeOverlay><enabled>true</enabled><positionX>0</positionX><positionY>544</positionY><dateStyle>YYYY-MM-DD</dateStyle></DateTimeOverlay>
+<channelNameOverlay><enabled>false</enabled><positionX>512</positionX><positionY>64</positionY></channelNameOverlay>
+</VideoOverlay>`
+
+func TestVideoOverlayPatch_Apply(t *testing.T) {
+	var node xmlNode
+	if err := xml.Unmarshal([]byte(testVideoOverlay), &node); err != nil {
+		t.Fatalf("unable to parse overlay: %v", err)
+	}
+	enabled := true
+	patch := &VideoOverlayPatch{
+		ChannelName: &PositionOverlayPatch{Enabled: &enabled},
+		TextOverlays: []*TextOverlay{
+			{ID: 1, Enabled: true, PositionX: 352, PositionY: 288, DisplayText: "gate"},
+		},
+	}
+	if err := patch.apply(&node); err != nil {
+		t.Fatalf("unable to apply patch: %v", err)
+	}
+	data, err := xml.Marshal(&node)
+	if err != nil {
+		t.Fatalf("unable to marshal overlay: %v", err)
+	}
+
+	var overlay VideoOverlay
+	if err := xml.Unmarshal(data, &overlay); err != nil {
+		t.Fatalf("unable to parse patched overlay: %v", err)
+	}
+	if !overlay.ChannelNameOverlay.Enabled || overlay.ChannelNameOverlay.PositionX != 512 {
+		t.Errorf("expected the channel name overlay enabled in place, got %+v", overlay.ChannelNameOverlay)
+	}
+	if len(overlay.TextOverlays) != 1 || overlay.TextOverlays[0].DisplayText != "gate" {
+		t.Errorf("expected the text overlays to be replaced, got %+v", overlay.TextOverlays)
+	}
+	if overlay.DateTimeOverlay.DateStyle != "YYYY-MM-DD" {
+		t.Errorf("expected the date time overlay to be kept, got %+v", overlay.DateTimeOverlay)
+	}
+	if !strings.Contains(string(data), "<transparent>false</transparent>") {
+		t.Errorf("expected unknown elements to be kept, got %s", data)
+	}
+
+	screen := overlay.NormalizedScreenSize()
+	if got := screen.Normalized(RegionCoordinates{PositionX: 352, PositionY: 288}); got != (NormalizedPoint{}) {
+		t.Errorf("expected the screen center at the origin, got %+v", got)
+	}
+}
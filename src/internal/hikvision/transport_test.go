@@ -0,0 +1,56 @@
+package hikvision
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClient_ReusesConnections(t *testing.T) {
+	var connections int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ResponseStatus version="2.0"><requestURL>` + r.URL.Path + `</requestURL><statusCode>1</statusCode><statusString>OK</statusString><subStatusCode>ok</subStatusCode></ResponseStatus>`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	c, _ := NewClient()
+	credentials := &Credentials{Ip: server.URL, Username: "admin", Password: "secret"}
+	for i := 0; i < 5; i++ {
+		// the body of these requests is never read by the caller
+		if err := c.PtzCtrl(credentials).GotoPreset(context.Background(), &PtzCtrlPresetRequest{
+			ChannelId: "1",
+			PresetId:  2,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := atomic.LoadInt32(&connections); got != 1 {
+		t.Errorf("expected sequential requests to share one connection, opened %d", got)
+	}
+}
+
+func TestClient_Forget(t *testing.T) {
+	c, _ := NewClient()
+	hc := c.(*client)
+	credentials := &Credentials{Ip: "10.0.0.2", Username: "admin", Password: "secret"}
+	before := hc.PtzCtrl(credentials).(*ptzApiClient).httpClient.Transport
+
+	c.Forget(credentials)
+	if len(hc.transports) != 0 {
+		t.Fatalf("expected the transport of the camera to be removed, got %d", len(hc.transports))
+	}
+	if after := hc.PtzCtrl(credentials).(*ptzApiClient).httpClient.Transport; after == before {
+		t.Errorf("expected a new transport once the camera is managed again")
+	}
+}
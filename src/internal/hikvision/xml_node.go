@@ -0,0 +1,172 @@
+package hikvision
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	custhttp "github.com/CE-Thesis-2023/ltd/src/internal/http"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+// xmlNode keeps a whole XML document, including elements that have
+// no typed counterpart, so settings can be written back unchanged
+// except for the elements that were patched
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []*xmlNode `xml:",any"`
+}
+
+func (n *xmlNode) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain xmlNode
+	if err := d.DecodeElement((*plain)(n), &start); err != nil {
+		return err
+	}
+	// the namespace is carried by the xmlns attribute, keeping it on
+	// the name as well would write it twice
+	n.XMLName.Space = ""
+	attrs := n.Attrs[:0]
+	for _, attr := range n.Attrs {
+		if attr.Name.Space == "" {
+			attrs = append(attrs, attr)
+		}
+	}
+	n.Attrs = attrs
+	if len(n.Children) > 0 {
+		n.Content = strings.TrimSpace(n.Content)
+	}
+	return nil
+}
+
+func (n *xmlNode) child(name string) *xmlNode {
+	for _, c := range n.Children {
+		if c.XMLName.Local == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// set writes the value of the element at the slash separated path,
+// creating missing elements
+func (n *xmlNode) set(path string, value string) {
+	node := n
+	for _, name := range strings.Split(path, "/") {
+		next := node.child(name)
+		if next == nil {
+			next = &xmlNode{XMLName: xml.Name{Local: name}}
+			node.Children = append(node.Children, next)
+		}
+		node = next
+	}
+	node.Content = value
+}
+
+// replace swaps the child element with the marshalled value,
+// keeping its position among the other children
+func (n *xmlNode) replace(value interface{}) error {
+	data, err := xml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var replacement xmlNode
+	if err := xml.Unmarshal(data, &replacement); err != nil {
+		return err
+	}
+	for i, c := range n.Children {
+		if c.XMLName.Local == replacement.XMLName.Local {
+			n.Children[i] = &replacement
+			return nil
+		}
+	}
+	n.Children = append(n.Children, &replacement)
+	return nil
+}
+
+func (n *xmlNode) setString(path string, value *string) {
+	if value != nil {
+		n.set(path, *value)
+	}
+}
+
+func (n *xmlNode) setInt(path string, value *int) {
+	if value != nil {
+		n.set(path, strconv.Itoa(*value))
+	}
+}
+
+func (n *xmlNode) setBool(path string, value *bool) {
+	if value != nil {
+		n.set(path, strconv.FormatBool(*value))
+	}
+}
+
+// readModifyWrite reads the settings document at the URL, applies the
+// patch and writes the document back
+func readModifyWrite(
+	ctx context.Context,
+	httpClient *http.Client,
+	p *url.URL,
+	username string,
+	password string,
+	patch func(node *xmlNode) error) error {
+	request, err := custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodGet,
+		custhttp.WithBasicAuth(username, password),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	var node xmlNode
+	if err := custhttp.XMLResponse(resp, &node); err != nil {
+		return err
+	}
+	if err := patch(&node); err != nil {
+		return err
+	}
+	logger.SDebug("writing patched settings",
+		zap.String("url", p.String()))
+
+	request, err = custhttp.NewHttpRequest(
+		ctx,
+		p,
+		http.MethodPut,
+		custhttp.WithBasicAuth(username, password),
+		custhttp.WithContentType("application/xml"),
+		custhttp.WithXMLBody(&node),
+	)
+	if err != nil {
+		return err
+	}
+
+	resp, err = httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer closeResponse(resp)
+
+	if err := handleError(resp); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package hikvision
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testStreamingChannel = `<?xml version="1.0" encoding="UTF-8"?>
+<StreamingChannel version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<id>102</id>
+<channelName>Camera 01</channelName>
+<enabled>true</enabled>
+<Video>
+<videoCodecType>H.264</videoCodecType>
+<videoResolutionWidth>1280</videoResolutionWidth>
+<videoResolutionHeight>720</videoResolutionHeight>
+<vendorSpecific>kept</vendorSpecific>
+</Video>
+</StreamingChannel>`
+
+func TestReadModifyWrite_PreservesUnknownElements(t *testing.T) {
+	var written string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(testStreamingChannel))
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			written = string(body)
+		}
+	}))
+	defer server.Close()
+
+	codec := "H.265"
+	width, height := 640, 360
+	patch := &StreamingChannelPatch{
+		VideoCodecType: &codec,
+		Width:          &width,
+		Height:         &height,
+	}
+	p, _ := url.Parse(server.URL + "/Streaming/channels/102")
+	if err := readModifyWrite(context.Background(), server.Client(), p, "admin", "secret", patch.apply); err != nil {
+		t.Fatalf("unable to update settings: %v", err)
+	}
+
+	for _, want := range []string{
+		`<StreamingChannel version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">`,
+		"<videoCodecType>H.265</videoCodecType>",
+		"<videoResolutionWidth>640</videoResolutionWidth>",
+		"<videoResolutionHeight>360</videoResolutionHeight>",
+		"<channelName>Camera 01</channelName>",
+		"<vendorSpecific>kept</vendorSpecific>",
+	} {
+		if !strings.Contains(written, want) {
+			t.Errorf("expected %q in the written document, got %s", want, written)
+		}
+	}
+	if strings.Count(written, "xmlns") != 1 {
+		t.Errorf("expected the namespace to be declared once, got %s", written)
+	}
+}
+
+func TestXMLNode_SetCreatesMissingElements(t *testing.T) {
+	node := &xmlNode{}
+	enabled := true
+	node.setBool("Video/SmartCodec/enabled", &enabled)
+	node.setBool("Video/missing", nil)
+
+	video := node.child("Video")
+	if video == nil || len(video.Children) != 1 {
+		t.Fatalf("expected a single Video child, got %+v", video)
+	}
+	if got := video.child("SmartCodec").child("enabled").Content; got != "true" {
+		t.Errorf("expected true, got %q", got)
+	}
+}
@@ -17,7 +17,8 @@ import (
 )
 
 type Options struct {
-	timeout time.Duration
+	timeout   time.Duration
+	transport http.RoundTripper
 }
 
 type ClientOptioner func(o *Options)
@@ -28,6 +29,12 @@ func WithTimeout(dur time.Duration) ClientOptioner {
 	}
 }
 
+func WithTransport(transport http.RoundTripper) ClientOptioner {
+	return func(o *Options) {
+		o.transport = transport
+	}
+}
+
 func NewHttpClient(ctx context.Context, opts ...ClientOptioner) *http.Client {
 	options := &Options{}
 	for _, o := range opts {
@@ -35,7 +42,8 @@ func NewHttpClient(ctx context.Context, opts ...ClientOptioner) *http.Client {
 	}
 
 	client := &http.Client{
-		Timeout: options.timeout,
+		Timeout:   options.timeout,
+		Transport: options.transport,
 	}
 	return client
 }
@@ -0,0 +1,272 @@
+package custhttp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+// AuthTransport authenticates requests that carry Basic credentials
+// (see WithBasicAuth), switching to Digest when a host answers
+// with a Digest challenge. The last digest challenge is remembered
+// per host so later requests to it go with Digest and skip the 401
+type AuthTransport struct {
+	base  http.RoundTripper
+	mu    sync.Mutex
+	hosts map[string]*hostAuth
+}
+
+type hostAuth struct {
+	challenge *digestChallenge
+	nc        uint32
+}
+
+func NewAuthTransport(base http.RoundTripper) *AuthTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &AuthTransport{
+		base:  base,
+		hosts: make(map[string]*hostAuth),
+	}
+}
+
+// CloseIdleConnections lets http.Client.CloseIdleConnections reach the base transport
+func (t *AuthTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func (t *AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	host := req.URL.Host
+
+	if authorization, ok := t.digestAuthorization(host, req, username, password); ok {
+		digestReq, err := withAuthorization(req, authorization)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.base.RoundTrip(digestReq)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		// the nonce may have expired, retry once with the new challenge
+		return t.retryWithDigest(req, resp, username, password)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	return t.retryWithDigest(req, resp, username, password)
+}
+
+func (t *AuthTransport) retryWithDigest(req *http.Request, resp *http.Response, username string, password string) (*http.Response, error) {
+	challenge := findDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if challenge == nil {
+		return resp, nil
+	}
+	if req.Body != nil && req.GetBody == nil {
+		logger.SDebug("unable to retry request with digest auth, body is not rewindable")
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	host := req.URL.Host
+	t.mu.Lock()
+	h := t.hostLocked(host)
+	h.challenge = challenge
+	h.nc = 0
+	t.mu.Unlock()
+
+	authorization, _ := t.digestAuthorization(host, req, username, password)
+	digestReq, err := withAuthorization(req, authorization)
+	if err != nil {
+		return nil, err
+	}
+	digestResp, err := t.base.RoundTrip(digestReq)
+	if err != nil {
+		return nil, err
+	}
+	if digestResp.StatusCode != http.StatusUnauthorized {
+		logger.SDebug("digest authentication accepted",
+			zap.String("host", host))
+	}
+	return digestResp, nil
+}
+
+func (t *AuthTransport) hostLocked(host string) *hostAuth {
+	h, found := t.hosts[host]
+	if !found {
+		h = &hostAuth{}
+		t.hosts[host] = h
+	}
+	return h
+}
+
+// digestAuthorization builds the Authorization header from the cached
+// challenge of the host, incrementing the nonce count
+func (t *AuthTransport) digestAuthorization(host string, req *http.Request, username string, password string) (string, bool) {
+	t.mu.Lock()
+	h, found := t.hosts[host]
+	if !found || h.challenge == nil {
+		t.mu.Unlock()
+		return "", false
+	}
+	h.nc++
+	nc := h.nc
+	challenge := h.challenge
+	t.mu.Unlock()
+
+	return challenge.authorization(req.Method, req.URL.RequestURI(), username, password, nc), true
+}
+
+func withAuthorization(req *http.Request, authorization string) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	r.Header.Set("Authorization", authorization)
+	return r, nil
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+}
+
+func findDigestChallenge(headers []string) *digestChallenge {
+	for _, header := range headers {
+		scheme, params, found := strings.Cut(strings.TrimSpace(header), " ")
+		if !found || !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		parsed := parseAuthParams(params)
+		challenge := &digestChallenge{
+			realm:     parsed["realm"],
+			nonce:     parsed["nonce"],
+			opaque:    parsed["opaque"],
+			algorithm: parsed["algorithm"],
+		}
+		for _, qop := range strings.Split(parsed["qop"], ",") {
+			if strings.TrimSpace(qop) == "auth" {
+				challenge.qop = "auth"
+			}
+		}
+		return challenge
+	}
+	return nil
+}
+
+// parseAuthParams parses comma separated key=value pairs,
+// values may be quoted and contain commas
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		key, rest, found := strings.Cut(s, "=")
+		if !found {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.Index(rest[1:], "\"")
+			if end < 0 {
+				value, s = rest[1:], ""
+			} else {
+				value, s = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		params[key] = value
+	}
+	return params
+}
+
+func (c *digestChallenge) newHash() hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+	case "SHA-256":
+		return sha256.New()
+	default:
+		return md5.New()
+	}
+}
+
+func (c *digestChallenge) h(s string) string {
+	hasher := c.newHash()
+	hasher.Write([]byte(s))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+func (c *digestChallenge) authorization(method string, uri string, username string, password string, nc uint32) string {
+	cnonce := newCnonce()
+	ncValue := fmt.Sprintf("%08x", nc)
+
+	ha1 := c.h(fmt.Sprintf("%s:%s:%s", username, c.realm, password))
+	if strings.HasSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		ha1 = c.h(fmt.Sprintf("%s:%s:%s", ha1, c.nonce, cnonce))
+	}
+	ha2 := c.h(fmt.Sprintf("%s:%s", method, uri))
+
+	var response string
+	if c.qop == "auth" {
+		response = c.h(fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, c.nonce, ncValue, cnonce, c.qop, ha2))
+	} else {
+		response = c.h(fmt.Sprintf("%s:%s:%s", ha1, c.nonce, ha2))
+	}
+
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, username),
+		fmt.Sprintf(`realm="%s"`, c.realm),
+		fmt.Sprintf(`nonce="%s"`, c.nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if c.algorithm != "" {
+		fields = append(fields, fmt.Sprintf("algorithm=%s", c.algorithm))
+	}
+	if c.opaque != "" {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, c.opaque))
+	}
+	if c.qop == "auth" {
+		fields = append(fields,
+			"qop=auth",
+			fmt.Sprintf("nc=%s", ncValue),
+			fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	return "Digest " + strings.Join(fields, ", ")
+}
+
+func newCnonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,105 @@
+package custhttp
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newDigestServer(t *testing.T, username string, password string, unauthorized *int32) *httptest.Server {
+	const realm = "IP Camera"
+	const nonce = "4e4445344e6a6b304d7a6f355a474e6a4d474a6c4d44453d"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		scheme, params, _ := strings.Cut(header, " ")
+		if scheme != "Digest" {
+			atomic.AddInt32(unauthorized, 1)
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest qop="auth", realm="%s", nonce="%s", stale="FALSE"`, realm, nonce))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		p := parseAuthParams(params)
+		ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", username, realm, password))
+		ha2 := md5Hex(fmt.Sprintf("%s:%s", r.Method, p["uri"]))
+		expected := md5Hex(fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, nonce, p["nc"], p["cnonce"], p["qop"], ha2))
+		if p["response"] != expected || p["nonce"] != nonce {
+			atomic.AddInt32(unauthorized, 1)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Nonce-Count", p["nc"])
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestAuthTransport_FallbackToDigest(t *testing.T) {
+	var unauthorized int32
+	server := newDigestServer(t, "admin", "secret", &unauthorized)
+	defer server.Close()
+
+	transport := NewAuthTransport(http.DefaultTransport)
+	client := NewHttpClient(context.Background(), WithTransport(transport))
+	u, _ := url.Parse(server.URL + "/ISAPI/System/deviceinfo")
+
+	for i, expectedNc := range []string{"00000001", "00000002"} {
+		req, err := NewHttpRequest(
+			context.Background(),
+			u,
+			http.MethodPut,
+			WithBasicAuth("admin", "secret"),
+			WithXMLBody(struct {
+				Name string `xml:"name"`
+			}{Name: "camera"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, resp.StatusCode)
+		}
+		if nc := resp.Header.Get("X-Nonce-Count"); nc != expectedNc {
+			t.Fatalf("request %d: expected nonce count %s, got %s", i, expectedNc, nc)
+		}
+	}
+
+	if unauthorized != 1 {
+		t.Fatalf("expected digest to be kept for the host after a single basic auth challenge, got %d", unauthorized)
+	}
+}
+
+func TestAuthTransport_WrongPassword(t *testing.T) {
+	var unauthorized int32
+	server := newDigestServer(t, "admin", "secret", &unauthorized)
+	defer server.Close()
+
+	client := NewHttpClient(context.Background(), WithTransport(NewAuthTransport(nil)))
+	u, _ := url.Parse(server.URL + "/ISAPI/System/deviceinfo")
+	req, err := NewHttpRequest(context.Background(), u, http.MethodGet, WithBasicAuth("admin", "wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", resp.StatusCode)
+	}
+}
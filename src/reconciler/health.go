@@ -0,0 +1,164 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"github.com/CE-Thesis-2023/ltd/src/service"
+	"github.com/eclipse/paho.golang/paho"
+	"go.uber.org/zap"
+)
+
+const (
+	healthInterval = 30 * time.Second
+	// unchanged health is still published once in a while so
+	// consumers can tell a quiet camera from a dead collector
+	healthHeartbeat = 5 * time.Minute
+	healthTimeout   = 5 * time.Second
+)
+
+type healthReport struct {
+	health      service.CameraHealth
+	publishedAt time.Time
+}
+
+// collectHealth polls the health of every assigned camera and publishes it
+// retained to health/{deviceId}/{cameraId} whenever it changes, the first
+// poll happens as soon as the cameras were reconciled
+func (c *Reconciler) collectHealth(ctx context.Context, reconciled <-chan struct{}) {
+	reports := make(map[string]*healthReport)
+	select {
+	case <-reconciled:
+		c.pollHealth(ctx, reports)
+	case <-ctx.Done():
+		logger.SInfo("health collector stopped")
+		return
+	}
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.pollHealth(ctx, reports)
+		case <-ctx.Done():
+			logger.SInfo("health collector stopped")
+			return
+		}
+	}
+}
+
+func (c *Reconciler) pollHealth(ctx context.Context, reports map[string]*healthReport) {
+	cameras := c.assignedCameras()
+
+	results := make(chan *service.CameraHealth, len(cameras))
+	var wg sync.WaitGroup
+	for _, camera := range cameras {
+		wg.Add(1)
+		go func(camera db.Camera) {
+			defer wg.Done()
+			pollCtx, cancel := context.WithTimeout(ctx, healthTimeout)
+			defer cancel()
+			results <- c.commandService.Health(pollCtx, &camera)
+		}(camera)
+	}
+	wg.Wait()
+	close(results)
+
+	now := time.Now()
+	polled := make(map[string]bool, len(cameras))
+	for health := range results {
+		polled[health.CameraId] = true
+		report, found := reports[health.CameraId]
+		if found {
+			keepDeviceInfo(&report.health, health)
+		}
+		if found && !healthChanged(&report.health, health) &&
+			now.Sub(report.publishedAt) < healthHeartbeat {
+			continue
+		}
+		if err := c.publishHealth(health.CameraId, health); err != nil {
+			continue
+		}
+		reports[health.CameraId] = &healthReport{
+			health:      *health,
+			publishedAt: now,
+		}
+	}
+	for cameraId := range reports {
+		if polled[cameraId] {
+			continue
+		}
+		// clear the retained health of cameras no longer assigned
+		if err := c.publishHealth(cameraId, nil); err == nil {
+			delete(reports, cameraId)
+		}
+	}
+}
+
+func (c *Reconciler) assignedCameras() []db.Camera {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cameras := make([]db.Camera, 0, len(c.cameras))
+	for cameraId := range c.cameras {
+		if camera, ok := c.cameraProperties[cameraId]; ok {
+			cameras = append(cameras, camera)
+		}
+	}
+	return cameras
+}
+
+// keepDeviceInfo carries the model and firmware over from the previous health
+// when the device info could not be retrieved this time
+func keepDeviceInfo(previous *service.CameraHealth, current *service.CameraHealth) {
+	if current.Model == "" && current.FirmwareVersion == "" {
+		current.Model = previous.Model
+		current.FirmwareVersion = previous.FirmwareVersion
+	}
+}
+
+// healthChanged ignores latency and uptime which differ on every poll
+func healthChanged(previous *service.CameraHealth, current *service.CameraHealth) bool {
+	a, b := *previous, *current
+	a.LatencyMs, b.LatencyMs = 0, 0
+	a.UptimeSeconds, b.UptimeSeconds = 0, 0
+	return a != b
+}
+
+func (c *Reconciler) publishHealth(cameraId string, health *service.CameraHealth) error {
+	if c.mqttClient == nil {
+		return custerror.FormatInternalError("mqtt client is not initialized")
+	}
+	var payload []byte
+	if health != nil {
+		var err error
+		payload, err = json.Marshal(health)
+		if err != nil {
+			logger.SError("failed to marshal camera health",
+				zap.Error(err))
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.mqttClient.Publish(ctx, &paho.Publish{
+		QoS:     1,
+		Retain:  true,
+		Topic:   fmt.Sprintf("health/%s/%s", c.deviceInfo.DeviceId, cameraId),
+		Payload: payload,
+		Properties: &paho.PublishProperties{
+			ContentType: "application/json",
+		},
+	}); err != nil {
+		logger.SError("failed to publish camera health",
+			zap.String("cameraId", cameraId),
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
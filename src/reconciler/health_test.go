@@ -0,0 +1,59 @@
+package reconciler
+
+import (
+	"testing"
+
+	"github.com/CE-Thesis-2023/ltd/src/service"
+)
+
+func TestHealthChanged(t *testing.T) {
+	previous := service.CameraHealth{
+		CameraId:       "camera",
+		Reachable:      true,
+		LatencyMs:      12,
+		UptimeSeconds:  100,
+		CpuUtilization: 20,
+	}
+
+	current := previous
+	current.LatencyMs = 40
+	current.UptimeSeconds = 130
+	if healthChanged(&previous, &current) {
+		t.Errorf("latency and uptime alone should not count as a change")
+	}
+
+	current.CpuUtilization = 25
+	if !healthChanged(&previous, &current) {
+		t.Errorf("expected a CPU utilization change to be detected")
+	}
+
+	current = previous
+	current.Reachable = false
+	if !healthChanged(&previous, &current) {
+		t.Errorf("expected a reachability change to be detected")
+	}
+}
+
+func TestKeepDeviceInfo(t *testing.T) {
+	previous := service.CameraHealth{
+		CameraId:        "camera",
+		Reachable:       true,
+		Model:           "DS-2DE4425IW-DE",
+		FirmwareVersion: "V5.6.0",
+	}
+
+	current := service.CameraHealth{CameraId: "camera", Reachable: true}
+	keepDeviceInfo(&previous, &current)
+	if current.Model != previous.Model || current.FirmwareVersion != previous.FirmwareVersion {
+		t.Errorf("expected the last known device info to be kept, got %+v", current)
+	}
+	if healthChanged(&previous, &current) {
+		t.Errorf("a failed device info poll should not count as a change")
+	}
+
+	current = service.CameraHealth{CameraId: "camera", Model: previous.Model, FirmwareVersion: "V5.7.0"}
+	keepDeviceInfo(&previous, &current)
+	if current.FirmwareVersion != "V5.7.0" {
+		t.Errorf("expected the new firmware to be reported, got %s", current.FirmwareVersion)
+	}
+}
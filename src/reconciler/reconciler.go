@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sync"
@@ -28,7 +29,7 @@ type Metadata interface {
 }
 
 type Reconciler struct {
-	cameras          map[string]web.TranscoderStreamConfiguration
+	cameras          map[string]service.StreamConfiguration
 	cameraProperties map[string]db.Camera
 	openGateConfigs  string
 
@@ -37,12 +38,13 @@ type Reconciler struct {
 	commandService      *service.CommandService
 	mediaService        *service.MediaController
 	openGateService     *service.ProcessorController
+	alertService        *service.AlertController
 	mqttEndpoints       *web.GetMQTTEventEndpointResponse
 
 	mqttClient *autopaho.ConnectionManager
 
 	updatedOpenGateConfigs string
-	updatedCameras         map[string]web.TranscoderStreamConfiguration
+	updatedCameras         map[string]service.StreamConfiguration
 
 	mu sync.Mutex
 }
@@ -52,7 +54,8 @@ func NewReconciler(
 	deviceInfo *configs.DeviceInfoConfigs,
 	commandService *service.CommandService,
 	mediaService *service.MediaController,
-	openGateService *service.ProcessorController) *Reconciler {
+	openGateService *service.ProcessorController,
+	alertService *service.AlertController) *Reconciler {
 	if controlPlaneService == nil {
 		logger.SFatal("control plane service is nil",
 			zap.String("error", "control plane service is nil"))
@@ -73,18 +76,24 @@ func NewReconciler(
 		logger.SFatal("open gate service is nil",
 			zap.String("error", "open gate service is nil"))
 	}
+	if alertService == nil {
+		logger.SFatal("alert service is nil",
+			zap.String("error", "alert service is nil"))
+	}
 	return &Reconciler{
-		cameras:             make(map[string]web.TranscoderStreamConfiguration),
+		cameras:             make(map[string]service.StreamConfiguration),
 		cameraProperties:    make(map[string]db.Camera),
 		controlPlaneService: controlPlaneService,
 		deviceInfo:          deviceInfo,
 		commandService:      commandService,
 		mediaService:        mediaService,
 		openGateService:     openGateService,
+		alertService:        alertService,
 	}
 }
 
 func (c *Reconciler) onShutdown(ctx context.Context) error {
+	c.alertService.Shutdown()
 	for cameraId := range c.cameras {
 		logger.SInfo("onShutdown: updating status to false",
 			zap.String("cameraId", cameraId))
@@ -113,7 +122,10 @@ func (c *Reconciler) Run(ctx context.Context) {
 	}
 
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(4)
+
+	// closed once the first reconcile assigned the cameras
+	reconciled := make(chan struct{})
 
 	go func() {
 		defer wg.Done()
@@ -131,22 +143,35 @@ func (c *Reconciler) Run(ctx context.Context) {
 		}
 	}()
 
-	for {
+	go func() {
+		defer wg.Done()
+		c.collectHealth(ctx, reconciled)
+	}()
+
+	go func() {
+		defer wg.Done()
+		c.collectStreamStats(ctx)
+	}()
+
+	for first := true; ; first = false {
 		c.mu.Lock()
-		if err := c.reconcile(ctx); err != nil {
+		err := c.reconcile(ctx)
+		// released while waiting so the collectors can read the cameras
+		c.mu.Unlock()
+		if err != nil {
 			logger.SError("reconciler loop reconcile failed",
 				zap.Error(err))
-			c.mu.Unlock()
 			return
 		}
+		if first {
+			close(reconciled)
+		}
 
 		select {
 		case <-time.After(2 * time.Second):
-			c.mu.Unlock()
 			continue
 		case <-ctx.Done():
 			logger.SInfo("reconciler loop shutdown requested")
-			c.mu.Unlock()
 			wg.Wait()
 			return
 		}
@@ -262,16 +287,14 @@ func (c *Reconciler) handleCommand(ctx context.Context, event *events.Event, pay
 			zap.Reflect("event", event))
 		publishTo = fmt.Sprintf("reply/%s", event.String())
 	}
+	// commands over MQTT come from operators, who take PTZ control over the tracker
+	ctx = service.WithPTZClient(ctx, service.PTZClientOperator)
 	var reply *paho.Publish
 	defer func() {
 		if err != nil {
 			logger.SError("failed to handle command",
 				zap.Error(err))
-			resp := events.EventReply{
-				Err:    err,
-				Status: err.Error(),
-			}
-			reply, err = c.buildPublish(publishTo, resp, prop)
+			reply, err = c.buildPublish(publishTo, errorReplyOf(err), prop)
 		}
 		if reply != nil {
 			if _, err := c.mqttClient.Publish(ctx, reply); err != nil {
@@ -283,7 +306,7 @@ func (c *Reconciler) handleCommand(ctx context.Context, event *events.Event, pay
 	}()
 	switch event.Type {
 	case "ptz":
-		var req events.PTZCtrlRequest
+		var req service.PTZCtrlRequest
 		if err = json.Unmarshal(payload, &req); err != nil {
 			return err
 		}
@@ -335,8 +358,14 @@ func (c *Reconciler) handleCommand(ctx context.Context, event *events.Event, pay
 				zap.Error(err))
 			return err
 		}
+		var req service.ChannelRequest
+		if len(payload) > 0 {
+			if err = json.Unmarshal(payload, &req); err != nil {
+				return err
+			}
+		}
 		var resp *hikvision.PTZChannelCapabilities
-		resp, err = c.commandService.PTZCapabilties(ctx, camera)
+		resp, err = c.commandService.PTZCapabilties(ctx, camera, req.ChannelId)
 		if err != nil {
 			logger.SDebug("failed to get PTZ capabilities",
 				zap.Error(err))
@@ -348,10 +377,488 @@ func (c *Reconciler) handleCommand(ctx context.Context, event *events.Event, pay
 				zap.Error(err))
 			return err
 		}
+	case "ptz_absolute":
+		var camera *db.Camera
+		camera, err = c.cameraFromArguments(event)
+		if err != nil {
+			return err
+		}
+		var req service.PTZAbsoluteRequest
+		if err = json.Unmarshal(payload, &req); err != nil {
+			return err
+		}
+		if err = c.commandService.PTZAbsolute(ctx, camera, &req); err != nil {
+			return err
+		}
+		reply, _ = c.buildPublish(publishTo, &events.EventReply{Status: "200", Err: nil}, prop)
+	case "snapshot":
+		var camera *db.Camera
+		camera, err = c.cameraFromArguments(event)
+		if err != nil {
+			return err
+		}
+		var req service.SnapshotRequest
+		if len(payload) > 0 {
+			if err = json.Unmarshal(payload, &req); err != nil {
+				return err
+			}
+		}
+		var jpegImg []byte
+		jpegImg, err = c.commandService.Snapshot(ctx, camera, &req)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, &service.SnapshotResponse{
+			CameraId:    camera.CameraId,
+			Base64Image: base64.StdEncoding.EncodeToString(jpegImg),
+		}, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "reboot":
+		var camera *db.Camera
+		camera, err = c.cameraFromArguments(event)
+		if err != nil {
+			return err
+		}
+		if err = c.commandService.Reboot(ctx, camera); err != nil {
+			return err
+		}
+		reply, _ = c.buildPublish(publishTo, &events.EventReply{Status: "200", Err: nil}, prop)
+	case "time_sync":
+		var camera *db.Camera
+		camera, err = c.cameraFromArguments(event)
+		if err != nil {
+			return err
+		}
+		var req service.TimeSyncRequest
+		if len(payload) > 0 {
+			if err = json.Unmarshal(payload, &req); err != nil {
+				return err
+			}
+		}
+		var resp *service.TimeSyncResponse
+		resp, err = c.commandService.TimeSync(ctx, camera, &req)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "image_settings":
+		var camera *db.Camera
+		camera, err = c.cameraFromArguments(event)
+		if err != nil {
+			return err
+		}
+		var req service.ImageSettingsRequest
+		if len(payload) > 0 {
+			if err = json.Unmarshal(payload, &req); err != nil {
+				return err
+			}
+		}
+		var resp *hikvision.ImageChannel
+		resp, err = c.commandService.ImageSettings(ctx, camera, &req)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "stream_settings":
+		var resp interface{}
+		resp, err = c.handleStreamSettings(ctx, event, payload)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "motion_detection", "line_detection", "field_detection", "privacy_mask", "osd":
+		var resp interface{}
+		resp, err = c.handleVideoSettings(ctx, event, payload)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "channels":
+		var camera *db.Camera
+		camera, err = c.cameraFromArguments(event)
+		if err != nil {
+			return err
+		}
+		var resp *service.ChannelsResponse
+		resp, err = c.commandService.Channels(ctx, camera)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "probe":
+		var camera *db.Camera
+		camera, err = c.cameraFromArguments(event)
+		if err != nil {
+			return err
+		}
+		var req service.ProbeRequest
+		if len(payload) > 0 {
+			if err = json.Unmarshal(payload, &req); err != nil {
+				return err
+			}
+		}
+		var resp *service.ProbeResponse
+		resp, err = c.commandService.Probe(ctx, camera, &req)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "ptz_home", "ptz_park", "ptz_time_tasks":
+		var resp interface{}
+		resp, err = c.handlePtzPark(ctx, event, payload)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "ptz_control":
+		var camera *db.Camera
+		camera, err = c.cameraFromArguments(event)
+		if err != nil {
+			return err
+		}
+		var req service.PTZControlRequest
+		if err = json.Unmarshal(payload, &req); err != nil {
+			return err
+		}
+		var resp *service.PTZControlResponse
+		resp, err = c.commandService.PTZControl(ctx, camera, &req)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "ptz_limits":
+		var camera *db.Camera
+		camera, err = c.cameraFromArguments(event)
+		if err != nil {
+			return err
+		}
+		var req service.PTZLimitsRequest
+		if len(payload) > 0 {
+			if err = json.Unmarshal(payload, &req); err != nil {
+				return err
+			}
+		}
+		var resp *service.PTZLimitsResponse
+		resp, err = c.commandService.PTZLimits(ctx, camera, &req)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "ptz_patrol":
+		var resp interface{}
+		resp, err = c.handlePtzPatrol(ctx, event, payload)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "ptz_pattern":
+		var camera *db.Camera
+		camera, err = c.cameraFromArguments(event)
+		if err != nil {
+			return err
+		}
+		var req service.PTZPatternRequest
+		if err = json.Unmarshal(payload, &req); err != nil {
+			return err
+		}
+		if err = c.commandService.PTZPattern(ctx, camera, &req); err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, &events.EventReply{Status: "200", Err: nil}, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
+	case "ptz_preset":
+		var resp interface{}
+		resp, err = c.handlePtzPreset(ctx, event, payload)
+		if err != nil {
+			return err
+		}
+		reply, err = c.buildPublish(publishTo, resp, prop)
+		if err != nil {
+			logger.SError("failed to build publish",
+				zap.Error(err))
+			return err
+		}
 	}
 	return nil
 }
 
+// errorReplyOf keeps the reply format consumers rely on, the status is the
+// error text and the error carries its Msg and Code, device errors and PTZ
+// control conflicts add the ISAPI response status or the held lease to them
+func errorReplyOf(err error) *events.EventReply {
+	reply := &events.EventReply{Status: err.Error()}
+	var isapiErr *hikvision.ISAPIError
+	if errors.As(err, &isapiErr) {
+		reply.Err = isapiErr
+		return reply
+	}
+	var leaseErr *service.PTZLeaseError
+	if errors.As(err, &leaseErr) {
+		reply.Err = leaseErr
+		return reply
+	}
+	var customErr *custerror.CustomError
+	if !errors.As(err, &customErr) {
+		customErr = custerror.NewError(err.Error(), custerror.ErrorInternal.Code)
+	}
+	reply.Err = customErr
+	return reply
+}
+
+func (c *Reconciler) cameraFromArguments(event *events.Event) (*db.Camera, error) {
+	if len(event.Arguments) == 0 {
+		return nil, custerror.FormatInvalidArgument("no camera id found")
+	}
+	camera, err := c.resoluteCamera(event.Arguments[0])
+	if err != nil {
+		logger.SError("failed to resolute camera",
+			zap.Error(err))
+		return nil, err
+	}
+	return camera, nil
+}
+
+func (c *Reconciler) handlePtzPreset(ctx context.Context, event *events.Event, payload []byte) (interface{}, error) {
+	camera, err := c.cameraFromArguments(event)
+	if err != nil {
+		return nil, err
+	}
+	var req service.PTZPresetRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	logger.SInfo("received PTZ preset command",
+		zap.Any("command", req))
+	switch req.Action {
+	case service.PTZPresetActionList:
+		return c.commandService.PTZPresets(ctx, camera, req.ChannelId)
+	case service.PTZPresetActionSet:
+		err = c.commandService.PTZSetPreset(ctx, camera, &req)
+	case service.PTZPresetActionDelete:
+		err = c.commandService.PTZDeletePreset(ctx, camera, req.ChannelId, req.PresetId)
+	case service.PTZPresetActionGoto:
+		err = c.commandService.PTZGotoPreset(ctx, camera, req.ChannelId, req.PresetId)
+	default:
+		return nil, custerror.FormatInvalidArgument("unknown PTZ preset action %q", req.Action)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &events.EventReply{Status: "200", Err: nil}, nil
+}
+
+func (c *Reconciler) handlePtzPatrol(ctx context.Context, event *events.Event, payload []byte) (interface{}, error) {
+	camera, err := c.cameraFromArguments(event)
+	if err != nil {
+		return nil, err
+	}
+	var req service.PTZPatrolRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	logger.SInfo("received PTZ patrol command",
+		zap.Any("command", req))
+	switch req.Action {
+	case service.PTZPatrolActionList:
+		return c.commandService.PTZPatrols(ctx, camera, req.ChannelId)
+	case service.PTZPatrolActionSet:
+		err = c.commandService.PTZSetPatrol(ctx, camera, &req)
+	default:
+		err = c.commandService.PTZPatrolCommand(ctx, camera, &req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &events.EventReply{Status: "200", Err: nil}, nil
+}
+
+// handlePtzPark drives the home position, or reads the park action and time tasks
+// of the camera and replaces them when the payload carries settings
+func (c *Reconciler) handlePtzPark(ctx context.Context, event *events.Event, payload []byte) (interface{}, error) {
+	camera, err := c.cameraFromArguments(event)
+	if err != nil {
+		return nil, err
+	}
+	unmarshal := func(req interface{}) error {
+		if len(payload) == 0 {
+			return nil
+		}
+		return json.Unmarshal(payload, req)
+	}
+	switch event.Type {
+	case "ptz_home":
+		var req service.PTZHomeRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		if err := c.commandService.PTZHome(ctx, camera, &req); err != nil {
+			return nil, err
+		}
+		return &events.EventReply{Status: "200", Err: nil}, nil
+	case "ptz_park":
+		var req service.PTZParkActionRequest
+		if err := unmarshal(&req); err != nil {
+			return nil, err
+		}
+		return c.commandService.PTZParkAction(ctx, camera, &req)
+	default:
+		var req service.PTZTimeTaskRequest
+		if err := unmarshal(&req); err != nil {
+			return nil, err
+		}
+		return c.commandService.PTZTimeTasks(ctx, camera, &req)
+	}
+}
+
+// handleVideoSettings reads the detection, mask or overlay settings of the camera,
+// or replaces them when the payload carries settings
+func (c *Reconciler) handleVideoSettings(ctx context.Context, event *events.Event, payload []byte) (interface{}, error) {
+	camera, err := c.cameraFromArguments(event)
+	if err != nil {
+		return nil, err
+	}
+	unmarshal := func(req interface{}) error {
+		if len(payload) == 0 {
+			return nil
+		}
+		return json.Unmarshal(payload, req)
+	}
+	switch event.Type {
+	case "motion_detection":
+		var req service.MotionDetectionRequest
+		if err := unmarshal(&req); err != nil {
+			return nil, err
+		}
+		return c.commandService.MotionDetection(ctx, camera, &req)
+	case "line_detection":
+		var req service.LineDetectionRequest
+		if err := unmarshal(&req); err != nil {
+			return nil, err
+		}
+		return c.commandService.LineDetection(ctx, camera, &req)
+	case "privacy_mask":
+		var req service.PrivacyMaskRequest
+		if err := unmarshal(&req); err != nil {
+			return nil, err
+		}
+		return c.commandService.PrivacyMask(ctx, camera, &req)
+	case "osd":
+		var req service.OverlayRequest
+		if err := unmarshal(&req); err != nil {
+			return nil, err
+		}
+		return c.commandService.Overlays(ctx, camera, &req)
+	default:
+		var req service.FieldDetectionRequest
+		if err := unmarshal(&req); err != nil {
+			return nil, err
+		}
+		return c.commandService.FieldDetection(ctx, camera, &req)
+	}
+}
+
+// handleStreamSettings applies the settings to the camera in the arguments,
+// or to every assigned camera when no camera is given so all of them
+// share the same stream profile
+func (c *Reconciler) handleStreamSettings(ctx context.Context, event *events.Event, payload []byte) (interface{}, error) {
+	var req service.StreamSettingsRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+	}
+	if len(event.Arguments) > 0 {
+		camera, err := c.cameraFromArguments(event)
+		if err != nil {
+			return nil, err
+		}
+		return c.commandService.StreamSettings(ctx, camera, &req)
+	}
+	if req.Settings == nil {
+		return nil, custerror.FormatInvalidArgument("settings are required when applying to every camera")
+	}
+	// cameras are updated concurrently to fit in the command timeout
+	cameras := c.assignedCameras()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		replies = make(map[string]*events.EventReply, len(cameras))
+	)
+	for _, camera := range cameras {
+		wg.Add(1)
+		go func(camera db.Camera) {
+			defer wg.Done()
+			reply := &events.EventReply{Status: "200", Err: nil}
+			if _, err := c.commandService.StreamSettings(ctx, &camera, &req); err != nil {
+				reply = errorReplyOf(err)
+			}
+			mu.Lock()
+			replies[camera.CameraId] = reply
+			mu.Unlock()
+		}(camera)
+	}
+	wg.Wait()
+	return replies, nil
+}
+
 func (c *Reconciler) GetCameraByName(name string) (*db.Camera, error) {
 	for _, camera := range c.cameraProperties {
 		if camera.OpenGateCameraName == name {
@@ -434,6 +941,8 @@ func (c *Reconciler) reconcile(ctx context.Context) error {
 		return err
 	}
 
+	c.reconcileAlertStreams()
+
 	return nil
 }
 
@@ -494,7 +1003,7 @@ func (c *Reconciler) pullStreamConfigurations(ctx context.Context) error {
 		c.cameraProperties[camera.CameraId] = camera
 	}
 
-	c.updatedCameras = make(map[string]web.TranscoderStreamConfiguration)
+	c.updatedCameras = make(map[string]service.StreamConfiguration)
 	if len(cameraIds) > 0 {
 		cameraConfigurations, err := c.controlPlaneService.GetCameraStreamSettings(ctx, &web.GetStreamConfigurationsRequest{
 			CameraId: cameraIds,
@@ -512,16 +1021,34 @@ func (c *Reconciler) pullStreamConfigurations(ctx context.Context) error {
 
 func (c *Reconciler) reconcileFFmpegStreams() error {
 	for cameraId, newConfig := range c.updatedCameras {
-		if _, ok := c.cameras[cameraId]; !ok {
+		c.commandService.SetCameraChannel(cameraId, newConfig.ChannelId())
+		c.commandService.SetCameraSource(cameraId, newConfig.SourceUrl)
+		oldConfig, found := c.cameras[cameraId]
+		if found && oldConfig.Equal(newConfig) {
+			continue
+		}
+		if !found {
 			logger.SInfo("new camera stream configuration",
 				zap.String("cameraId", cameraId))
-			updated, err := c.mediaService.Register(newConfig)
-			if err != nil {
-				logger.SError("failed to register camera stream configuration",
-					zap.String("cameraId", cameraId),
-					zap.Error(err))
-				return err
+		}
+		updated, err := c.mediaService.Register(newConfig)
+		if err != nil {
+			logger.SError("failed to register camera stream configuration",
+				zap.String("cameraId", cameraId),
+				zap.Error(err))
+			// a bad configuration of one camera leaves the other streams running,
+			// it is not kept as applied so that it is retried on the next reconcile
+			if errors.Is(err, custerror.ErrorInvalidArgument) {
+				if found {
+					c.updatedCameras[cameraId] = oldConfig
+				} else {
+					delete(c.updatedCameras, cameraId)
+				}
+				continue
 			}
+			return err
+		}
+		if !found {
 			if err := c.controlPlaneService.UpdateTranscoderStatus(
 				context.Background(),
 				c.deviceInfo.DeviceId,
@@ -531,10 +1058,10 @@ func (c *Reconciler) reconcileFFmpegStreams() error {
 					zap.Error(err))
 				return err
 			}
-			if updated {
-				logger.SInfo("camera stream configuration updated",
-					zap.String("cameraId", cameraId))
-			}
+		}
+		if updated {
+			logger.SInfo("camera stream configuration updated",
+				zap.String("cameraId", cameraId))
 		}
 	}
 	for cameraId := range c.cameras {
@@ -542,6 +1069,7 @@ func (c *Reconciler) reconcileFFmpegStreams() error {
 			logger.SInfo("camera stream configuration removed",
 				zap.String("cameraId", cameraId))
 			c.mediaService.Deregister(cameraId)
+			c.forgetCamera(cameraId)
 			if err := c.controlPlaneService.UpdateTranscoderStatus(
 				context.Background(),
 				c.deviceInfo.DeviceId,
@@ -557,6 +1085,24 @@ func (c *Reconciler) reconcileFFmpegStreams() error {
 	return nil
 }
 
+// forgetCamera drops the properties of a removed camera, its connections are
+// released unless another camera, such as another channel of the same NVR, shares its host
+func (c *Reconciler) forgetCamera(cameraId string) {
+	c.commandService.SetCameraChannel(cameraId, "")
+	c.commandService.SetCameraSource(cameraId, "")
+	camera, found := c.cameraProperties[cameraId]
+	if !found {
+		return
+	}
+	delete(c.cameraProperties, cameraId)
+	for otherId, other := range c.cameraProperties {
+		if _, assigned := c.updatedCameras[otherId]; assigned && other.Ip == camera.Ip {
+			return
+		}
+	}
+	c.commandService.ForgetCamera(&camera)
+}
+
 func (c *Reconciler) reconcileOpenGate() error {
 	if c.openGateConfigs != c.updatedOpenGateConfigs {
 		logger.SInfo("OpenGate configuration updated")
@@ -565,3 +1111,44 @@ func (c *Reconciler) reconcileOpenGate() error {
 	}
 	return nil
 }
+
+func (c *Reconciler) reconcileAlertStreams() {
+	for cameraId := range c.cameras {
+		camera, ok := c.cameraProperties[cameraId]
+		if !ok {
+			continue
+		}
+		c.alertService.Subscribe(camera, c.publishAlert)
+	}
+	for _, cameraId := range c.alertService.Subscribed() {
+		if _, ok := c.cameras[cameraId]; !ok {
+			c.alertService.Unsubscribe(cameraId)
+		}
+	}
+}
+
+func (c *Reconciler) publishAlert(alert *service.CameraAlert) {
+	if c.mqttClient == nil {
+		return
+	}
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		logger.SError("failed to marshal camera alert",
+			zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.mqttClient.Publish(ctx, &paho.Publish{
+		QoS:     1,
+		Topic:   fmt.Sprintf("alerts/%s/%s", c.deviceInfo.DeviceId, alert.CameraId),
+		Payload: payload,
+		Properties: &paho.PublishProperties{
+			ContentType: "application/json",
+		},
+	}); err != nil {
+		logger.SError("failed to publish camera alert",
+			zap.String("cameraId", alert.CameraId),
+			zap.Error(err))
+	}
+}
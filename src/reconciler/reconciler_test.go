@@ -0,0 +1,36 @@
+package reconciler
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+)
+
+func TestErrorReplyOf(t *testing.T) {
+	err := custerror.FormatInvalidArgument("preset id must be positive, got 0")
+	reply := errorReplyOf(err)
+	if reply.Status != err.Error() {
+		t.Errorf("expected the error text as status, got %q", reply.Status)
+	}
+	body, marshalErr := json.Marshal(reply.Err)
+	if marshalErr != nil {
+		t.Fatal(marshalErr)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["Msg"] != err.Error() || fields["Code"] != float64(custerror.ErrorInvalidArgument.Code) {
+		t.Errorf("expected the Msg and Code fields consumers read, got %s", body)
+	}
+
+	reply = errorReplyOf(errors.New("connection refused"))
+	if reply.Status != "connection refused" {
+		t.Errorf("expected the error text as status, got %q", reply.Status)
+	}
+	if !errors.Is(reply.Err, custerror.ErrorInternal) {
+		t.Errorf("expected other errors to be internal, got %v", reply.Err)
+	}
+}
@@ -0,0 +1,102 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"github.com/CE-Thesis-2023/ltd/src/service"
+	"github.com/eclipse/paho.golang/paho"
+	"go.uber.org/zap"
+)
+
+const streamStatsInterval = 10 * time.Second
+
+// collectStreamStats publishes the FFmpeg progress of every stream retained
+// to streams/{deviceId}/{cameraId} whenever FFmpeg reported since the last time
+func (c *Reconciler) collectStreamStats(ctx context.Context) {
+	published := make(map[string]service.StreamStats)
+	ticker := time.NewTicker(streamStatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.publishStreamStats(published)
+		case <-ctx.Done():
+			logger.SInfo("stream stats collector stopped")
+			return
+		}
+	}
+}
+
+func (c *Reconciler) publishStreamStats(published map[string]service.StreamStats) {
+	current := make(map[string]bool)
+	for _, stats := range c.mediaService.StreamStats() {
+		current[stats.CameraId] = true
+		if previous, found := published[stats.CameraId]; found && !streamStatsChanged(&previous, &stats) {
+			continue
+		}
+		if err := c.publishStreamStat(stats.CameraId, &stats); err != nil {
+			continue
+		}
+		published[stats.CameraId] = stats
+	}
+	for cameraId := range published {
+		if current[cameraId] {
+			continue
+		}
+		// clear the retained stats of streams no longer registered
+		if err := c.publishStreamStat(cameraId, nil); err == nil {
+			delete(published, cameraId)
+		}
+	}
+}
+
+func streamStatsChanged(previous *service.StreamStats, current *service.StreamStats) bool {
+	return previous.Running != current.Running ||
+		!previous.StartedAt.Equal(current.StartedAt) ||
+		!sameTime(previous.UpdatedAt, current.UpdatedAt)
+}
+
+func sameTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func (c *Reconciler) publishStreamStat(cameraId string, stats *service.StreamStats) error {
+	if c.mqttClient == nil {
+		return custerror.FormatInternalError("mqtt client is not initialized")
+	}
+	var payload []byte
+	if stats != nil {
+		var err error
+		payload, err = json.Marshal(stats)
+		if err != nil {
+			logger.SError("failed to marshal stream stats",
+				zap.Error(err))
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.mqttClient.Publish(ctx, &paho.Publish{
+		QoS:     1,
+		Retain:  true,
+		Topic:   fmt.Sprintf("streams/%s/%s", c.deviceInfo.DeviceId, cameraId),
+		Payload: payload,
+		Properties: &paho.PublishProperties{
+			ContentType: "application/json",
+		},
+	}); err != nil {
+		logger.SError("failed to publish stream stats",
+			zap.String("cameraId", cameraId),
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
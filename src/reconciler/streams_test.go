@@ -0,0 +1,47 @@
+package reconciler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CE-Thesis-2023/ltd/src/service"
+)
+
+func TestStreamStatsChanged(t *testing.T) {
+	startedAt := time.Now()
+	updatedAt := startedAt.Add(5 * time.Second)
+	previous := service.StreamStats{
+		CameraId:  "camera",
+		Running:   true,
+		StartedAt: startedAt,
+		UpdatedAt: &updatedAt,
+	}
+
+	current := previous
+	sameUpdate := updatedAt
+	current.UpdatedAt = &sameUpdate
+	if streamStatsChanged(&previous, &current) {
+		t.Errorf("stats without a new report should not count as a change")
+	}
+
+	nextUpdate := updatedAt.Add(5 * time.Second)
+	current.UpdatedAt = &nextUpdate
+	if !streamStatsChanged(&previous, &current) {
+		t.Errorf("expected a new report to be detected")
+	}
+
+	current = previous
+	current.Running = false
+	if !streamStatsChanged(&previous, &current) {
+		t.Errorf("expected a stopped stream to be detected")
+	}
+
+	notReported := previous
+	notReported.UpdatedAt = nil
+	if !streamStatsChanged(&notReported, &previous) {
+		t.Errorf("expected a first report to be detected")
+	}
+	if streamStatsChanged(&notReported, &notReported) {
+		t.Errorf("stats never reported should not count as a change")
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+type CameraAlert struct {
+	CameraId string                            `json:"cameraId"`
+	Alert    *hikvision.EventNotificationAlert `json:"alert"`
+}
+
+type AlertHandler func(alert *CameraAlert)
+
+type alertSubscription struct {
+	camera db.Camera
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// AlertController keeps one alert stream subscription per camera
+type AlertController struct {
+	mu              sync.Mutex
+	hikvisionClient hikvision.Client
+	subscriptions   map[string]*alertSubscription
+}
+
+func NewAlertController(hikvisionClient hikvision.Client) *AlertController {
+	return &AlertController{
+		hikvisionClient: hikvisionClient,
+		subscriptions:   make(map[string]*alertSubscription),
+	}
+}
+
+// Subscribe starts delivering alerts of the camera to the handler,
+// an existing subscription is kept unless the camera address or credentials changed
+func (c *AlertController) Subscribe(camera db.Camera, handler AlertHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var previous *alertSubscription
+	if sub, found := c.subscriptions[camera.CameraId]; found {
+		if sub.camera.Ip == camera.Ip &&
+			sub.camera.Username == camera.Username &&
+			sub.camera.Password == camera.Password {
+			return
+		}
+		logger.SInfo("camera changed, restarting alert stream",
+			zap.String("cameraId", camera.CameraId))
+		previous = c.remove(camera.CameraId)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &alertSubscription{
+		camera: camera,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	c.subscriptions[camera.CameraId] = sub
+
+	alerts := c.hikvisionClient.
+		Event(credentialsOf(&camera)).
+		AlertStream(ctx)
+	go func() {
+		defer close(sub.done)
+		// the handler of the previous stream is waited for without the lock
+		// so that the alerts of the camera are never handled twice at once
+		if previous != nil {
+			<-previous.done
+		}
+		for alert := range alerts {
+			handler(&CameraAlert{
+				CameraId: camera.CameraId,
+				Alert:    alert,
+			})
+		}
+	}()
+	logger.SInfo("subscribed to camera alert stream",
+		zap.String("cameraId", camera.CameraId))
+}
+
+func (c *AlertController) Unsubscribe(cameraId string) {
+	c.mu.Lock()
+	sub := c.remove(cameraId)
+	c.mu.Unlock()
+	if sub != nil {
+		<-sub.done
+	}
+}
+
+func (c *AlertController) Subscribed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cameraIds := make([]string, 0, len(c.subscriptions))
+	for cameraId := range c.subscriptions {
+		cameraIds = append(cameraIds, cameraId)
+	}
+	return cameraIds
+}
+
+func (c *AlertController) Shutdown() {
+	c.mu.Lock()
+	var stopped []*alertSubscription
+	for cameraId := range c.subscriptions {
+		stopped = append(stopped, c.remove(cameraId))
+	}
+	c.mu.Unlock()
+	for _, sub := range stopped {
+		<-sub.done
+	}
+}
+
+// remove cancels the subscription of the camera and returns it, c.mu must be held,
+// its handler may still be running and is waited for on done without the lock since
+// it can block on publishing
+func (c *AlertController) remove(cameraId string) *alertSubscription {
+	sub, found := c.subscriptions[cameraId]
+	if !found {
+		return nil
+	}
+	sub.cancel()
+	delete(c.subscriptions, cameraId)
+	logger.SInfo("unsubscribed from camera alert stream",
+		zap.String("cameraId", cameraId))
+	return sub
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+)
+
+const testMotionAlert = `--boundary
+Content-Type: application/xml
+
+<EventNotificationAlert version="2.0" xmlns="http://www.hikvision.com/ver20/XMLSchema">
+<channelID>1</channelID>
+<dateTime>2024-05-01T10:00:00+07:00</dateTime>
+<activePostCount>1</activePostCount>
+<eventType>VMD</eventType>
+<eventState>active</eventState>
+</EventNotificationAlert>
+`
+
+func TestAlertController_UnsubscribeBlockedHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "multipart/mixed; boundary=boundary")
+		w.Write([]byte(testMotionAlert))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+	client, err := hikvision.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewAlertController(client)
+
+	// the handler of the first camera is stuck publishing its alert
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	c.Subscribe(db.Camera{CameraId: "camera-1", Ip: server.URL}, func(alert *CameraAlert) {
+		close(handling)
+		<-release
+	})
+	select {
+	case <-handling:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the alert to be handled")
+	}
+	unsubscribed := make(chan struct{})
+	go func() {
+		c.Unsubscribe("camera-1")
+		close(unsubscribed)
+	}()
+
+	subscribed := make(chan struct{})
+	go func() {
+		c.Subscribe(db.Camera{CameraId: "camera-2", Ip: server.URL}, func(alert *CameraAlert) {})
+		c.Subscribed()
+		close(subscribed)
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("expected other cameras to subscribe while a handler is stuck")
+	}
+
+	select {
+	case <-unsubscribed:
+		t.Fatal("expected the unsubscribe to wait for the running handler")
+	default:
+	}
+	close(release)
+	select {
+	case <-unsubscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the unsubscribe to end with the handler")
+	}
+	c.Shutdown()
+}
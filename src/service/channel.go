@@ -0,0 +1,69 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+)
+
+const defaultChannelId = "1"
+
+var (
+	// /ISAPI/Streaming/channels/401 or /Streaming/Channels/401, channel 4 main stream
+	streamingChannelPattern = regexp.MustCompile(`(?i)/streaming/channels/(\d+)`)
+	// /h264/ch4/main/av_stream, the URL format of older firmwares
+	legacyChannelPattern = regexp.MustCompile(`(?i)/ch(\d+)/`)
+)
+
+// channelOfSourceUrl returns the video channel a camera streams from,
+// empty when the source URL does not name one
+func channelOfSourceUrl(sourceUrl string) string {
+	if match := streamingChannelPattern.FindStringSubmatch(sourceUrl); match != nil {
+		return channelOfStreamId(match[1])
+	}
+	if match := legacyChannelPattern.FindStringSubmatch(sourceUrl); match != nil {
+		return strings.TrimLeft(match[1], "0")
+	}
+	return ""
+}
+
+// channelOfStreamId returns the video channel of a streaming channel,
+// streams are numbered channel * 100 + stream
+func channelOfStreamId(id string) string {
+	if len(id) > 2 {
+		id = id[:len(id)-2]
+	}
+	return strings.TrimLeft(id, "0")
+}
+
+// ChannelId is the video channel the stream is sourced from
+func (s StreamConfiguration) ChannelId() string {
+	return channelOfSourceUrl(s.SourceUrl)
+}
+
+// SetCameraChannel records the video channel of a camera, a camera attached
+// to an NVR is one of its channels rather than its first one
+func (s *CommandService) SetCameraChannel(cameraId string, channelId string) {
+	s.channelsMu.Lock()
+	defer s.channelsMu.Unlock()
+	if channelId == "" {
+		delete(s.channels, cameraId)
+		return
+	}
+	s.channels[cameraId] = channelId
+}
+
+// channelIdOf resolves the channel a request targets, the channel of the
+// request first, then the channel of the camera and finally the first channel
+func (s *CommandService) channelIdOf(camera *db.Camera, channelId string) string {
+	if channelId != "" {
+		return channelId
+	}
+	s.channelsMu.Lock()
+	defer s.channelsMu.Unlock()
+	if channelId, found := s.channels[camera.CameraId]; found {
+		return channelId
+	}
+	return defaultChannelId
+}
@@ -4,7 +4,12 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"net"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/CE-Thesis-2023/backend/src/models/db"
@@ -23,6 +28,27 @@ type CommandService struct {
 	hikvisionClient hikvision.Client
 	MqttClient      *autopaho.ConnectionManager
 	openGateClient  *opengate.OpenGateHTTPAPIClient
+
+	limitsMu      sync.Mutex
+	softLimits    map[string]*PTZSoftLimits
+	limitsPath    string
+	limitWatchers map[string]*limitWatcher
+
+	leaseMu sync.Mutex
+	leases  map[string]*PTZLease
+
+	motions *motionScheduler
+
+	samplersMu sync.Mutex
+	samplers   map[string]*ptzSampler
+
+	channelsMu sync.Mutex
+	channels   map[string]string
+	sources    map[string]string
+
+	// capabilities of the channels, by host and channel, checked before joystick moves
+	capabilitiesMu sync.Mutex
+	capabilities   map[string]*hikvision.PTZChannelCapabilities
 }
 
 func NewCommandService(hikvisionClient hikvision.Client, mqttClient *autopaho.ConnectionManager, opengateClient *opengate.OpenGateHTTPAPIClient) *CommandService {
@@ -30,10 +56,38 @@ func NewCommandService(hikvisionClient hikvision.Client, mqttClient *autopaho.Co
 		hikvisionClient: hikvisionClient,
 		MqttClient:      mqttClient,
 		openGateClient:  opengateClient,
+		softLimits:      map[string]*PTZSoftLimits{},
+		limitWatchers:   map[string]*limitWatcher{},
+		leases:          map[string]*PTZLease{},
+		motions:         newMotionScheduler(),
+		samplers:        map[string]*ptzSampler{},
+		channels:        map[string]string{},
+		sources:         map[string]string{},
+		capabilities:    map[string]*hikvision.PTZChannelCapabilities{},
 	}
 }
 
 func (s *CommandService) Shutdown() {
+	s.limitsMu.Lock()
+	for key, watcher := range s.limitWatchers {
+		watcher.cancel()
+		delete(s.limitWatchers, key)
+	}
+	s.limitsMu.Unlock()
+	s.stopSamplers()
+	s.motions.shutdown()
+}
+
+// ForgetCamera releases the connections kept open to a camera no longer managed
+func (s *CommandService) ForgetCamera(camera *db.Camera) {
+	s.hikvisionClient.Forget(credentialsOf(camera))
+	s.capabilitiesMu.Lock()
+	for key := range s.capabilities {
+		if strings.HasPrefix(key, camera.Ip+"/") {
+			delete(s.capabilities, key)
+		}
+	}
+	s.capabilitiesMu.Unlock()
 }
 
 func (s *CommandService) DeviceInfo(ctx context.Context, camera *db.Camera) (*hikvision.SystemDeviceInfoResponse, error) {
@@ -55,10 +109,233 @@ func (s *CommandService) DeviceInfo(ctx context.Context, camera *db.Camera) (*hi
 	return info, nil
 }
 
-func (s *CommandService) PtzCtrl(ctx context.Context, camera *db.Camera, req *events.PTZCtrlRequest) error {
+func (s *CommandService) Reboot(ctx context.Context, camera *db.Camera) error {
+	logger.SInfo("requested camera reboot",
+		zap.String("camera_id", camera.CameraId))
+	if err := s.hikvisionClient.
+		System(credentialsOf(camera)).
+		Reboot(ctx); err != nil {
+		logger.SError("failed to reboot camera",
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+const (
+	TimeSyncModeManual = "manual"
+	TimeSyncModeNTP    = "ntp"
+)
+
+const defaultNTPServerId = "1"
+
+// TimeSyncRequest sets the camera clock to the clock of this device,
+// or points the camera to an NTP server when the mode is ntp
+type TimeSyncRequest struct {
+	Mode string `json:"mode"`
+	// TimeZone is in the device format, e.g. CST-7:00:00 for UTC+7,
+	// the current time zone of the camera is kept when empty
+	TimeZone     string `json:"timeZone,omitempty"`
+	NtpServer    string `json:"ntpServer,omitempty"`
+	NtpPort      int    `json:"ntpPort,omitempty"`
+	SyncInterval int    `json:"syncInterval,omitempty"`
+}
+
+type TimeSyncResponse struct {
+	CameraId string                `json:"cameraId"`
+	Time     *hikvision.SystemTime `json:"time"`
+	// Drift is how far the camera clock was ahead of this device before syncing
+	Drift float64 `json:"drift"`
+}
+
+func (s *CommandService) TimeSync(ctx context.Context, camera *db.Camera, req *TimeSyncRequest) (*TimeSyncResponse, error) {
+	logger.SInfo("requested camera time sync",
+		zap.String("camera_id", camera.CameraId),
+		zap.Reflect("request", req))
+	system := s.hikvisionClient.System(credentialsOf(camera))
+	current, err := system.Time(ctx)
+	if err != nil {
+		logger.SError("failed to retrieve camera time",
+			zap.Error(err))
+		return nil, err
+	}
+	resp := &TimeSyncResponse{CameraId: camera.CameraId}
+	if deviceTime, err := current.Parse(); err == nil {
+		resp.Drift = math.Round(deviceTime.Sub(time.Now()).Seconds()*100) / 100
+	}
+
+	updated := &hikvision.SystemTime{
+		Version:  current.Version,
+		XMLNS:    current.XMLNS,
+		TimeZone: current.TimeZone,
+	}
+	if req.TimeZone != "" {
+		updated.TimeZone = req.TimeZone
+	}
+	switch req.Mode {
+	case TimeSyncModeManual, "":
+		updated.TimeMode = hikvision.TimeModeManual
+		if err := updated.Format(time.Now()); err != nil {
+			return nil, err
+		}
+	case TimeSyncModeNTP:
+		if req.NtpServer == "" {
+			return nil, custerror.FormatInvalidArgument("NTP server is required for ntp mode")
+		}
+		if err := system.SetNTPServer(ctx, ntpServerOf(req)); err != nil {
+			logger.SError("failed to set NTP server",
+				zap.Error(err))
+			return nil, err
+		}
+		updated.TimeMode = hikvision.TimeModeNTP
+	default:
+		return nil, custerror.FormatInvalidArgument("unknown time sync mode %q", req.Mode)
+	}
+	if err := system.SetTime(ctx, updated); err != nil {
+		logger.SError("failed to set camera time",
+			zap.Error(err))
+		return nil, err
+	}
+	resp.Time = updated
+	logger.SInfo("camera time synced",
+		zap.String("camera_id", camera.CameraId),
+		zap.Float64("drift", resp.Drift))
+	return resp, nil
+}
+
+func ntpServerOf(req *TimeSyncRequest) *hikvision.NTPServer {
+	server := &hikvision.NTPServer{
+		ID:                  defaultNTPServerId,
+		PortNo:              req.NtpPort,
+		SynchronizeInterval: req.SyncInterval,
+	}
+	if server.PortNo == 0 {
+		server.PortNo = 123
+	}
+	if net.ParseIP(req.NtpServer) != nil {
+		server.AddressingFormatType = hikvision.AddressingFormatIpAddress
+		server.IpAddress = req.NtpServer
+	} else {
+		server.AddressingFormatType = hikvision.AddressingFormatHostname
+		server.HostName = req.NtpServer
+	}
+	return server
+}
+
+// CameraHealth is a compact summary of the camera system status,
+// utilization and temperature are rounded so small jitter does not count as a change
+type CameraHealth struct {
+	CameraId        string  `json:"cameraId"`
+	Reachable       bool    `json:"reachable"`
+	Error           string  `json:"error,omitempty"`
+	LatencyMs       int64   `json:"latencyMs"`
+	Model           string  `json:"model,omitempty"`
+	FirmwareVersion string  `json:"firmwareVersion,omitempty"`
+	DeviceStatus    string  `json:"deviceStatus,omitempty"`
+	UptimeSeconds   int     `json:"uptimeSeconds,omitempty"`
+	CpuUtilization  int     `json:"cpuUtilization"`
+	MemoryUsage     float64 `json:"memoryUsage"`
+	Temperature     float64 `json:"temperature,omitempty"`
+	FanFailure      bool    `json:"fanFailure,omitempty"`
+	Tampered        bool    `json:"tampered,omitempty"`
+}
+
+// Health polls the device info and system status of the camera, an
+// unreachable camera is reported as such rather than returned as an error
+func (s *CommandService) Health(ctx context.Context, camera *db.Camera) *CameraHealth {
+	health := &CameraHealth{CameraId: camera.CameraId}
+	system := s.hikvisionClient.System(credentialsOf(camera))
+
+	start := time.Now()
+	status, err := system.Status(ctx)
+	health.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		// the camera answered, but refused or failed the request
+		var isapiErr *hikvision.ISAPIError
+		health.Reachable = errors.As(err, &isapiErr)
+		health.Error = err.Error()
+		logger.SDebug("failed to retrieve camera status",
+			zap.String("camera_id", camera.CameraId),
+			zap.Error(err))
+		return health
+	}
+	health.Reachable = true
+	health.DeviceStatus = status.DeviceStatus
+	if status.DeviceUpTime != nil {
+		health.UptimeSeconds = *status.DeviceUpTime
+	}
+	if status.CPUList != nil {
+		for _, cpu := range status.CPUList.CPU {
+			health.CpuUtilization = max(health.CpuUtilization, roundTo(cpu.CPUUtilization, 5))
+		}
+	}
+	if status.MemoryList != nil {
+		for _, memory := range status.MemoryList.Memory {
+			health.MemoryUsage = math.Max(health.MemoryUsage, math.Round(memory.MemoryUsage))
+		}
+	}
+	if status.TemperatureList != nil {
+		for _, temperature := range status.TemperatureList.Temperature {
+			health.Temperature = math.Max(health.Temperature, math.Round(temperature.Temperature))
+		}
+	}
+	if status.FanList != nil {
+		for _, fan := range status.FanList.Fan {
+			health.FanFailure = health.FanFailure || fan.Speed == 0
+		}
+	}
+	if status.TamperList != nil {
+		for _, tamper := range status.TamperList.Tamper {
+			health.Tampered = health.Tampered || tamper.Tamper
+		}
+	}
+
+	info, err := system.DeviceInfo(ctx)
+	if err != nil {
+		logger.SDebug("failed to retrieve camera device info",
+			zap.String("camera_id", camera.CameraId),
+			zap.Error(err))
+		return health
+	}
+	health.Model = info.Model
+	health.FirmwareVersion = info.FirmwareVersion
+	return health
+}
+
+func roundTo(value int, step int) int {
+	return (value + step/2) / step * step
+}
+
+// PTZCtrlRequest extends the backend continuous move request with lens control
+type PTZCtrlRequest struct {
+	events.PTZCtrlRequest
+	ChannelId string `json:"channelId,omitempty"`
+	Zoom      int    `json:"zoom,omitempty"`
+	Focus     int    `json:"focus,omitempty"`
+	Iris      int    `json:"iris,omitempty"`
+	// Duration in seconds after which the move is stopped, sub-second values are accepted
+	Duration float64 `json:"duration,omitempty"`
+}
+
+func (r *PTZCtrlRequest) stopAfter() time.Duration {
+	return time.Duration(r.Duration * float64(time.Second))
+}
+
+func (r *PTZCtrlRequest) hasPTZ() bool {
+	return r.Pan != 0 || r.Tilt != 0 || r.Zoom != 0
+}
+
+func (r *PTZCtrlRequest) hasLens() bool {
+	return r.Focus != 0 || r.Iris != 0
+}
+
+func (s *CommandService) PtzCtrl(ctx context.Context, camera *db.Camera, req *PTZCtrlRequest) error {
 	logger.SInfo("requested to perform PTZ Control",
 		zap.Reflect("request", req),
 		zap.String("camera_id", req.CameraId))
+	if err := s.claimPTZ(ctx, camera); err != nil {
+		return err
+	}
 
 	if err := s.requestRemoteControl(ctx, camera, req); err != nil {
 		logger.SError("failed to perform PTZ Control", zap.Error(err))
@@ -69,14 +346,15 @@ func (s *CommandService) PtzCtrl(ctx context.Context, camera *db.Camera, req *ev
 	return nil
 }
 
-func (s *CommandService) PTZCapabilties(ctx context.Context, camera *db.Camera) (*hikvision.PTZChannelCapabilities, error) {
+func (s *CommandService) PTZCapabilties(ctx context.Context, camera *db.Camera, channelId string) (*hikvision.PTZChannelCapabilities, error) {
 	logger.SDebug("requested retrieving PTZ capabilities",
-		zap.Reflect("camera_id", camera.CameraId))
+		zap.Reflect("camera_id", camera.CameraId),
+		zap.String("channel_id", channelId))
 	capabilities, err := s.hikvisionClient.PtzCtrl(&hikvision.Credentials{
 		Ip:       camera.Ip,
 		Username: camera.Username,
 		Password: camera.Password,
-	}).Capabilities(ctx, "1")
+	}).Capabilities(ctx, s.channelIdOf(camera, channelId))
 	if err != nil {
 		logger.SError("failed to retrieve PTZ capabilities",
 			zap.Error(err))
@@ -88,105 +366,512 @@ func (s *CommandService) PTZCapabilties(ctx context.Context, camera *db.Camera)
 	return capabilities, nil
 }
 
-func (s *CommandService) requestRemoteControl(ctx context.Context, camera *db.Camera, req *events.PTZCtrlRequest) error {
-	hasStopAfter := req.Duration > 0
+func (s *CommandService) requestRemoteControl(ctx context.Context, camera *db.Camera, req *PTZCtrlRequest) error {
+	if req.Duration < 0 {
+		return custerror.FormatInvalidArgument("duration must not be negative, got %v", req.Duration)
+	}
 	client := s.hikvisionClient.PtzCtrl(&hikvision.Credentials{
 		Username: camera.Username,
 		Password: camera.Password,
 		Ip:       camera.Ip,
 	})
-	channelId := "1"
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	if req.Zoom != 0 || req.hasLens() {
+		if err := s.checkLensCapabilities(ctx, client, camera, channelId, req); err != nil {
+			return err
+		}
+	}
 	continuousOptions := &hikvision.PtzCtrlContinousOptions{
 		Pan:  req.Pan,
 		Tilt: req.Tilt,
+		Zoom: req.Zoom,
 	}
-	if hasStopAfter {
-		if err := s.doContinousWithStop(ctx, client, &hikvision.PtzCtrlContinousWithResetRequest{
-			ChannelId:  channelId,
-			Options:    continuousOptions,
-			ResetAfter: time.Second * time.Duration(req.Duration),
-		}); err != nil {
+	// a request without any axis set is a stop
+	if req.hasPTZ() || !req.hasLens() {
+		s.supersedeMoves(camera, channelId)
+		pan, tilt, err := s.limitDirection(ctx, client, camera, channelId, req.Pan, req.Tilt)
+		if err != nil {
 			return err
 		}
-	} else {
+		continuousOptions.Pan, continuousOptions.Tilt = pan, tilt
 		if err := s.doRawContinuous(ctx, client, &hikvision.PtzCtrlRawContinousRequest{
 			ChannelId: channelId,
 			Options:   continuousOptions,
 		}); err != nil {
 			return err
 		}
+		if *continuousOptions != (hikvision.PtzCtrlContinousOptions{}) {
+			s.motions.schedule(motionKeyOf(camera, channelId, motionAxesPTZ), req.stopAfter(), func(ctx context.Context) error {
+				return client.RawContinuous(ctx, &hikvision.PtzCtrlRawContinousRequest{
+					ChannelId: channelId,
+					Options:   &hikvision.PtzCtrlContinousOptions{},
+				})
+			})
+		}
+		s.watchLimits(client, camera, channelId, *continuousOptions, req.stopAfter())
+	}
+	if req.hasLens() {
+		if err := s.doLens(ctx, client, camera, channelId, req.Focus, req.Iris, req.stopAfter()); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (s *CommandService) doRawContinuous(
+// cachedCapabilities retrieves the capabilities of the channel once, they do not
+// change while the camera is managed and joystick moves should not wait for them
+func (s *CommandService) cachedCapabilities(ctx context.Context, client hikvision.PtzApiClientInterface, camera *db.Camera, channelId string) (*hikvision.PTZChannelCapabilities, error) {
+	key := fmt.Sprintf("%s/%s", camera.Ip, channelId)
+	s.capabilitiesMu.Lock()
+	capabilities, found := s.capabilities[key]
+	s.capabilitiesMu.Unlock()
+	if found {
+		return capabilities, nil
+	}
+	capabilities, err := client.Capabilities(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve PTZ capabilities",
+			zap.Error(err))
+		return nil, err
+	}
+	s.capabilitiesMu.Lock()
+	s.capabilities[key] = capabilities
+	s.capabilitiesMu.Unlock()
+	return capabilities, nil
+}
+
+func (s *CommandService) checkLensCapabilities(
 	ctx context.Context,
 	client hikvision.PtzApiClientInterface,
-	options *hikvision.PtzCtrlRawContinousRequest) error {
-	if err := client.RawContinuous(ctx, options); err != nil {
+	camera *db.Camera,
+	channelId string,
+	req *PTZCtrlRequest) error {
+	capabilities, err := s.cachedCapabilities(ctx, client, camera, channelId)
+	if err != nil {
 		return err
 	}
+	if req.Zoom != 0 && !capabilities.SupportsContinuousZoom() {
+		return custerror.FormatInvalidArgument("zoom is not supported by this channel")
+	}
+	if req.hasLens() && !capabilities.SupportsLensControl() {
+		return custerror.FormatInvalidArgument("focus and iris are not supported by this channel")
+	}
 	return nil
 }
 
-func (s *CommandService) doContinousWithStop(
+func (s *CommandService) doLens(
 	ctx context.Context,
 	client hikvision.PtzApiClientInterface,
-	options *hikvision.PtzCtrlContinousWithResetRequest) error {
-	if err := client.ContinousWithReset(ctx, options); err != nil {
+	camera *db.Camera,
+	channelId string,
+	focus int,
+	iris int,
+	stopAfter time.Duration) error {
+	focusKey := motionKeyOf(camera, channelId, motionAxisFocus)
+	irisKey := motionKeyOf(camera, channelId, motionAxisIris)
+	if focus != 0 {
+		s.motions.supersede(focusKey)
+	}
+	if iris != 0 {
+		s.motions.supersede(irisKey)
+	}
+	if err := sendLens(ctx, client, channelId, focus, iris, focus != 0, iris != 0); err != nil {
 		return err
 	}
+	// a zero speed is sent only for the axes that were started
+	if focus != 0 {
+		s.motions.schedule(focusKey, stopAfter, func(ctx context.Context) error {
+			return sendLens(ctx, client, channelId, 0, 0, true, false)
+		})
+	}
+	if iris != 0 {
+		s.motions.schedule(irisKey, stopAfter, func(ctx context.Context) error {
+			return sendLens(ctx, client, channelId, 0, 0, false, true)
+		})
+	}
+	return nil
+}
+
+func sendLens(
+	ctx context.Context,
+	client hikvision.PtzApiClientInterface,
+	channelId string,
+	focus int,
+	iris int,
+	withFocus bool,
+	withIris bool) error {
+	if withFocus {
+		if err := client.Focus(ctx, &hikvision.PtzCtrlFocusRequest{
+			ChannelId: channelId,
+			Options:   &hikvision.PtzCtrlFocusOptions{Focus: focus},
+		}); err != nil {
+			return err
+		}
+	}
+	if withIris {
+		if err := client.Iris(ctx, &hikvision.PtzCtrlIrisRequest{
+			ChannelId: channelId,
+			Options:   &hikvision.PtzCtrlIrisOptions{Iris: iris},
+		}); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-type PTZStatusResponse struct {
-	Moving bool `json:"moving"`
+func (s *CommandService) doRawContinuous(
+	ctx context.Context,
+	client hikvision.PtzApiClientInterface,
+	options *hikvision.PtzCtrlRawContinousRequest) error {
+	if err := client.RawContinuous(ctx, options); err != nil {
+		return err
+	}
+	return nil
 }
 
-func (s *CommandService) PTZStatus(ctx context.Context, camera *db.Camera, req *hikvision.PtzCtrlStatusRequest) (*PTZStatusResponse, error) {
+func (s *CommandService) PTZRelative(ctx context.Context, camera *db.Camera, req *hikvision.PTZCtrlRelativeRequest) error {
 	ptzCtrl := s.hikvisionClient.PtzCtrl(&hikvision.Credentials{
 		Username: camera.Username,
 		Password: camera.Password,
 		Ip:       camera.Ip,
 	})
+	if err := s.claimPTZ(ctx, camera); err != nil {
+		return err
+	}
+	req.ChannelId = s.channelIdOf(camera, req.ChannelId)
+	s.supersedeMoves(camera, req.ChannelId)
+	if err := s.limitRelative(ctx, ptzCtrl, camera, req); err != nil {
+		return err
+	}
+	if err := ptzCtrl.Relative(ctx, req); err != nil {
+		return err
+	}
+	return nil
+}
+
+type PTZAbsoluteRequest struct {
+	hikvision.AbsoluteHigh
+	ChannelId string `json:"channelId,omitempty"`
+}
+
+func (s *CommandService) PTZAbsolute(ctx context.Context, camera *db.Camera, req *PTZAbsoluteRequest) error {
+	logger.SInfo("requested PTZ absolute positioning",
+		zap.String("camera_id", camera.CameraId),
+		zap.Reflect("position", req))
+	client := s.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	capabilities, err := client.Capabilities(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve PTZ capabilities",
+			zap.Error(err))
+		return err
+	}
+	if err := capabilities.ValidateAbsolute(&req.AbsoluteHigh); err != nil {
+		return err
+	}
+	position, err := s.limitAbsolute(camera, channelId, req.AbsoluteHigh)
+	if err != nil {
+		return err
+	}
+	if err := s.claimPTZ(ctx, camera); err != nil {
+		return err
+	}
+	s.supersedeMoves(camera, channelId)
+	if err := client.Absolute(ctx, &hikvision.PtzCtrlAbsoluteRequest{
+		ChannelId: channelId,
+		Position:  &position,
+	}); err != nil {
+		logger.SError("failed to perform PTZ absolute positioning",
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+type SnapshotRequest struct {
+	ChannelId string `json:"channelId,omitempty"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+}
+
+type SnapshotResponse struct {
+	CameraId    string `json:"cameraId"`
+	Base64Image string `json:"base64Image"`
+}
+
+func (s *CommandService) Snapshot(ctx context.Context, camera *db.Camera, req *SnapshotRequest) ([]byte, error) {
+	logger.SDebug("requested camera snapshot",
+		zap.String("camera_id", camera.CameraId))
+	jpegImg, err := s.hikvisionClient.
+		Streams(credentialsOf(camera)).
+		Snapshot(ctx, mainStreamOf(s.channelIdOf(camera, req.ChannelId)), req.Width, req.Height)
+	if err != nil {
+		logger.SError("failed to capture camera snapshot",
+			zap.Error(err))
+		return nil, err
+	}
+	return jpegImg, nil
+}
 
-	status, err := ptzCtrl.Status(ctx, req)
+const (
+	MainStream = 1
+	SubStream  = 2
+)
+
+// streamIdOf returns the streaming channel of a stream of a video
+// channel, ISAPI numbers streams as channel * 100 + stream
+func streamIdOf(channelId string, stream int) string {
+	if stream == 0 {
+		stream = MainStream
+	}
+	return fmt.Sprintf("%s%02d", channelId, stream)
+}
+
+func mainStreamOf(channelId string) string {
+	return streamIdOf(channelId, MainStream)
+}
+
+type ImageSettingsRequest struct {
+	ChannelId string `json:"channelId,omitempty"`
+	// Settings are applied before the resulting settings are returned,
+	// the settings are only read when nil
+	Settings *hikvision.ImageChannelPatch `json:"settings,omitempty"`
+}
+
+func (s *CommandService) ImageSettings(ctx context.Context, camera *db.Camera, req *ImageSettingsRequest) (*hikvision.ImageChannel, error) {
+	client := s.hikvisionClient.Image(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	if req.Settings != nil {
+		logger.SInfo("requested updating image settings",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("channel_id", channelId),
+			zap.Reflect("settings", req.Settings))
+		if err := client.UpdateChannel(ctx, channelId, req.Settings); err != nil {
+			logger.SError("failed to update image settings",
+				zap.Error(err))
+			return nil, err
+		}
+	}
+	settings, err := client.Channel(ctx, channelId)
 	if err != nil {
-		logger.SError("failed to retrieve PTZ status (1)", zap.Error(err))
+		logger.SError("failed to retrieve image settings",
+			zap.Error(err))
 		return nil, err
 	}
-	<-time.After(time.Millisecond * 200)
-	updatedStatus, err := ptzCtrl.Status(ctx, req)
+	return settings, nil
+}
+
+type StreamSettingsRequest struct {
+	ChannelId string `json:"channelId,omitempty"`
+	// Stream is 1 for the main stream and 2 for the sub stream
+	Stream   int                              `json:"stream,omitempty"`
+	Settings *hikvision.StreamingChannelPatch `json:"settings,omitempty"`
+}
+
+func (s *CommandService) StreamSettings(ctx context.Context, camera *db.Camera, req *StreamSettingsRequest) (*hikvision.StreamingChannel, error) {
+	client := s.hikvisionClient.Streams(credentialsOf(camera))
+	streamId := streamIdOf(s.channelIdOf(camera, req.ChannelId), req.Stream)
+	if req.Settings != nil {
+		logger.SInfo("requested updating stream settings",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("stream_id", streamId),
+			zap.Reflect("settings", req.Settings))
+		if err := client.UpdateChannel(ctx, streamId, req.Settings); err != nil {
+			logger.SError("failed to update stream settings",
+				zap.Error(err))
+			return nil, err
+		}
+	}
+	settings, err := client.Channel(ctx, streamId)
 	if err != nil {
-		logger.SError("failed to retrieve PTZ status (2)", zap.Error(err))
+		logger.SError("failed to retrieve stream settings",
+			zap.Error(err))
 		return nil, err
 	}
+	return settings, nil
+}
+
+type ChannelRequest struct {
+	ChannelId string `json:"channelId,omitempty"`
+}
+
+type CameraChannel struct {
+	Id        string   `json:"id"`
+	Name      string   `json:"name,omitempty"`
+	Enabled   bool     `json:"enabled"`
+	Ptz       bool     `json:"ptz"`
+	StreamIds []string `json:"streamIds"`
+}
 
-	azimuthDiff := 0.0
-	elevationDiff := 0.0
-	prev := status.AbsoluteHigh
-	updated := updatedStatus.AbsoluteHigh
+type ChannelsResponse struct {
+	CameraId string           `json:"cameraId"`
+	Channels []*CameraChannel `json:"channels"`
+}
 
-	azimuthDiff = math.Round(math.Abs(float64(updated.Azimuth-prev.Azimuth))*100) / 100
-	elevationDiff = math.Round(math.Abs(float64(updated.Elevation-prev.Elevation))*100) / 100
+// Channels discovers the video channels of the camera, an NVR or a
+// multi-sensor device reports one channel per sensor or attached camera
+func (s *CommandService) Channels(ctx context.Context, camera *db.Camera) (*ChannelsResponse, error) {
+	logger.SDebug("requested discovering camera channels",
+		zap.String("camera_id", camera.CameraId))
+	streams, err := s.hikvisionClient.
+		Streams(credentialsOf(camera)).
+		Channels(ctx, &hikvision.StreamChannelsRequest{})
+	if err != nil {
+		logger.SError("failed to list streaming channels",
+			zap.Error(err))
+		return nil, err
+	}
+	ptzChannels, err := s.hikvisionClient.
+		PtzCtrl(credentialsOf(camera)).
+		Channels(ctx)
+	if err != nil {
+		// cameras without PTZ do not expose the PTZ channel list
+		if !errors.Is(err, custerror.ErrorNotFound) {
+			logger.SError("failed to list PTZ channels",
+				zap.Error(err))
+			return nil, err
+		}
+		ptzChannels = &hikvision.PTZCtrlChannelsResponse{}
+	}
 
-	var resp PTZStatusResponse
-	if azimuthDiff > 0.0 {
-		resp.Moving = true
+	resp := &ChannelsResponse{CameraId: camera.CameraId}
+	byId := make(map[string]*CameraChannel)
+	channelOf := func(id string) *CameraChannel {
+		channel, found := byId[id]
+		if !found {
+			channel = &CameraChannel{Id: id, StreamIds: []string{}}
+			byId[id] = channel
+			resp.Channels = append(resp.Channels, channel)
+		}
+		return channel
+	}
+	for _, stream := range streams.StreamingChannel {
+		id := channelOfStreamId(stream.ID)
+		if stream.Video != nil && stream.Video.VideoInputChannelID != "" {
+			id = stream.Video.VideoInputChannelID
+		}
+		channel := channelOf(id)
+		if channel.Name == "" {
+			channel.Name = stream.ChannelName
+		}
+		channel.Enabled = channel.Enabled || stream.Enabled
+		channel.StreamIds = append(channel.StreamIds, stream.ID)
 	}
-	if elevationDiff > 0.0 {
-		resp.Moving = true
+	for _, ptz := range ptzChannels.Channels {
+		id := ptz.ID
+		if ptz.VideoInputID != "" {
+			id = ptz.VideoInputID
+		}
+		channel := channelOf(id)
+		channel.Ptz = ptz.Enabled
 	}
-	return &resp, nil
+	return resp, nil
 }
 
-func (s *CommandService) PTZRelative(ctx context.Context, camera *db.Camera, req *hikvision.PTZCtrlRelativeRequest) error {
-	ptzCtrl := s.hikvisionClient.PtzCtrl(&hikvision.Credentials{
+func credentialsOf(camera *db.Camera) *hikvision.Credentials {
+	return &hikvision.Credentials{
 		Username: camera.Username,
 		Password: camera.Password,
 		Ip:       camera.Ip,
-	})
-	if err := ptzCtrl.Relative(ctx, req); err != nil {
+	}
+}
+
+const (
+	PTZPresetActionList   = "list"
+	PTZPresetActionSet    = "set"
+	PTZPresetActionDelete = "delete"
+	PTZPresetActionGoto   = "goto"
+)
+
+type PTZPresetRequest struct {
+	Action    string `json:"action"`
+	ChannelId string `json:"channelId,omitempty"`
+	PresetId  int    `json:"presetId"`
+	// Name is saved along with the position, ISAPI cannot rename a preset
+	// without storing the current position in it, so renaming moves the preset
+	Name string `json:"name,omitempty"`
+}
+
+func (s *CommandService) PTZPresets(ctx context.Context, camera *db.Camera, channelId string) (*hikvision.PTZPresetList, error) {
+	logger.SDebug("requested listing PTZ presets",
+		zap.String("camera_id", camera.CameraId))
+	presets, err := s.hikvisionClient.
+		PtzCtrl(credentialsOf(camera)).
+		Presets(ctx, s.channelIdOf(camera, channelId))
+	if err != nil {
+		logger.SError("failed to list PTZ presets",
+			zap.Error(err))
+		return nil, err
+	}
+	return presets, nil
+}
+
+// PTZSetPreset stores the current position of the channel in the preset,
+// an existing preset is overwritten, including when only its name changes
+func (s *CommandService) PTZSetPreset(ctx context.Context, camera *db.Camera, req *PTZPresetRequest) error {
+	logger.SInfo("requested saving PTZ preset",
+		zap.String("camera_id", camera.CameraId),
+		zap.Int("preset_id", req.PresetId))
+	client := s.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	capabilities, err := client.Capabilities(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve PTZ capabilities",
+			zap.Error(err))
+		return err
+	}
+	preset := &hikvision.PTZPreset{
+		ID:         req.PresetId,
+		PresetName: req.Name,
+	}
+	if err := capabilities.ValidatePreset(preset); err != nil {
+		return err
+	}
+	if err := client.SetPreset(ctx, &hikvision.PtzCtrlSetPresetRequest{
+		ChannelId: channelId,
+		Preset:    preset,
+	}); err != nil {
+		logger.SError("failed to save PTZ preset",
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *CommandService) PTZDeletePreset(ctx context.Context, camera *db.Camera, channelId string, presetId int) error {
+	logger.SInfo("requested deleting PTZ preset",
+		zap.String("camera_id", camera.CameraId),
+		zap.Int("preset_id", presetId))
+	if err := s.hikvisionClient.
+		PtzCtrl(credentialsOf(camera)).
+		DeletePreset(ctx, &hikvision.PtzCtrlPresetRequest{
+			ChannelId: s.channelIdOf(camera, channelId),
+			PresetId:  presetId,
+		}); err != nil {
+		logger.SError("failed to delete PTZ preset",
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (s *CommandService) PTZGotoPreset(ctx context.Context, camera *db.Camera, channelId string, presetId int) error {
+	logger.SInfo("requested moving to PTZ preset",
+		zap.String("camera_id", camera.CameraId),
+		zap.Int("preset_id", presetId))
+	if err := s.claimPTZ(ctx, camera); err != nil {
+		return err
+	}
+	channelId = s.channelIdOf(camera, channelId)
+	s.supersedeMoves(camera, channelId)
+	if err := s.hikvisionClient.
+		PtzCtrl(credentialsOf(camera)).
+		GotoPreset(ctx, &hikvision.PtzCtrlPresetRequest{
+			ChannelId: channelId,
+			PresetId:  presetId,
+		}); err != nil {
+		logger.SError("failed to move to PTZ preset",
+			zap.Error(err))
 		return err
 	}
 	return nil
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+)
+
+// newTestCommandService runs the camera the service talks to on the handler
+func newTestCommandService(t *testing.T, handler http.Handler) (*CommandService, *db.Camera) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client, err := hikvision.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewCommandService(client, nil, nil)
+	t.Cleanup(service.Shutdown)
+	return service, &db.Camera{
+		CameraId: "camera-1",
+		Ip:       server.URL,
+		Username: "admin",
+		Password: "secret",
+	}
+}
+
+func TestCommandService_LensCapabilitiesCached(t *testing.T) {
+	var queries atomic.Int32
+	service, camera := newTestCommandService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/capabilities") {
+			queries.Add(1)
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<PTZChanelCap><ContinuousZoomSpace><ZRange><Min>-100</Min><Max>100</Max></ZRange></ContinuousZoomSpace></PTZChanelCap>`))
+		}
+	}))
+	for i := 0; i < 3; i++ {
+		if err := service.requestRemoteControl(context.Background(), camera, &PTZCtrlRequest{ChannelId: "1", Zoom: 50}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := queries.Load(); got != 1 {
+		t.Errorf("expected the capabilities to be retrieved once, got %d", got)
+	}
+	if err := service.requestRemoteControl(context.Background(), camera, &PTZCtrlRequest{ChannelId: "1", Focus: 50}); !errors.Is(err, custerror.ErrorInvalidArgument) {
+		t.Errorf("expected focus to be rejected from the cached capabilities, got %v", err)
+	}
+
+	service.ForgetCamera(camera)
+	if err := service.requestRemoteControl(context.Background(), camera, &PTZCtrlRequest{ChannelId: "1", Zoom: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if got := queries.Load(); got != 2 {
+		t.Errorf("expected the capabilities of a forgotten camera to be retrieved again, got %d", got)
+	}
+}
@@ -289,7 +289,7 @@ func (s *ControlPlaneService) GetOpenGateConfigurations(ctx context.Context, req
 	}
 }
 
-func (s *ControlPlaneService) GetCameraStreamSettings(ctx context.Context, req *web.GetStreamConfigurationsRequest) (*web.GetStreamConfigurationsResponse, error) {
+func (s *ControlPlaneService) GetCameraStreamSettings(ctx context.Context, req *web.GetStreamConfigurationsRequest) (*GetStreamConfigurationsResponse, error) {
 	path := s.baseUrl.JoinPath("/transcoders/streams")
 	q := path.Query()
 	aggr := strings.Join(req.CameraId, ",")
@@ -318,7 +318,7 @@ func (s *ControlPlaneService) GetCameraStreamSettings(ctx context.Context, req *
 		if err != nil {
 			return nil, custerror.FormatInternalError("unable to read response body: %s", err)
 		}
-		var resp web.GetStreamConfigurationsResponse
+		var resp GetStreamConfigurationsResponse
 		if err := json.Unmarshal(bodyBytes, &resp); err != nil {
 			return nil, err
 		}
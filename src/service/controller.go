@@ -6,28 +6,32 @@ import (
 	"sync"
 	"time"
 
-	"github.com/CE-Thesis-2023/backend/src/models/web"
 	"github.com/CE-Thesis-2023/ltd/src/internal/configs"
+	custff "github.com/CE-Thesis-2023/ltd/src/internal/ffmpeg"
 	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
 	"go.uber.org/zap"
 )
 
 type MediaController struct {
 	mu              sync.Mutex
-	ffmpegStreams   map[string]web.TranscoderStreamConfiguration
+	ffmpegStreams   map[string]StreamConfiguration
 	needConcilation []string
 	needRemoval     []string
 	running         map[string]*Process
 	mediaService    MediaServiceInterface
+
+	statsMu sync.Mutex
+	stats   map[string]*StreamStats
 }
 
 func NewMediaController(mediaService MediaServiceInterface) *MediaController {
 	return &MediaController{
-		ffmpegStreams:   make(map[string]web.TranscoderStreamConfiguration),
+		ffmpegStreams:   make(map[string]StreamConfiguration),
 		running:         make(map[string]*Process),
 		needConcilation: make([]string, 0),
 		needRemoval:     make([]string, 0),
 		mediaService:    mediaService,
+		stats:           make(map[string]*StreamStats),
 	}
 }
 
@@ -89,7 +93,7 @@ func (c *MediaController) cleanup() {
 	}
 }
 
-func (c *MediaController) Register(s web.TranscoderStreamConfiguration) (updated bool, err error) {
+func (c *MediaController) Register(s StreamConfiguration) (updated bool, err error) {
 	return c.register(s)
 }
 
@@ -113,6 +117,7 @@ func (c *MediaController) deregister(cameraId string) {
 	defer c.mu.Unlock()
 	c.markForRemoval(cameraId)
 	delete(c.ffmpegStreams, cameraId)
+	c.dropStats(cameraId)
 	logger.SDebug("deregistered stream",
 		zap.String("cameraId", cameraId))
 }
@@ -121,7 +126,10 @@ func (c *MediaController) markForRemoval(cameraId string) {
 	c.needRemoval = append(c.needRemoval, cameraId)
 }
 
-func (c *MediaController) register(s web.TranscoderStreamConfiguration) (updated bool, err error) {
+func (c *MediaController) register(s StreamConfiguration) (updated bool, err error) {
+	if err := s.validate(); err != nil {
+		return false, err
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	curr, found := c.ffmpegStreams[s.CameraId]
@@ -144,23 +152,9 @@ func (c *MediaController) register(s web.TranscoderStreamConfiguration) (updated
 	return true, nil
 }
 
-func (c *MediaController) needReconcile(old web.TranscoderStreamConfiguration, new web.TranscoderStreamConfiguration) bool {
-	if old.SourceUrl != new.SourceUrl {
-		return true
-	}
-	if old.PublishUrl != new.PublishUrl {
-		return true
-	}
-	if old.Fps != new.Fps {
-		return true
-	}
-	if old.Height != new.Width {
-		return true
-	}
-	if old.Width != new.Width {
-		return true
-	}
-	return false
+// needReconcile restarts the stream on any change of its source, destination or encoding
+func (c *MediaController) needReconcile(old StreamConfiguration, new StreamConfiguration) bool {
+	return !old.Equal(new)
 }
 
 func (c *MediaController) markForReconcile(cameraId string) {
@@ -199,7 +193,12 @@ func (c *MediaController) startOrRestart(cameraId string) error {
 		cameraId: cameraId,
 		configs:  &s,
 	}
+	p.onProgress = func(progress *custff.Progress) {
+		c.updateStats(cameraId, p, progress)
+	}
+	c.trackStats(cameraId, p)
 	go func(cameraId string) {
+		defer c.exitedStats(cameraId, p)
 		if err := c.mediaService.StartTranscodingStream(context.Background(), p); err != nil {
 			if c.Exists(cameraId) {
 				c.mu.Lock()
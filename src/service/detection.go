@@ -0,0 +1,260 @@
+package service
+
+import (
+	"context"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	maxSensitivity      = 100
+	minFieldRegionSides = 3
+	maxFieldRegionSides = 10
+)
+
+type MotionDetectionSettings struct {
+	Enabled     *bool `json:"enabled,omitempty"`
+	Sensitivity *int  `json:"sensitivity,omitempty"`
+	// Grid is indexed by row then column, from the top-left of the picture
+	Grid [][]bool `json:"grid,omitempty"`
+}
+
+type MotionDetectionRequest struct {
+	ChannelId string                   `json:"channelId,omitempty"`
+	Settings  *MotionDetectionSettings `json:"settings,omitempty"`
+}
+
+type MotionDetectionResponse struct {
+	CameraId    string   `json:"cameraId"`
+	ChannelId   string   `json:"channelId"`
+	Enabled     bool     `json:"enabled"`
+	Sensitivity int      `json:"sensitivity"`
+	Rows        int      `json:"rows"`
+	Columns     int      `json:"columns"`
+	Grid        [][]bool `json:"grid"`
+}
+
+// MotionDetection applies the settings when given and returns the motion detection grid
+func (s *CommandService) MotionDetection(ctx context.Context, camera *db.Camera, req *MotionDetectionRequest) (*MotionDetectionResponse, error) {
+	client := s.hikvisionClient.Smart(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	current, err := client.MotionDetection(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve motion detection",
+			zap.Error(err))
+		return nil, err
+	}
+
+	if req.Settings != nil {
+		logger.SInfo("requested updating motion detection",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("channel_id", channelId))
+		patch := &hikvision.MotionDetectionPatch{
+			Enabled:          req.Settings.Enabled,
+			SensitivityLevel: req.Settings.Sensitivity,
+		}
+		if err := validateSensitivity(req.Settings.Sensitivity); err != nil {
+			return nil, err
+		}
+		if req.Settings.Grid != nil {
+			if current.Grid == nil {
+				return nil, custerror.FormatUnimplemented("camera does not support grid motion detection")
+			}
+			gridMap, err := hikvision.GridMapOf(current.Grid, req.Settings.Grid)
+			if err != nil {
+				return nil, err
+			}
+			patch.GridMap = &gridMap
+		}
+		if err := client.SetMotionDetection(ctx, channelId, patch); err != nil {
+			logger.SError("failed to update motion detection",
+				zap.Error(err))
+			return nil, err
+		}
+		if current, err = client.MotionDetection(ctx, channelId); err != nil {
+			return nil, err
+		}
+	}
+
+	cells, err := current.Cells()
+	if err != nil {
+		return nil, err
+	}
+	resp := &MotionDetectionResponse{
+		CameraId:  camera.CameraId,
+		ChannelId: channelId,
+		Enabled:   current.Enabled,
+		Grid:      cells,
+	}
+	if current.Grid != nil {
+		resp.Rows = current.Grid.RowGranularity
+		resp.Columns = current.Grid.ColumnGranularity
+	}
+	if current.Layout != nil {
+		resp.Sensitivity = current.Layout.SensitivityLevel
+	}
+	return resp, nil
+}
+
+type DetectionLine struct {
+	Id          int  `json:"id"`
+	Enabled     bool `json:"enabled"`
+	Sensitivity int  `json:"sensitivity"`
+	// Direction is any, left-right or right-left
+	Direction string                    `json:"direction"`
+	Start     hikvision.NormalizedPoint `json:"start"`
+	End       hikvision.NormalizedPoint `json:"end"`
+}
+
+type LineDetectionSettings struct {
+	Enabled bool            `json:"enabled"`
+	Lines   []DetectionLine `json:"lines"`
+}
+
+type LineDetectionRequest struct {
+	ChannelId string                 `json:"channelId,omitempty"`
+	Settings  *LineDetectionSettings `json:"settings,omitempty"`
+}
+
+// LineDetection replaces the line crossing lines when settings are given
+// and returns the lines configured on the camera
+func (s *CommandService) LineDetection(ctx context.Context, camera *db.Camera, req *LineDetectionRequest) (*LineDetectionSettings, error) {
+	client := s.hikvisionClient.Smart(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	if req.Settings != nil {
+		logger.SInfo("requested updating line detection",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("channel_id", channelId))
+		detection := &hikvision.LineDetection{
+			Enabled: req.Settings.Enabled,
+		}
+		for _, line := range req.Settings.Lines {
+			if err := validateSensitivity(&line.Sensitivity); err != nil {
+				return nil, err
+			}
+			detection.LineItem = append(detection.LineItem, &hikvision.LineItem{
+				ID:                   line.Id,
+				Enabled:              line.Enabled,
+				SensitivityLevel:     line.Sensitivity,
+				DirectionSensitivity: line.Direction,
+				Coordinates:          hikvision.RegionOf([]hikvision.NormalizedPoint{line.Start, line.End}),
+			})
+		}
+		if err := client.SetLineDetection(ctx, channelId, detection); err != nil {
+			logger.SError("failed to update line detection",
+				zap.Error(err))
+			return nil, err
+		}
+	}
+
+	detection, err := client.LineDetection(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve line detection",
+			zap.Error(err))
+		return nil, err
+	}
+	resp := &LineDetectionSettings{
+		Enabled: detection.Enabled,
+		Lines:   []DetectionLine{},
+	}
+	for _, item := range detection.LineItem {
+		line := DetectionLine{
+			Id:          item.ID,
+			Enabled:     item.Enabled,
+			Sensitivity: item.SensitivityLevel,
+			Direction:   item.DirectionSensitivity,
+		}
+		if points := hikvision.NormalizedOf(item.Coordinates); len(points) == 2 {
+			line.Start, line.End = points[0], points[1]
+		}
+		resp.Lines = append(resp.Lines, line)
+	}
+	return resp, nil
+}
+
+type DetectionField struct {
+	Id          int  `json:"id"`
+	Enabled     bool `json:"enabled"`
+	Sensitivity int  `json:"sensitivity"`
+	// TimeThreshold is how long in seconds a target stays in the field before alerting
+	TimeThreshold int                         `json:"timeThreshold"`
+	Region        []hikvision.NormalizedPoint `json:"region"`
+}
+
+type FieldDetectionSettings struct {
+	Enabled bool             `json:"enabled"`
+	Fields  []DetectionField `json:"fields"`
+}
+
+type FieldDetectionRequest struct {
+	ChannelId string                  `json:"channelId,omitempty"`
+	Settings  *FieldDetectionSettings `json:"settings,omitempty"`
+}
+
+// FieldDetection replaces the intrusion fields when settings are given
+// and returns the fields configured on the camera
+func (s *CommandService) FieldDetection(ctx context.Context, camera *db.Camera, req *FieldDetectionRequest) (*FieldDetectionSettings, error) {
+	client := s.hikvisionClient.Smart(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	if req.Settings != nil {
+		logger.SInfo("requested updating field detection",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("channel_id", channelId))
+		detection := &hikvision.FieldDetection{
+			Enabled: req.Settings.Enabled,
+		}
+		for _, field := range req.Settings.Fields {
+			if err := validateSensitivity(&field.Sensitivity); err != nil {
+				return nil, err
+			}
+			if len(field.Region) < minFieldRegionSides || len(field.Region) > maxFieldRegionSides {
+				return nil, custerror.FormatInvalidArgument("field %d must have between %d and %d points, got %d",
+					field.Id, minFieldRegionSides, maxFieldRegionSides, len(field.Region))
+			}
+			detection.Regions = append(detection.Regions, &hikvision.FieldDetectionRegion{
+				ID:                field.Id,
+				Enabled:           field.Enabled,
+				SensitivityLevel:  field.Sensitivity,
+				TimeThreshold:     field.TimeThreshold,
+				RegionCoordinates: hikvision.RegionOf(field.Region),
+			})
+		}
+		if err := client.SetFieldDetection(ctx, channelId, detection); err != nil {
+			logger.SError("failed to update field detection",
+				zap.Error(err))
+			return nil, err
+		}
+	}
+
+	detection, err := client.FieldDetection(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve field detection",
+			zap.Error(err))
+		return nil, err
+	}
+	resp := &FieldDetectionSettings{
+		Enabled: detection.Enabled,
+		Fields:  []DetectionField{},
+	}
+	for _, region := range detection.Regions {
+		resp.Fields = append(resp.Fields, DetectionField{
+			Id:            region.ID,
+			Enabled:       region.Enabled,
+			Sensitivity:   region.SensitivityLevel,
+			TimeThreshold: region.TimeThreshold,
+			Region:        hikvision.NormalizedOf(region.RegionCoordinates),
+		})
+	}
+	return resp, nil
+}
+
+func validateSensitivity(sensitivity *int) error {
+	if sensitivity != nil && (*sensitivity < 0 || *sensitivity > maxSensitivity) {
+		return custerror.FormatInvalidArgument("sensitivity must be between 0 and %d, got %d", maxSensitivity, *sensitivity)
+	}
+	return nil
+}
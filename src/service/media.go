@@ -2,20 +2,24 @@ package service
 
 import (
 	"context"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sync"
 	"syscall"
+	"time"
 
-	"github.com/CE-Thesis-2023/backend/src/models/web"
 	"github.com/CE-Thesis-2023/ltd/src/internal/configs"
 	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
 	custff "github.com/CE-Thesis-2023/ltd/src/internal/ffmpeg"
+	custprobe "github.com/CE-Thesis-2023/ltd/src/internal/ffprobe"
 	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
 	"go.uber.org/zap"
 )
 
+const sourceProbeTimeout = 10 * time.Second
+
 type mediaService struct {
 }
 
@@ -26,7 +30,9 @@ func NewMediaService() MediaServiceInterface {
 type Process struct {
 	proc     *exec.Cmd
 	cameraId string
-	configs  *web.TranscoderStreamConfiguration
+	configs  *StreamConfiguration
+	// onProgress receives the progress FFmpeg reports while the stream runs
+	onProgress func(*custff.Progress)
 }
 
 type OpenGateProcess struct {
@@ -49,25 +55,42 @@ func (s *mediaService) StartTranscodingStream(ctx context.Context, p *Process) e
 	logger.SInfo("requested starting to perform RTSP to SRT transcoding stream",
 		zap.String("request", p.cameraId))
 
-	sourceUrl := p.configs.SourceUrl
-	logger.SDebug("RTSP source stream URL",
-		zap.String("source", sourceUrl))
-
-	destinationUrl := p.configs.PublishUrl
-	logger.SDebug("SRT destination stream URL",
-		zap.String("destination", destinationUrl))
-
-	command := s.buildFfmpegRestreamingCommand(ctx, sourceUrl, destinationUrl)
-	logger.SDebug("transcoding stream FFmpeg command",
-		zap.String("command", command.String()))
+	settings := p.configs.withDefaults(&configs.Get().Ffmpeg)
+	passthrough := s.canPassthrough(ctx, p.cameraId, &settings)
+	command := s.buildFfmpegRestreamingCommand(ctx, &settings, passthrough, p.onProgress != nil)
 	if command == nil {
 		logger.SError("failed to build FFmpeg command")
 		return custerror.FormatInternalError("failed to build FFmpeg os/exec command")
 	}
 	p.proc = command
 
-	logger.SInfo("starting transcoding stream")
-	if err := command.Run(); err != nil {
+	var progress io.ReadCloser
+	if p.onProgress != nil {
+		var err error
+		progress, err = command.StdoutPipe()
+		if err != nil {
+			logger.SError("failed to pipe FFmpeg progress", zap.Error(err))
+			return err
+		}
+	}
+
+	logger.SInfo("starting transcoding stream",
+		zap.Bool("passthrough", passthrough))
+	if err := command.Start(); err != nil {
+		logger.SError("failed to start FFmpeg process", zap.Error(err))
+		return err
+	}
+	if progress != nil {
+		// the pipe has to be drained before waiting, it is closed once FFmpeg exits
+		if err := custff.ReadProgress(progress, p.onProgress); err != nil {
+			logger.SError("failed to read FFmpeg progress",
+				zap.String("camera_id", p.cameraId),
+				zap.Error(err))
+			// keep draining so FFmpeg never blocks on a full pipe
+			io.Copy(io.Discard, progress)
+		}
+	}
+	if err := command.Wait(); err != nil {
 		logger.SError("failed to run FFmpeg process", zap.Error(err))
 		return err
 	}
@@ -75,55 +98,99 @@ func (s *mediaService) StartTranscodingStream(ctx context.Context, p *Process) e
 	return nil
 }
 
-func (s *mediaService) buildFfmpegRestreamingCommand(ctx context.Context, sourceUrl string, destinationUrl string) *exec.Cmd {
+// canPassthrough probes the source, a source already encoded the way the stream
+// is configured is remuxed rather than transcoded
+func (s *mediaService) canPassthrough(ctx context.Context, cameraId string, settings *StreamConfiguration) bool {
+	result, err := newProber().Probe(ctx, settings.SourceUrl)
+	if err != nil {
+		logger.SError("failed to probe source stream, transcoding it",
+			zap.String("camera_id", cameraId),
+			zap.Error(err))
+		return false
+	}
+	logger.SDebug("probed source stream",
+		zap.String("camera_id", cameraId),
+		zap.Reflect("streams", result.Streams))
+	return sourceMatches(result, settings)
+}
+
+// sourceMatches tells whether the video of the source can be copied, its audio is
+// encoded either way so it is not looked at
+func sourceMatches(result *custprobe.ProbeResult, settings *StreamConfiguration) bool {
+	video := result.Video()
+	if video == nil {
+		return false
+	}
+	return settings.matches(video)
+}
+
+// ffprobeBinaryPath looks ffprobe up next to the configured FFmpeg binary, it ships with it
+func ffprobeBinaryPath(ffmpegPath string) string {
+	if ffmpegPath == "" {
+		return "ffprobe"
+	}
+	return filepath.Join(filepath.Dir(ffmpegPath), "ffprobe")
+}
+
+func newProber() *custprobe.Prober {
+	var binPath string
+	if configs := configs.Get(); configs != nil {
+		binPath = configs.Ffmpeg.BinaryPath
+	}
+	return custprobe.NewProber(
+		custprobe.WithBinPath(ffprobeBinaryPath(binPath)),
+		custprobe.WithTimeout(sourceProbeTimeout))
+}
+
+func (s *mediaService) buildFfmpegRestreamingCommand(ctx context.Context, settings *StreamConfiguration, passthrough bool, progress bool) *exec.Cmd {
 	configs := configs.Get()
 	var binPath string
 	var err error
-	if configs.Ffmpeg.BinaryPath != "" {
+	if configs != nil && configs.Ffmpeg.BinaryPath != "" {
 		binPath, err = filepath.Abs(configs.Ffmpeg.BinaryPath)
 		if err != nil {
 			logger.SFatal("missing FFmpeg binary path", zap.Error(err))
 			return nil
 		}
 	}
+	outputArguments := settings.outputArguments()
+	if passthrough {
+		outputArguments = []custff.Argument{custff.Arg("f", settings.Container)}
+	}
 
 	cmd := custff.NewFFmpegCommand()
-	cmd.WithSourceUrl(sourceUrl).
+	cmd.WithSourceUrl(settings.SourceUrl).
 		WithBinPath(binPath).
 		WithGlobalArguments(
-			map[string]string{
-				"hide_banner": "",
-				"loglevel":    "info",
-				"threads":     "2",
-			},
+			custff.Flag("hide_banner"),
+			custff.Arg("loglevel", "info"),
+			custff.Arg("threads", "2"),
 		).
-		WithInputArguments(map[string]string{
-			"avoid_negative_ts":           "make_zero",
-			"fflags":                      "+genpts+discardcorrupt",
-			"rtsp_transport":              "tcp",
-			"use_wallclock_as_timestamps": "1",
-			"timeout":                     "5000000",
-		}).
-		WithDestinationUrl(destinationUrl).
-		WithOutputArguments(map[string]string{
-			"f":        "mpegts",
-			"c:v":      "libx264",
-			"preset:v": "faster",
-			"tune:v":   "zerolatency",
-		}).
-		WithScale(20, 1280, 720).
-		WithHardwareAccelerationType(custff.CPU)
-
-	execCmd, err := cmd.String()
+		WithInputArguments(
+			custff.Arg("avoid_negative_ts", "make_zero"),
+			custff.Arg("fflags", "+genpts+discardcorrupt"),
+			custff.Arg("rtsp_transport", "tcp"),
+			custff.Arg("use_wallclock_as_timestamps", "1"),
+			custff.Arg("timeout", "5000000"),
+		).
+		WithDestinationUrl(settings.PublishUrl).
+		WithOutputArguments(outputArguments...).
+		WithScale(settings.Fps, settings.Width, settings.Height).
+		WithHardwareAccelerationType(custff.FFmpegHardwareAccelerationType(settings.HardwareAcceleration)).
+		WithStreamCopy(passthrough)
+	if progress {
+		cmd.WithProgress(streamStatsPeriod)
+	}
+
+	execCmd, err := cmd.Command(ctx)
 	if err != nil {
 		logger.SError("failed to build FFmpeg command", zap.Error(err))
 		return nil
 	}
 
-	logger.SDebug("FFmpeg command", zap.String("command", execCmd))
+	logger.SDebug("FFmpeg command", zap.Stringer("command", cmd))
 
-	return exec.CommandContext(ctx,
-		"/bin/bash", "-c", execCmd)
+	return execCmd
 }
 
 func (s *mediaService) EndTranscodingStream(ctx context.Context, p *Process) error {
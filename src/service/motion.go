@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+// axis groups moved independently, a move only supersedes the move of its own group
+const (
+	motionAxesPTZ   = "ptz"
+	motionAxisFocus = "focus"
+	motionAxisIris  = "iris"
+)
+
+const (
+	motionStopAttempts = 3
+	motionStopBackoff  = 200 * time.Millisecond
+	motionStopTimeout  = 2 * time.Second
+)
+
+type motionStop func(ctx context.Context) error
+
+type scheduledMotion struct {
+	// timer is nil for moves that run until stopped
+	timer *time.Timer
+	stop  motionStop
+}
+
+// motionScheduler keeps the stop of the move running on each camera axis group,
+// a new move supersedes the stop of the previous one so an earlier timer
+// never cuts a later move short
+type motionScheduler struct {
+	mu      sync.Mutex
+	motions map[string]*scheduledMotion
+	wg      sync.WaitGroup
+	closed  bool
+}
+
+func newMotionScheduler() *motionScheduler {
+	return &motionScheduler{
+		motions: map[string]*scheduledMotion{},
+	}
+}
+
+// schedule records the move of the key, its stop runs after the given duration
+// or, for a zero duration, only when the move is interrupted
+func (m *motionScheduler) schedule(key string, after time.Duration, stop motionStop) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		// the move slipped in during shutdown, nothing would stop it later
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			runMotionStop(key, stop)
+		}()
+		return
+	}
+	m.supersedeLocked(key)
+	motion := &scheduledMotion{stop: stop}
+	if after > 0 {
+		m.wg.Add(1)
+		motion.timer = time.AfterFunc(after, func() {
+			defer m.wg.Done()
+			if m.take(key, motion) {
+				runMotionStop(key, stop)
+			}
+		})
+	}
+	m.motions[key] = motion
+}
+
+// supersede forgets the pending stop of the key, the move that replaces it takes over the axes
+func (m *motionScheduler) supersede(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.supersedeLocked(key)
+}
+
+func (m *motionScheduler) supersedeLocked(key string) {
+	motion, found := m.motions[key]
+	if !found {
+		return
+	}
+	delete(m.motions, key)
+	if motion.timer != nil && motion.timer.Stop() {
+		m.wg.Done()
+	}
+}
+
+// take removes the motion if it is still the current one of the key
+func (m *motionScheduler) take(key string, motion *scheduledMotion) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.motions[key] != motion {
+		return false
+	}
+	delete(m.motions, key)
+	return true
+}
+
+// takeMatching removes the motions whose keys start with the prefix, stopping their timers
+func (m *motionScheduler) takeMatching(prefix string) map[string]motionStop {
+	stops := map[string]motionStop{}
+	for key, motion := range m.motions {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if motion.timer != nil && motion.timer.Stop() {
+			m.wg.Done()
+		}
+		delete(m.motions, key)
+		stops[key] = motion.stop
+	}
+	return stops
+}
+
+// stopNow stops the moves whose keys start with the prefix right away
+func (m *motionScheduler) stopNow(prefix string) {
+	m.mu.Lock()
+	stops := m.takeMatching(prefix)
+	m.mu.Unlock()
+	runMotionStops(stops)
+}
+
+// shutdown stops every move still running and waits for the pending timers
+func (m *motionScheduler) shutdown() {
+	m.mu.Lock()
+	m.closed = true
+	stops := m.takeMatching("")
+	m.mu.Unlock()
+	runMotionStops(stops)
+	m.wg.Wait()
+}
+
+func runMotionStops(stops map[string]motionStop) {
+	var wg sync.WaitGroup
+	for key, stop := range stops {
+		wg.Add(1)
+		go func(key string, stop motionStop) {
+			defer wg.Done()
+			runMotionStop(key, stop)
+		}(key, stop)
+	}
+	wg.Wait()
+}
+
+// runMotionStop retries the stop, a camera left moving keeps turning until someone notices
+func runMotionStop(key string, stop motionStop) {
+	var err error
+	for attempt := 1; attempt <= motionStopAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), motionStopTimeout)
+		err = stop(ctx)
+		cancel()
+		if err == nil {
+			logger.SDebug("stopped PTZ move",
+				zap.String("key", key))
+			return
+		}
+		logger.SError("failed to stop PTZ move",
+			zap.String("key", key),
+			zap.Int("attempt", attempt),
+			zap.Error(err))
+		time.Sleep(motionStopBackoff * time.Duration(attempt))
+	}
+}
+
+func motionKeyOf(camera *db.Camera, channelId string, axes string) string {
+	return fmt.Sprintf("%s/%s", ptzKeyOf(camera, channelId), axes)
+}
+
+// supersedeMoves hands the channel over to a positioning move, a pending stop
+// of the previous continuous move would otherwise cut it short
+func (s *CommandService) supersedeMoves(camera *db.Camera, channelId string) {
+	s.stopLimitWatcher(camera, channelId)
+	s.motions.supersede(motionKeyOf(camera, channelId, motionAxesPTZ))
+}
+
+// stopMoves stops every move still running on the camera
+func (s *CommandService) stopMoves(camera *db.Camera) {
+	s.motions.stopNow(camera.CameraId + "/")
+}
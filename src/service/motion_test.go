@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+)
+
+func countingStop(calls *int32, failures int32) motionStop {
+	return func(ctx context.Context) error {
+		if atomic.AddInt32(calls, 1) <= failures {
+			return errors.New("camera unreachable")
+		}
+		return nil
+	}
+}
+
+func TestMotionScheduler_Supersede(t *testing.T) {
+	m := newMotionScheduler()
+	var first, second int32
+	m.schedule("camera-1/1/ptz", 20*time.Millisecond, countingStop(&first, 0))
+	m.schedule("camera-1/1/ptz", time.Hour, countingStop(&second, 0))
+
+	time.Sleep(60 * time.Millisecond)
+	if atomic.LoadInt32(&first) != 0 {
+		t.Errorf("expected the superseded stop not to run")
+	}
+	if atomic.LoadInt32(&second) != 0 {
+		t.Errorf("expected the current stop to wait for its timer")
+	}
+
+	m.shutdown()
+	if atomic.LoadInt32(&second) != 1 {
+		t.Errorf("expected shutdown to stop the current move once, got %d", second)
+	}
+}
+
+func TestMotionScheduler_Timer(t *testing.T) {
+	m := newMotionScheduler()
+	var calls int32
+	m.schedule("camera-1/1/focus", 10*time.Millisecond, countingStop(&calls, 0))
+	time.Sleep(50 * time.Millisecond)
+	m.shutdown()
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("expected the timer to stop the move once, got %d", calls)
+	}
+}
+
+func TestMotionScheduler_Retry(t *testing.T) {
+	m := newMotionScheduler()
+	var calls int32
+	m.schedule("camera-1/1/ptz", 0, countingStop(&calls, 2))
+	m.stopNow("camera-1/")
+	if atomic.LoadInt32(&calls) != motionStopAttempts {
+		t.Errorf("expected %d attempts, got %d", motionStopAttempts, calls)
+	}
+}
+
+func TestPTZLease_TakeoverStopsMoves(t *testing.T) {
+	s := NewCommandService(nil, nil, nil)
+	camera := &db.Camera{CameraId: "camera-1"}
+	var moved, other int32
+	s.motions.schedule(motionKeyOf(camera, "1", motionAxesPTZ), 0, countingStop(&moved, 0))
+	s.motions.schedule(motionKeyOf(&db.Camera{CameraId: "camera-2"}, "1", motionAxesPTZ), 0, countingStop(&other, 0))
+
+	tracker := WithPTZClient(context.Background(), PTZClientTracker)
+	if err := s.claimPTZ(tracker, camera); err != nil {
+		t.Fatalf("expected the tracker to take a free camera, got %v", err)
+	}
+	if atomic.LoadInt32(&moved) != 0 {
+		t.Errorf("expected a free camera to keep moving")
+	}
+	if err := s.claimPTZ(WithPTZClient(context.Background(), PTZClientOperator), camera); err != nil {
+		t.Fatalf("expected the operator to take over, got %v", err)
+	}
+	if atomic.LoadInt32(&moved) != 1 {
+		t.Errorf("expected the takeover to stop the moves of the tracker, got %d", moved)
+	}
+	if atomic.LoadInt32(&other) != 0 {
+		t.Errorf("expected other cameras to keep moving")
+	}
+}
+
+func TestPTZCtrlRequest_SubSecondDuration(t *testing.T) {
+	var req PTZCtrlRequest
+	if err := json.Unmarshal([]byte(`{"cameraId":"camera-1","pan":10,"duration":0.25}`), &req); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	if got := req.stopAfter(); got != 250*time.Millisecond {
+		t.Errorf("expected a 250ms move, got %s", got)
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+const privacyMaskSides = 4
+
+type PrivacyMaskArea struct {
+	Id      int                         `json:"id"`
+	Enabled bool                        `json:"enabled"`
+	Region  []hikvision.NormalizedPoint `json:"region"`
+}
+
+type PrivacyMaskSettings struct {
+	Enabled bool              `json:"enabled"`
+	Masks   []PrivacyMaskArea `json:"masks"`
+}
+
+type PrivacyMaskRequest struct {
+	ChannelId string               `json:"channelId,omitempty"`
+	Settings  *PrivacyMaskSettings `json:"settings,omitempty"`
+}
+
+// PrivacyMask replaces the privacy masks when settings are given
+// and returns the masks configured on the camera
+func (s *CommandService) PrivacyMask(ctx context.Context, camera *db.Camera, req *PrivacyMaskRequest) (*PrivacyMaskSettings, error) {
+	client := s.hikvisionClient.System(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	current, err := client.PrivacyMask(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve privacy mask",
+			zap.Error(err))
+		return nil, err
+	}
+	screen := current.NormalizedScreenSize()
+
+	if req.Settings != nil {
+		logger.SInfo("requested updating privacy mask",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("channel_id", channelId))
+		mask := &hikvision.PrivacyMask{
+			Enabled: req.Settings.Enabled,
+			Regions: []*hikvision.PrivacyMaskRegion{},
+		}
+		for _, area := range req.Settings.Masks {
+			if len(area.Region) != privacyMaskSides {
+				return nil, custerror.FormatInvalidArgument("privacy mask %d must have %d points, got %d",
+					area.Id, privacyMaskSides, len(area.Region))
+			}
+			region := &hikvision.PrivacyMaskRegion{
+				ID:      area.Id,
+				Enabled: area.Enabled,
+			}
+			for _, point := range area.Region {
+				region.RegionCoordinates = append(region.RegionCoordinates, screen.Coordinates(point))
+			}
+			mask.Regions = append(mask.Regions, region)
+		}
+		if err := client.SetPrivacyMask(ctx, channelId, mask); err != nil {
+			logger.SError("failed to update privacy mask",
+				zap.Error(err))
+			return nil, err
+		}
+		if current, err = client.PrivacyMask(ctx, channelId); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &PrivacyMaskSettings{
+		Enabled: current.Enabled,
+		Masks:   []PrivacyMaskArea{},
+	}
+	for _, region := range current.Regions {
+		area := PrivacyMaskArea{
+			Id:      region.ID,
+			Enabled: region.Enabled,
+		}
+		for _, coordinates := range region.RegionCoordinates {
+			area.Region = append(area.Region, screen.Normalized(coordinates))
+		}
+		resp.Masks = append(resp.Masks, area)
+	}
+	return resp, nil
+}
+
+type PositionOverlay struct {
+	Enabled  bool                       `json:"enabled"`
+	Position *hikvision.NormalizedPoint `json:"position,omitempty"`
+}
+
+type TextOverlay struct {
+	Id       int                       `json:"id"`
+	Enabled  bool                      `json:"enabled"`
+	Text     string                    `json:"text"`
+	Position hikvision.NormalizedPoint `json:"position"`
+}
+
+type OverlaySettings struct {
+	ChannelName *PositionOverlay `json:"channelName,omitempty"`
+	DateTime    *PositionOverlay `json:"dateTime,omitempty"`
+	// Texts replace every custom text line when not nil
+	Texts []TextOverlay `json:"texts,omitempty"`
+	// StampCameraName renames the channel after the OpenGate camera name
+	// so the channel name overlay identifies recordings
+	StampCameraName bool `json:"stampCameraName,omitempty"`
+}
+
+type OverlayRequest struct {
+	ChannelId string           `json:"channelId,omitempty"`
+	Settings  *OverlaySettings `json:"settings,omitempty"`
+}
+
+// Overlays applies the OSD settings when given and returns the overlays configured on the camera
+func (s *CommandService) Overlays(ctx context.Context, camera *db.Camera, req *OverlayRequest) (*OverlaySettings, error) {
+	client := s.hikvisionClient.System(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	current, err := client.Overlays(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve overlays",
+			zap.Error(err))
+		return nil, err
+	}
+	screen := current.NormalizedScreenSize()
+
+	if req.Settings != nil {
+		logger.SInfo("requested updating overlays",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("channel_id", channelId))
+		if req.Settings.StampCameraName {
+			if camera.OpenGateCameraName == "" {
+				return nil, custerror.FormatFailedPrecondition("camera has no OpenGate name")
+			}
+			if err := client.SetChannelName(ctx, channelId, camera.OpenGateCameraName); err != nil {
+				logger.SError("failed to rename channel",
+					zap.Error(err))
+				return nil, err
+			}
+			if req.Settings.ChannelName == nil {
+				req.Settings.ChannelName = &PositionOverlay{Enabled: true}
+			}
+		}
+		patch := &hikvision.VideoOverlayPatch{
+			ChannelName: positionOverlayPatchOf(screen, req.Settings.ChannelName),
+			DateTime:    positionOverlayPatchOf(screen, req.Settings.DateTime),
+		}
+		if req.Settings.Texts != nil {
+			patch.TextOverlays = []*hikvision.TextOverlay{}
+			for _, text := range req.Settings.Texts {
+				coordinates := screen.Coordinates(text.Position)
+				patch.TextOverlays = append(patch.TextOverlays, &hikvision.TextOverlay{
+					ID:          text.Id,
+					Enabled:     text.Enabled,
+					DisplayText: text.Text,
+					PositionX:   coordinates.PositionX,
+					PositionY:   coordinates.PositionY,
+				})
+			}
+		}
+		if err := client.SetOverlays(ctx, channelId, patch); err != nil {
+			logger.SError("failed to update overlays",
+				zap.Error(err))
+			return nil, err
+		}
+		if current, err = client.Overlays(ctx, channelId); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &OverlaySettings{Texts: []TextOverlay{}}
+	if overlay := current.ChannelNameOverlay; overlay != nil {
+		resp.ChannelName = positionOverlayOf(screen, overlay.Enabled, overlay.PositionX, overlay.PositionY)
+	}
+	if overlay := current.DateTimeOverlay; overlay != nil {
+		resp.DateTime = positionOverlayOf(screen, overlay.Enabled, overlay.PositionX, overlay.PositionY)
+	}
+	for _, text := range current.TextOverlays {
+		resp.Texts = append(resp.Texts, TextOverlay{
+			Id:      text.ID,
+			Enabled: text.Enabled,
+			Text:    text.DisplayText,
+			Position: screen.Normalized(hikvision.RegionCoordinates{
+				PositionX: text.PositionX,
+				PositionY: text.PositionY,
+			}),
+		})
+	}
+	return resp, nil
+}
+
+func positionOverlayPatchOf(screen hikvision.NormalizedScreenSize, overlay *PositionOverlay) *hikvision.PositionOverlayPatch {
+	if overlay == nil {
+		return nil
+	}
+	patch := &hikvision.PositionOverlayPatch{Enabled: &overlay.Enabled}
+	if overlay.Position != nil {
+		coordinates := screen.Coordinates(*overlay.Position)
+		patch.Position = &coordinates
+	}
+	return patch
+}
+
+func positionOverlayOf(screen hikvision.NormalizedScreenSize, enabled bool, x int, y int) *PositionOverlay {
+	position := screen.Normalized(hikvision.RegionCoordinates{PositionX: x, PositionY: y})
+	return &PositionOverlay{
+		Enabled:  enabled,
+		Position: &position,
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	custprobe "github.com/CE-Thesis-2023/ltd/src/internal/ffprobe"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+type ProbeRequest struct {
+	ChannelId string `json:"channelId,omitempty"`
+	// Stream is the main or sub stream of the channel, the main stream by default
+	Stream int `json:"stream,omitempty"`
+	// Url probes another source than the configured stream of the camera
+	Url string `json:"url,omitempty"`
+}
+
+type ProbeResponse struct {
+	CameraId string `json:"cameraId"`
+	// Source is the probed URL, without its credentials
+	Source string `json:"source"`
+	*custprobe.ProbeResult
+}
+
+// SetCameraSource records the source URL the stream of a camera is configured with
+func (s *CommandService) SetCameraSource(cameraId string, sourceUrl string) {
+	s.channelsMu.Lock()
+	defer s.channelsMu.Unlock()
+	if sourceUrl == "" {
+		delete(s.sources, cameraId)
+		return
+	}
+	s.sources[cameraId] = sourceUrl
+}
+
+// sourceUrlOf returns the configured source of the camera, switched to another stream
+// of the camera when the request names a channel or a stream
+func (s *CommandService) sourceUrlOf(camera *db.Camera, req *ProbeRequest) (*url.URL, error) {
+	s.channelsMu.Lock()
+	sourceUrl, found := s.sources[camera.CameraId]
+	s.channelsMu.Unlock()
+	if !found {
+		return nil, custerror.FormatNotFound("camera %s has no stream configured", camera.CameraId)
+	}
+	source, err := url.Parse(sourceUrl)
+	if err != nil {
+		return nil, custerror.FormatInvalidArgument("invalid configured source URL: %s", err)
+	}
+	if req.ChannelId == "" && req.Stream == 0 {
+		return source, nil
+	}
+	if !streamingChannelPattern.MatchString(source.Path) {
+		return nil, custerror.FormatInvalidArgument("configured source of camera %s does not name its streams", camera.CameraId)
+	}
+	streamId := streamIdOf(s.channelIdOf(camera, req.ChannelId), req.Stream)
+	source.Path = streamingChannelPattern.ReplaceAllStringFunc(source.Path, func(match string) string {
+		return match[:strings.LastIndex(match, "/")+1] + streamId
+	})
+	source.RawPath = ""
+	return source, nil
+}
+
+// Probe inspects the codecs, size, rates and audio tracks of a stream of the camera
+func (s *CommandService) Probe(ctx context.Context, camera *db.Camera, req *ProbeRequest) (*ProbeResponse, error) {
+	if req.Stream != 0 && req.Stream != MainStream && req.Stream != SubStream {
+		return nil, custerror.FormatInvalidArgument("unknown stream %d", req.Stream)
+	}
+	var source *url.URL
+	if req.Url != "" {
+		var err error
+		source, err = url.Parse(req.Url)
+		if err != nil {
+			return nil, custerror.FormatInvalidArgument("invalid source URL: %s", err)
+		}
+		// ffprobe reads local files and any protocol it knows, only camera streams are allowed
+		if source.Scheme != "rtsp" && source.Scheme != "rtsps" {
+			return nil, custerror.FormatInvalidArgument("source must be an RTSP URL, got %q", source.Scheme)
+		}
+	} else {
+		var err error
+		source, err = s.sourceUrlOf(camera, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	logger.SInfo("requested probing source stream",
+		zap.String("camera_id", camera.CameraId),
+		zap.String("source", source.Redacted()))
+
+	result, err := newProber().Probe(ctx, source.String())
+	if err != nil {
+		logger.SError("failed to probe source stream",
+			zap.String("camera_id", camera.CameraId),
+			zap.Error(err))
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, custerror.FormatTimeout("probing %s timed out", source.Redacted())
+		}
+		return nil, err
+	}
+	return &ProbeResponse{
+		CameraId:    camera.CameraId,
+		Source:      source.Redacted(),
+		ProbeResult: result,
+	}, nil
+}
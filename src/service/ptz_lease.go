@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+// PTZ clients, by decreasing priority
+const (
+	PTZClientOperator = "operator"
+	PTZClientTracker  = "tracker"
+	PTZClientPatrol   = "patrol"
+)
+
+var ptzClientPriorities = map[string]int{
+	PTZClientOperator: 3,
+	PTZClientTracker:  2,
+	PTZClientPatrol:   1,
+}
+
+const (
+	PTZControlActionAcquire = "acquire"
+	PTZControlActionRelease = "release"
+	PTZControlActionStatus  = "status"
+)
+
+const (
+	defaultPTZLeaseDuration = 60 * time.Second
+	maxPTZLeaseDuration     = 10 * time.Minute
+	// every move renews the lease of its client for at least this long
+	implicitPTZLeaseDuration = 15 * time.Second
+)
+
+type ptzClientKey struct{}
+
+// WithPTZClient tags the context with the client moves are made for
+func WithPTZClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, ptzClientKey{}, client)
+}
+
+// PTZClientOf returns the client of the context, untagged contexts are operators
+func PTZClientOf(ctx context.Context) string {
+	if client, ok := ctx.Value(ptzClientKey{}).(string); ok {
+		return client
+	}
+	return PTZClientOperator
+}
+
+// PTZLease gives a client control of the camera until it expires or is released
+type PTZLease struct {
+	CameraId  string    `json:"cameraId"`
+	Holder    string    `json:"holder"`
+	Owner     string    `json:"owner,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// PTZLeaseError rejects a command while a client of higher priority holds the camera
+type PTZLeaseError struct {
+	*custerror.CustomError
+	Lease *PTZLease `json:"lease"`
+}
+
+func (e *PTZLeaseError) Unwrap() error {
+	return e.CustomError
+}
+
+func newPTZLeaseError(lease *PTZLease) *PTZLeaseError {
+	held := *lease
+	return &PTZLeaseError{
+		CustomError: custerror.NewError(
+			fmt.Sprintf("PTZ control of camera %s is held by %s until %s",
+				lease.CameraId, lease.Holder, lease.ExpiresAt.Format(time.RFC3339)),
+			custerror.ErrorFailedPrecondition.Code),
+		Lease: &held,
+	}
+}
+
+// activeLease drops the lease of the camera once expired, the lease mutex must be held
+func (s *CommandService) activeLease(cameraId string, now time.Time) *PTZLease {
+	lease, found := s.leases[cameraId]
+	if !found {
+		return nil
+	}
+	if !now.Before(lease.ExpiresAt) {
+		delete(s.leases, cameraId)
+		return nil
+	}
+	return lease
+}
+
+// acquirePTZ takes or renews the lease of the camera for the client of the context,
+// a lease never gets shorter and fails while a client of higher priority holds it.
+// The moves of the previous holder are stopped when the lease is taken over
+func (s *CommandService) acquirePTZ(ctx context.Context, camera *db.Camera, duration time.Duration, owner string) (*PTZLease, error) {
+	lease, takenOver, err := s.takePTZ(ctx, camera, duration, owner)
+	if err != nil {
+		return nil, err
+	}
+	if takenOver {
+		s.stopMoves(camera)
+	}
+	return lease, nil
+}
+
+func (s *CommandService) takePTZ(ctx context.Context, camera *db.Camera, duration time.Duration, owner string) (*PTZLease, bool, error) {
+	client := PTZClientOf(ctx)
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+	now := time.Now()
+	expiresAt := now.Add(duration)
+	held := s.activeLease(camera.CameraId, now)
+	takenOver := false
+	if held != nil && held.Holder != client {
+		if ptzClientPriorities[held.Holder] > ptzClientPriorities[client] {
+			return nil, false, newPTZLeaseError(held)
+		}
+		logger.SInfo("PTZ control taken over",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("from", held.Holder),
+			zap.String("to", client))
+		held = nil
+		takenOver = true
+	}
+	if held != nil {
+		if held.ExpiresAt.After(expiresAt) {
+			expiresAt = held.ExpiresAt
+		}
+		if owner == "" {
+			owner = held.Owner
+		}
+	}
+	lease := &PTZLease{
+		CameraId:  camera.CameraId,
+		Holder:    client,
+		Owner:     owner,
+		ExpiresAt: expiresAt,
+	}
+	s.leases[camera.CameraId] = lease
+	acquired := *lease
+	return &acquired, takenOver, nil
+}
+
+// claimPTZ checks the client of the context may move the camera, renewing its lease
+func (s *CommandService) claimPTZ(ctx context.Context, camera *db.Camera) error {
+	_, err := s.acquirePTZ(ctx, camera, implicitPTZLeaseDuration, "")
+	return err
+}
+
+// releasePTZ gives up the lease of the camera, stopping the moves made under it
+func (s *CommandService) releasePTZ(ctx context.Context, camera *db.Camera) error {
+	released, err := s.dropPTZ(ctx, camera)
+	if err != nil {
+		return err
+	}
+	if released {
+		s.stopMoves(camera)
+	}
+	return nil
+}
+
+func (s *CommandService) dropPTZ(ctx context.Context, camera *db.Camera) (bool, error) {
+	client := PTZClientOf(ctx)
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+	held := s.activeLease(camera.CameraId, time.Now())
+	if held == nil {
+		return false, nil
+	}
+	if held.Holder != client && ptzClientPriorities[held.Holder] > ptzClientPriorities[client] {
+		return false, newPTZLeaseError(held)
+	}
+	delete(s.leases, camera.CameraId)
+	return true, nil
+}
+
+func (s *CommandService) leaseOf(camera *db.Camera) *PTZLease {
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+	held := s.activeLease(camera.CameraId, time.Now())
+	if held == nil {
+		return nil
+	}
+	lease := *held
+	return &lease
+}
+
+type PTZControlRequest struct {
+	Action string `json:"action"`
+	// Client is the operator, tracker or patrol the command is made for,
+	// defaults to the client the command came from
+	Client string `json:"client,omitempty"`
+	Owner  string `json:"owner,omitempty"`
+	// Duration of the lease in seconds
+	Duration float64 `json:"duration,omitempty"`
+}
+
+type PTZControlResponse struct {
+	CameraId string    `json:"cameraId"`
+	Held     bool      `json:"held"`
+	Lease    *PTZLease `json:"lease,omitempty"`
+}
+
+// PTZControl acquires or releases the PTZ lease of the camera and reports who holds it
+func (s *CommandService) PTZControl(ctx context.Context, camera *db.Camera, req *PTZControlRequest) (*PTZControlResponse, error) {
+	if req.Client != "" {
+		if _, found := ptzClientPriorities[req.Client]; !found {
+			return nil, custerror.FormatInvalidArgument("unknown PTZ client %q", req.Client)
+		}
+		ctx = WithPTZClient(ctx, req.Client)
+	}
+	logger.SInfo("requested PTZ control",
+		zap.String("camera_id", camera.CameraId),
+		zap.String("action", req.Action),
+		zap.String("client", PTZClientOf(ctx)))
+
+	switch req.Action {
+	case PTZControlActionAcquire:
+		duration := defaultPTZLeaseDuration
+		if req.Duration > 0 {
+			duration = time.Duration(req.Duration * float64(time.Second))
+		}
+		if duration > maxPTZLeaseDuration {
+			return nil, custerror.FormatInvalidArgument("PTZ lease must be at most %s, got %s", maxPTZLeaseDuration, duration)
+		}
+		if _, err := s.acquirePTZ(ctx, camera, duration, req.Owner); err != nil {
+			return nil, err
+		}
+	case PTZControlActionRelease:
+		if err := s.releasePTZ(ctx, camera); err != nil {
+			return nil, err
+		}
+	case PTZControlActionStatus:
+	default:
+		return nil, custerror.FormatInvalidArgument("unknown PTZ control action %q", req.Action)
+	}
+
+	lease := s.leaseOf(camera)
+	return &PTZControlResponse{
+		CameraId: camera.CameraId,
+		Held:     lease != nil,
+		Lease:    lease,
+	}, nil
+}
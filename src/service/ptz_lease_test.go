@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+)
+
+func TestPTZLease_Priorities(t *testing.T) {
+	s := NewCommandService(nil, nil, nil)
+	camera := &db.Camera{CameraId: "camera-1"}
+	operator := WithPTZClient(context.Background(), PTZClientOperator)
+	tracker := WithPTZClient(context.Background(), PTZClientTracker)
+	patrol := WithPTZClient(context.Background(), PTZClientPatrol)
+
+	if err := s.claimPTZ(tracker, camera); err != nil {
+		t.Fatalf("expected the tracker to take a free camera, got %v", err)
+	}
+	if err := s.claimPTZ(patrol, camera); err == nil {
+		t.Fatalf("expected the patrol to yield to the tracker")
+	}
+	if _, err := s.acquirePTZ(operator, camera, time.Minute, "alice"); err != nil {
+		t.Fatalf("expected the operator to take over from the tracker, got %v", err)
+	}
+
+	err := s.claimPTZ(tracker, camera)
+	var leaseErr *PTZLeaseError
+	if !errors.As(err, &leaseErr) {
+		t.Fatalf("expected a lease error, got %v", err)
+	}
+	if leaseErr.Lease.Holder != PTZClientOperator || leaseErr.Lease.Owner != "alice" {
+		t.Errorf("expected the lease of alice, got %+v", leaseErr.Lease)
+	}
+	if !errors.Is(err, custerror.ErrorFailedPrecondition) {
+		t.Errorf("expected a failed precondition, got %v", err)
+	}
+
+	// moves renew the lease without shortening it
+	if err := s.claimPTZ(operator, camera); err != nil {
+		t.Fatalf("expected the operator to keep moving, got %v", err)
+	}
+	if lease := s.leaseOf(camera); time.Until(lease.ExpiresAt) < 30*time.Second || lease.Owner != "alice" {
+		t.Errorf("expected the explicit lease to be kept, got %+v", lease)
+	}
+
+	if err := s.releasePTZ(tracker, camera); err == nil {
+		t.Errorf("expected the tracker not to release the operator lease")
+	}
+	if err := s.releasePTZ(operator, camera); err != nil {
+		t.Fatalf("expected the operator to release its lease, got %v", err)
+	}
+	if err := s.claimPTZ(patrol, camera); err != nil {
+		t.Errorf("expected the patrol to take the released camera, got %v", err)
+	}
+}
+
+func TestPTZLease_Expiry(t *testing.T) {
+	s := NewCommandService(nil, nil, nil)
+	camera := &db.Camera{CameraId: "camera-1"}
+	s.leases[camera.CameraId] = &PTZLease{
+		CameraId:  camera.CameraId,
+		Holder:    PTZClientOperator,
+		ExpiresAt: time.Now().Add(-time.Second),
+	}
+	if err := s.claimPTZ(WithPTZClient(context.Background(), PTZClientTracker), camera); err != nil {
+		t.Errorf("expected an expired lease not to block the tracker, got %v", err)
+	}
+	if lease := s.leaseOf(camera); lease == nil || lease.Holder != PTZClientTracker {
+		t.Errorf("expected the tracker to hold the camera, got %+v", lease)
+	}
+}
@@ -0,0 +1,589 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	PTZLimitEnforcementReject = "reject"
+	PTZLimitEnforcementClamp  = "clamp"
+)
+
+const (
+	// azimuths are in tenths of a degree
+	fullTurn = 3600
+	// moves toward an edge closer than the margin are treated as leaving the window
+	limitEdgeMargin    = 5
+	limitWatchInterval = 200 * time.Millisecond
+	// field of view at the widest zoom of common domes, in tenths of a degree
+	defaultHorizontalFov = 600
+	defaultVerticalFov   = 340
+)
+
+// PTZSoftLimits is the window moves are kept in, in the tenths of a degree reported by Status.
+// The azimuth window wraps through 0 when MinAzimuth is greater than MaxAzimuth,
+// the elevation grows downward as on Hikvision domes
+type PTZSoftLimits struct {
+	Enabled bool `json:"enabled"`
+	// Enforcement is reject or clamp, clamped moves stop at the edge of the window
+	Enforcement  string `json:"enforcement"`
+	MinAzimuth   int    `json:"minAzimuth"`
+	MaxAzimuth   int    `json:"maxAzimuth"`
+	MinElevation int    `json:"minElevation"`
+	MaxElevation int    `json:"maxElevation"`
+	// HorizontalFov and VerticalFov are the field of view at the widest zoom,
+	// used to find where a relative move ends, common dome values when unset
+	HorizontalFov int `json:"horizontalFov,omitempty"`
+	VerticalFov   int `json:"verticalFov,omitempty"`
+}
+
+func (l *PTZSoftLimits) validate() error {
+	switch l.Enforcement {
+	case PTZLimitEnforcementReject, PTZLimitEnforcementClamp:
+	default:
+		return custerror.FormatInvalidArgument("unknown limit enforcement %q", l.Enforcement)
+	}
+	if l.MinAzimuth < 0 || l.MinAzimuth >= fullTurn || l.MaxAzimuth < 0 || l.MaxAzimuth >= fullTurn {
+		return custerror.FormatInvalidArgument("azimuth limits must be between 0 and %d", fullTurn-1)
+	}
+	if l.MinElevation > l.MaxElevation {
+		return custerror.FormatInvalidArgument("minimum elevation %d is above maximum elevation %d", l.MinElevation, l.MaxElevation)
+	}
+	if l.HorizontalFov < 0 || l.HorizontalFov > fullTurn || l.VerticalFov < 0 || l.VerticalFov > fullTurn {
+		return custerror.FormatInvalidArgument("field of view must be between 0 and %d", fullTurn)
+	}
+	return nil
+}
+
+// clockwise is the azimuth travelled panning right from one azimuth to the other
+func clockwise(from int, to int) int {
+	return ((to-from)%fullTurn + fullTurn) % fullTurn
+}
+
+// turn is the shortest azimuth travelled from one azimuth to the other, positive to the right
+func turn(from int, to int) int {
+	d := clockwise(from, to)
+	if d > fullTurn/2 {
+		d -= fullTurn
+	}
+	return d
+}
+
+func (l *PTZSoftLimits) containsAzimuth(azimuth int) bool {
+	return clockwise(l.MinAzimuth, azimuth) <= clockwise(l.MinAzimuth, l.MaxAzimuth)
+}
+
+func (l *PTZSoftLimits) contains(position hikvision.AbsoluteHigh) bool {
+	return l.containsAzimuth(position.Azimuth) &&
+		position.Elevation >= l.MinElevation &&
+		position.Elevation <= l.MaxElevation
+}
+
+// clamp moves the position to the closest edge of the window
+func (l *PTZSoftLimits) clamp(position hikvision.AbsoluteHigh) hikvision.AbsoluteHigh {
+	if !l.containsAzimuth(position.Azimuth) {
+		if clockwise(position.Azimuth, l.MinAzimuth) <= clockwise(l.MaxAzimuth, position.Azimuth) {
+			position.Azimuth = l.MinAzimuth
+		} else {
+			position.Azimuth = l.MaxAzimuth
+		}
+	}
+	position.Elevation = max(l.MinElevation, min(l.MaxElevation, position.Elevation))
+	return position
+}
+
+func (l *PTZSoftLimits) allowsPan(azimuth int, right bool) bool {
+	if l.containsAzimuth(azimuth) {
+		if right {
+			return clockwise(azimuth, l.MaxAzimuth) > limitEdgeMargin
+		}
+		return clockwise(l.MinAzimuth, azimuth) > limitEdgeMargin
+	}
+	// out of the window, only the shortest way back is allowed
+	backRight := clockwise(azimuth, l.MinAzimuth) <= clockwise(l.MaxAzimuth, azimuth)
+	return right == backRight
+}
+
+// restrict zeroes the pan and tilt speeds that would move the position out of the window,
+// pan is positive to the right and tilt is positive upward
+func (l *PTZSoftLimits) restrict(position hikvision.AbsoluteHigh, pan int, tilt int) (int, int) {
+	if pan != 0 && !l.allowsPan(position.Azimuth, pan > 0) {
+		pan = 0
+	}
+	if tilt > 0 && position.Elevation <= l.MinElevation+limitEdgeMargin {
+		tilt = 0
+	}
+	if tilt < 0 && position.Elevation >= l.MaxElevation-limitEdgeMargin {
+		tilt = 0
+	}
+	return pan, tilt
+}
+
+// travel shortens the azimuth and elevation offsets from the position so the move
+// stops at the edge of the window, out of the window only moves back toward it are kept
+func (l *PTZSoftLimits) travel(position hikvision.AbsoluteHigh, azimuth int, elevation int) (int, int) {
+	switch {
+	case azimuth == 0:
+	case !l.containsAzimuth(position.Azimuth):
+		backRight := clockwise(position.Azimuth, l.MinAzimuth) <= clockwise(l.MaxAzimuth, position.Azimuth)
+		if (azimuth > 0) != backRight {
+			azimuth = 0
+		}
+	case azimuth > 0:
+		azimuth = min(azimuth, clockwise(position.Azimuth, l.MaxAzimuth))
+	default:
+		azimuth = max(azimuth, -clockwise(l.MinAzimuth, position.Azimuth))
+	}
+	if elevation > 0 {
+		elevation = min(elevation, max(0, l.MaxElevation-position.Elevation))
+	} else if elevation < 0 {
+		elevation = max(elevation, min(0, l.MinElevation-position.Elevation))
+	}
+	return azimuth, elevation
+}
+
+// relativeOffset is how far a relative move turns from the position, the edges
+// of the frame are half the field of view at the current zoom away from its center
+func (l *PTZSoftLimits) relativeOffset(position hikvision.AbsoluteHigh, relative hikvision.Relative) (int, int) {
+	horizontalFov, verticalFov := l.HorizontalFov, l.VerticalFov
+	if horizontalFov == 0 {
+		horizontalFov = defaultHorizontalFov
+	}
+	if verticalFov == 0 {
+		verticalFov = defaultVerticalFov
+	}
+	// the zoom is reported in tenths of a magnification
+	magnification := math.Max(1, float64(position.AbsoluteZoom)/10)
+	azimuth := float64(relative.PositionX) * float64(horizontalFov) / 2 / magnification
+	elevation := float64(relative.PositionY) * float64(verticalFov) / 2 / magnification
+	return int(math.Round(azimuth)), int(math.Round(elevation))
+}
+
+// predict extrapolates the position after the lookahead at the speed measured
+// between the previous and the current sample
+func predict(previous hikvision.AbsoluteHigh, current hikvision.AbsoluteHigh, elapsed time.Duration, lookahead time.Duration) hikvision.AbsoluteHigh {
+	if elapsed <= 0 {
+		return current
+	}
+	scale := float64(lookahead) / float64(elapsed)
+	predicted := current
+	predicted.Azimuth = clockwise(0, current.Azimuth+int(math.Round(float64(turn(previous.Azimuth, current.Azimuth))*scale)))
+	predicted.Elevation = current.Elevation + int(math.Round(float64(current.Elevation-previous.Elevation)*scale))
+	return predicted
+}
+
+type limitWatcher struct {
+	cancel context.CancelFunc
+}
+
+func ptzKeyOf(camera *db.Camera, channelId string) string {
+	return fmt.Sprintf("%s/%s", camera.CameraId, channelId)
+}
+
+func (s *CommandService) softLimitsOf(camera *db.Camera, channelId string) *PTZSoftLimits {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+	limits, found := s.softLimits[ptzKeyOf(camera, channelId)]
+	if !found || !limits.Enabled {
+		return nil
+	}
+	return limits
+}
+
+// limitAbsolute keeps the absolute position inside the software limits of the channel
+func (s *CommandService) limitAbsolute(camera *db.Camera, channelId string, position hikvision.AbsoluteHigh) (hikvision.AbsoluteHigh, error) {
+	limits := s.softLimitsOf(camera, channelId)
+	if limits == nil || limits.contains(position) {
+		return position, nil
+	}
+	if limits.Enforcement == PTZLimitEnforcementReject {
+		return position, custerror.FormatPermissionDenied("position %d/%d is outside the PTZ limits", position.Azimuth, position.Elevation)
+	}
+	clamped := limits.clamp(position)
+	logger.SInfo("clamped PTZ absolute position to limits",
+		zap.String("camera_id", camera.CameraId),
+		zap.Reflect("requested", position),
+		zap.Reflect("clamped", clamped))
+	return clamped, nil
+}
+
+// limitRelative keeps a relative move inside the software limits of the channel, the move
+// ends at the current position read from the camera plus the offset of the point moved to
+func (s *CommandService) limitRelative(
+	ctx context.Context,
+	client hikvision.PtzApiClientInterface,
+	camera *db.Camera,
+	req *hikvision.PTZCtrlRelativeRequest) error {
+	limits := s.softLimitsOf(camera, req.ChannelId)
+	if limits == nil || (req.Relative.PositionX == 0 && req.Relative.PositionY == 0) {
+		return nil
+	}
+	status, err := client.Status(ctx, &hikvision.PtzCtrlStatusRequest{ChannelId: req.ChannelId})
+	if err != nil {
+		logger.SError("failed to retrieve PTZ status for limits",
+			zap.Error(err))
+		return err
+	}
+	position := status.AbsoluteHigh
+	azimuth, elevation := limits.relativeOffset(position, req.Relative)
+	limitedAzimuth, limitedElevation := limits.travel(position, azimuth, elevation)
+	if limitedAzimuth == azimuth && limitedElevation == elevation {
+		return nil
+	}
+	if limits.Enforcement == PTZLimitEnforcementReject {
+		return custerror.FormatPermissionDenied("move to %d/%d would leave the PTZ limits",
+			clockwise(0, position.Azimuth+azimuth), position.Elevation+elevation)
+	}
+	// the point moved to is scaled back so the move ends on the edge
+	if azimuth != 0 {
+		req.Relative.PositionX *= float32(limitedAzimuth) / float32(azimuth)
+	}
+	if elevation != 0 {
+		req.Relative.PositionY *= float32(limitedElevation) / float32(elevation)
+	}
+	logger.SInfo("clamped PTZ relative move to limits",
+		zap.String("camera_id", camera.CameraId),
+		zap.Reflect("position", position),
+		zap.Reflect("relative", req.Relative))
+	return nil
+}
+
+// limitDirection keeps a pan and tilt move from leaving the software limits of the channel,
+// the current position is read from the camera
+func (s *CommandService) limitDirection(
+	ctx context.Context,
+	client hikvision.PtzApiClientInterface,
+	camera *db.Camera,
+	channelId string,
+	pan int,
+	tilt int) (int, int, error) {
+	limits := s.softLimitsOf(camera, channelId)
+	if limits == nil || (pan == 0 && tilt == 0) {
+		return pan, tilt, nil
+	}
+	status, err := client.Status(ctx, &hikvision.PtzCtrlStatusRequest{ChannelId: channelId})
+	if err != nil {
+		logger.SError("failed to retrieve PTZ status for limits",
+			zap.Error(err))
+		return pan, tilt, err
+	}
+	limitedPan, limitedTilt := limits.restrict(status.AbsoluteHigh, pan, tilt)
+	if limitedPan == pan && limitedTilt == tilt {
+		return pan, tilt, nil
+	}
+	if limits.Enforcement == PTZLimitEnforcementReject {
+		return pan, tilt, custerror.FormatPermissionDenied("move would leave the PTZ limits at %d/%d",
+			status.AbsoluteHigh.Azimuth, status.AbsoluteHigh.Elevation)
+	}
+	logger.SInfo("clamped PTZ move to limits",
+		zap.String("camera_id", camera.CameraId),
+		zap.Int("pan", limitedPan),
+		zap.Int("tilt", limitedTilt))
+	return limitedPan, limitedTilt, nil
+}
+
+// watchLimits stops a continuous move before it reaches the edge of the software limits,
+// the position is predicted from the speed of the move to the time a stop sent now lands,
+// the watch ends with the move, after stopAfter, or when another move is requested
+func (s *CommandService) watchLimits(
+	client hikvision.PtzApiClientInterface,
+	camera *db.Camera,
+	channelId string,
+	options hikvision.PtzCtrlContinousOptions,
+	stopAfter time.Duration) {
+	limits := s.softLimitsOf(camera, channelId)
+	if limits == nil || (options.Pan == 0 && options.Tilt == 0) {
+		return
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if stopAfter > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), stopAfter)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	key := ptzKeyOf(camera, channelId)
+	watcher := &limitWatcher{cancel: cancel}
+	s.limitsMu.Lock()
+	if previous, found := s.limitWatchers[key]; found {
+		previous.cancel()
+	}
+	s.limitWatchers[key] = watcher
+	s.limitsMu.Unlock()
+
+	go func() {
+		defer func() {
+			cancel()
+			s.limitsMu.Lock()
+			if s.limitWatchers[key] == watcher {
+				delete(s.limitWatchers, key)
+			}
+			s.limitsMu.Unlock()
+		}()
+		ticker := time.NewTicker(limitWatchInterval)
+		defer ticker.Stop()
+		var previous hikvision.AbsoluteHigh
+		var previousAt time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			start := time.Now()
+			status, err := client.Status(ctx, &hikvision.PtzCtrlStatusRequest{ChannelId: channelId})
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.SError("failed to retrieve PTZ status for limits",
+						zap.Error(err))
+				}
+				return
+			}
+			roundTrip := time.Since(start)
+			// the position is half a round trip old, a stop lands a round trip
+			// from now and without one the move goes on until the next poll
+			sampledAt := start.Add(roundTrip / 2)
+			position := status.AbsoluteHigh
+			predicted := position
+			if !previousAt.IsZero() {
+				predicted = predict(previous, position, sampledAt.Sub(previousAt), limitWatchInterval+roundTrip*3/2)
+			}
+			previous, previousAt = position, sampledAt
+			pan, tilt := limits.restrict(position, options.Pan, options.Tilt)
+			pan, tilt = limits.restrict(predicted, pan, tilt)
+			if pan == options.Pan && tilt == options.Tilt {
+				continue
+			}
+			options.Pan, options.Tilt = pan, tilt
+			logger.SInfo("PTZ move is about to reach the limits",
+				zap.String("camera_id", camera.CameraId),
+				zap.Reflect("position", position),
+				zap.Reflect("predicted", predicted))
+			if err := client.RawContinuous(ctx, &hikvision.PtzCtrlRawContinousRequest{
+				ChannelId: channelId,
+				Options:   &options,
+			}); err != nil {
+				logger.SError("failed to stop PTZ move at the limits",
+					zap.Error(err))
+				return
+			}
+			if pan == 0 && tilt == 0 {
+				return
+			}
+		}
+	}()
+}
+
+// stopLimitWatcher ends the watch of the previous continuous move of the channel
+func (s *CommandService) stopLimitWatcher(camera *db.Camera, channelId string) {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+	key := ptzKeyOf(camera, channelId)
+	if watcher, found := s.limitWatchers[key]; found {
+		watcher.cancel()
+		delete(s.limitWatchers, key)
+	}
+}
+
+type PTZDeviceLimit struct {
+	Id      int     `json:"id"`
+	Enabled *bool   `json:"enabled,omitempty"`
+	Mode    *string `json:"mode,omitempty"`
+	// Stop saves the current position as the left, right, up or down stop
+	Stop string `json:"stop,omitempty"`
+	// Clear removes the saved stops before anything else is applied
+	Clear bool `json:"clear,omitempty"`
+}
+
+type PTZLimitsRequest struct {
+	ChannelId string          `json:"channelId,omitempty"`
+	Device    *PTZDeviceLimit `json:"device,omitempty"`
+	Software  *PTZSoftLimits  `json:"software,omitempty"`
+}
+
+type PTZLimitsResponse struct {
+	Device   []*hikvision.PTZLimit `json:"device"`
+	Software *PTZSoftLimits        `json:"software,omitempty"`
+}
+
+// PTZLimits configures the limits of the camera and the software limits
+// enforced on moves when given, and returns both
+func (s *CommandService) PTZLimits(ctx context.Context, camera *db.Camera, req *PTZLimitsRequest) (*PTZLimitsResponse, error) {
+	// the limits keep the tracker away from positions, it can't lift them
+	if (req.Software != nil || req.Device != nil) && PTZClientOf(ctx) == PTZClientTracker {
+		return nil, custerror.FormatPermissionDenied("the tracker can't change PTZ limits")
+	}
+	client := s.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	capabilities, err := client.Capabilities(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve PTZ capabilities",
+			zap.Error(err))
+		return nil, err
+	}
+
+	if req.Software != nil {
+		if err := req.Software.validate(); err != nil {
+			return nil, err
+		}
+		logger.SInfo("requested updating PTZ software limits",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("channel_id", channelId),
+			zap.Reflect("limits", req.Software))
+		if err := s.setSoftLimits(ptzKeyOf(camera, channelId), req.Software); err != nil {
+			return nil, err
+		}
+	}
+
+	if device := req.Device; device != nil {
+		logger.SInfo("requested updating PTZ device limits",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("channel_id", channelId),
+			zap.Int("limit_id", device.Id))
+		if err := capabilities.ValidateLimit(device.Id); err != nil {
+			return nil, err
+		}
+		limitReq := &hikvision.PtzCtrlLimitRequest{
+			ChannelId: channelId,
+			LimitId:   device.Id,
+		}
+		if device.Clear {
+			if err := client.ClearLimit(ctx, limitReq); err != nil {
+				logger.SError("failed to clear PTZ limit",
+					zap.Error(err))
+				return nil, err
+			}
+		}
+		if device.Stop != "" {
+			if err := client.SetLimitStop(ctx, &hikvision.PtzCtrlLimitStopRequest{
+				ChannelId: channelId,
+				LimitId:   device.Id,
+				Stop:      device.Stop,
+			}); err != nil {
+				logger.SError("failed to save PTZ limit stop",
+					zap.Error(err))
+				return nil, err
+			}
+		}
+		if device.Enabled != nil || device.Mode != nil {
+			if err := client.SetLimit(ctx, limitReq, &hikvision.PTZLimitPatch{
+				Enabled: device.Enabled,
+				Mode:    device.Mode,
+			}); err != nil {
+				logger.SError("failed to update PTZ limit",
+					zap.Error(err))
+				return nil, err
+			}
+		}
+	}
+
+	resp := &PTZLimitsResponse{Device: []*hikvision.PTZLimit{}}
+	if capabilities.IsSupportPtzlimiteds {
+		limits, err := client.Limits(ctx, channelId)
+		if err != nil {
+			logger.SError("failed to retrieve PTZ limits",
+				zap.Error(err))
+			return nil, err
+		}
+		resp.Device = limits.Limits
+	}
+	s.limitsMu.Lock()
+	if limits, found := s.softLimits[ptzKeyOf(camera, channelId)]; found {
+		software := *limits
+		resp.Software = &software
+	}
+	s.limitsMu.Unlock()
+	return resp, nil
+}
+
+// LoadSoftLimits restores the software limits saved to the file and saves them
+// there whenever they change, a missing file starts without software limits
+func (s *CommandService) LoadSoftLimits(path string) error {
+	if path == "" {
+		return nil
+	}
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+	s.limitsPath = path
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		logger.SError("failed to read PTZ software limits",
+			zap.String("path", path),
+			zap.Error(err))
+		return err
+	}
+	limits := map[string]*PTZSoftLimits{}
+	if err := json.Unmarshal(contents, &limits); err != nil {
+		return custerror.FormatInvalidArgument("malformed PTZ software limits in %s: %s", path, err)
+	}
+	s.softLimits = limits
+	logger.SInfo("loaded PTZ software limits",
+		zap.String("path", path),
+		zap.Int("count", len(limits)))
+	return nil
+}
+
+// setSoftLimits replaces the software limits of the channel, the previous
+// limits are kept when they could not be saved
+func (s *CommandService) setSoftLimits(key string, limits *PTZSoftLimits) error {
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+	previous, found := s.softLimits[key]
+	updated := *limits
+	s.softLimits[key] = &updated
+	if err := s.saveSoftLimits(); err != nil {
+		if found {
+			s.softLimits[key] = previous
+		} else {
+			delete(s.softLimits, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// saveSoftLimits writes the software limits to their file through a temporary
+// file so a crash never leaves it half written, limitsMu must be held
+func (s *CommandService) saveSoftLimits() error {
+	if s.limitsPath == "" {
+		return nil
+	}
+	contents, err := json.MarshalIndent(s.softLimits, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.limitsPath), 0755); err != nil {
+		logger.SError("failed to create the PTZ software limits directory",
+			zap.Error(err))
+		return err
+	}
+	tmpPath := s.limitsPath + ".tmp"
+	if err := os.WriteFile(tmpPath, contents, 0644); err != nil {
+		logger.SError("failed to write PTZ software limits",
+			zap.Error(err))
+		return err
+	}
+	if err := os.Rename(tmpPath, s.limitsPath); err != nil {
+		logger.SError("failed to save PTZ software limits",
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+)
+
+func TestPTZSoftLimits_Clamp(t *testing.T) {
+	// the window wraps through north, from 300 to 60 degrees
+	limits := &PTZSoftLimits{MinAzimuth: 3000, MaxAzimuth: 600, MinElevation: 0, MaxElevation: 450}
+
+	cases := []struct {
+		name     string
+		position hikvision.AbsoluteHigh
+		expected hikvision.AbsoluteHigh
+	}{
+		{"inside past north", hikvision.AbsoluteHigh{Azimuth: 100, Elevation: 100}, hikvision.AbsoluteHigh{Azimuth: 100, Elevation: 100}},
+		{"inside before north", hikvision.AbsoluteHigh{Azimuth: 3500, Elevation: 100}, hikvision.AbsoluteHigh{Azimuth: 3500, Elevation: 100}},
+		{"closer to the right edge", hikvision.AbsoluteHigh{Azimuth: 900, Elevation: 100}, hikvision.AbsoluteHigh{Azimuth: 600, Elevation: 100}},
+		{"closer to the left edge", hikvision.AbsoluteHigh{Azimuth: 2500, Elevation: 100}, hikvision.AbsoluteHigh{Azimuth: 3000, Elevation: 100}},
+		{"too low", hikvision.AbsoluteHigh{Azimuth: 0, Elevation: 900}, hikvision.AbsoluteHigh{Azimuth: 0, Elevation: 450}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := limits.clamp(c.position); got != c.expected {
+				t.Errorf("expected %+v, got %+v", c.expected, got)
+			}
+			if !limits.contains(limits.clamp(c.position)) {
+				t.Errorf("expected the clamped position to be inside the limits")
+			}
+		})
+	}
+}
+
+func TestPTZSoftLimits_Restrict(t *testing.T) {
+	limits := &PTZSoftLimits{MinAzimuth: 3000, MaxAzimuth: 600, MinElevation: 0, MaxElevation: 450}
+
+	cases := []struct {
+		name         string
+		position     hikvision.AbsoluteHigh
+		pan, tilt    int
+		expectedPan  int
+		expectedTilt int
+	}{
+		{"free inside", hikvision.AbsoluteHigh{Azimuth: 0, Elevation: 200}, 30, -30, 30, -30},
+		{"right edge", hikvision.AbsoluteHigh{Azimuth: 598, Elevation: 200}, 30, 0, 0, 0},
+		{"away from right edge", hikvision.AbsoluteHigh{Azimuth: 598, Elevation: 200}, -30, 0, -30, 0},
+		{"left edge across north", hikvision.AbsoluteHigh{Azimuth: 3002, Elevation: 200}, -30, 0, 0, 0},
+		{"back from outside", hikvision.AbsoluteHigh{Azimuth: 900, Elevation: 200}, -30, 0, -30, 0},
+		{"further outside", hikvision.AbsoluteHigh{Azimuth: 900, Elevation: 200}, 30, 0, 0, 0},
+		{"lowest elevation", hikvision.AbsoluteHigh{Azimuth: 0, Elevation: 450}, 0, -30, 0, 0},
+		{"highest elevation", hikvision.AbsoluteHigh{Azimuth: 0, Elevation: 0}, 0, 30, 0, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pan, tilt := limits.restrict(c.position, c.pan, c.tilt)
+			if pan != c.expectedPan || tilt != c.expectedTilt {
+				t.Errorf("expected %d/%d, got %d/%d", c.expectedPan, c.expectedTilt, pan, tilt)
+			}
+		})
+	}
+}
+
+func TestPTZSoftLimits_Travel(t *testing.T) {
+	limits := &PTZSoftLimits{MinAzimuth: 3000, MaxAzimuth: 600, MinElevation: 0, MaxElevation: 450}
+
+	cases := []struct {
+		name                   string
+		position               hikvision.AbsoluteHigh
+		azimuth, elevation     int
+		expectedAz, expectedEl int
+	}{
+		{"inside the window", hikvision.AbsoluteHigh{Azimuth: 0, Elevation: 200}, 100, -100, 100, -100},
+		{"past the right edge", hikvision.AbsoluteHigh{Azimuth: 500, Elevation: 200}, 300, 0, 100, 0},
+		{"past the left edge across north", hikvision.AbsoluteHigh{Azimuth: 100, Elevation: 200}, -300, 0, -300, 0},
+		{"far past the left edge", hikvision.AbsoluteHigh{Azimuth: 3100, Elevation: 200}, -300, 0, -100, 0},
+		{"back from outside", hikvision.AbsoluteHigh{Azimuth: 900, Elevation: 200}, -100, 0, -100, 0},
+		{"further outside", hikvision.AbsoluteHigh{Azimuth: 900, Elevation: 200}, 100, 0, 0, 0},
+		{"below the lowest elevation", hikvision.AbsoluteHigh{Azimuth: 0, Elevation: 400}, 0, 100, 0, 50},
+		{"above the highest elevation", hikvision.AbsoluteHigh{Azimuth: 0, Elevation: 50}, 0, -100, 0, -50},
+		{"lower from under the window", hikvision.AbsoluteHigh{Azimuth: 0, Elevation: 500}, 0, 100, 0, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			az, el := limits.travel(c.position, c.azimuth, c.elevation)
+			if az != c.expectedAz || el != c.expectedEl {
+				t.Errorf("expected %d/%d, got %d/%d", c.expectedAz, c.expectedEl, az, el)
+			}
+		})
+	}
+}
+
+func TestPTZSoftLimits_RelativeOffset(t *testing.T) {
+	limits := &PTZSoftLimits{HorizontalFov: 600, VerticalFov: 340}
+
+	az, el := limits.relativeOffset(hikvision.AbsoluteHigh{AbsoluteZoom: 10}, hikvision.Relative{PositionX: 1, PositionY: -0.5})
+	if az != 300 || el != -85 {
+		t.Errorf("expected the edge of the frame half the field of view away, got %d/%d", az, el)
+	}
+	az, el = limits.relativeOffset(hikvision.AbsoluteHigh{AbsoluteZoom: 40}, hikvision.Relative{PositionX: 1, PositionY: 1})
+	if az != 75 || el != 43 {
+		t.Errorf("expected the field of view to narrow with the zoom, got %d/%d", az, el)
+	}
+}
+
+func TestPredict(t *testing.T) {
+	previous := hikvision.AbsoluteHigh{Azimuth: 3590, Elevation: 100}
+	current := hikvision.AbsoluteHigh{Azimuth: 10, Elevation: 110}
+	predicted := predict(previous, current, 200*time.Millisecond, 400*time.Millisecond)
+	if predicted.Azimuth != 50 || predicted.Elevation != 130 {
+		t.Errorf("expected the move to go on across north, got %+v", predicted)
+	}
+	if got := predict(previous, current, 0, time.Second); got != current {
+		t.Errorf("expected the current position without a speed, got %+v", got)
+	}
+}
+
+func TestCommandService_LimitRelative(t *testing.T) {
+	service, camera := newTestCommandService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<PTZStatus><AbsoluteHigh><elevation>200</elevation><azimuth>500</azimuth><absoluteZoom>10</absoluteZoom></AbsoluteHigh></PTZStatus>`))
+	}))
+	client := service.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	key := ptzKeyOf(camera, "1")
+	limits := PTZSoftLimits{Enabled: true, Enforcement: PTZLimitEnforcementClamp, MinAzimuth: 3000, MaxAzimuth: 600, MinElevation: 0, MaxElevation: 450}
+	if err := service.setSoftLimits(key, &limits); err != nil {
+		t.Fatal(err)
+	}
+
+	// the frame edge is 30 degrees to the right, only 10 are left
+	req := &hikvision.PTZCtrlRelativeRequest{ChannelId: "1", Relative: hikvision.Relative{PositionX: 1, PositionY: 0.5}}
+	if err := service.limitRelative(context.Background(), client, camera, req); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(float64(req.Relative.PositionX)-1.0/3) > 0.01 || req.Relative.PositionY != 0.5 {
+		t.Errorf("expected the move to be clamped to the edge, got %+v", req.Relative)
+	}
+
+	req = &hikvision.PTZCtrlRelativeRequest{ChannelId: "1", Relative: hikvision.Relative{PositionX: -1}}
+	if err := service.limitRelative(context.Background(), client, camera, req); err != nil || req.Relative.PositionX != -1 {
+		t.Errorf("expected a move inside the limits to be left alone, got %+v, %v", req.Relative, err)
+	}
+
+	limits.Enforcement = PTZLimitEnforcementReject
+	if err := service.setSoftLimits(key, &limits); err != nil {
+		t.Fatal(err)
+	}
+	req = &hikvision.PTZCtrlRelativeRequest{ChannelId: "1", Relative: hikvision.Relative{PositionX: 1}}
+	if err := service.limitRelative(context.Background(), client, camera, req); !errors.Is(err, custerror.ErrorPermissionDenied) {
+		t.Errorf("expected a move past the limits to be rejected, got %v", err)
+	}
+}
+
+func TestCommandService_LoadSoftLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ptz", "limits.json")
+	service := NewCommandService(nil, nil, nil)
+	if err := service.LoadSoftLimits(path); err != nil {
+		t.Fatalf("expected a missing file to start without limits, got %v", err)
+	}
+	limits := PTZSoftLimits{Enabled: true, Enforcement: PTZLimitEnforcementReject, MinAzimuth: 100, MaxAzimuth: 200, MaxElevation: 300}
+	if err := service.setSoftLimits("camera-1/1", &limits); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewCommandService(nil, nil, nil)
+	if err := restarted.LoadSoftLimits(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.softLimitsOf(&db.Camera{CameraId: "camera-1"}, "1"); got == nil || *got != limits {
+		t.Errorf("expected the saved limits to be restored, got %+v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewCommandService(nil, nil, nil).LoadSoftLimits(path); !errors.Is(err, custerror.ErrorInvalidArgument) {
+		t.Errorf("expected malformed limits to be reported, got %v", err)
+	}
+}
+
+func TestCommandService_PTZLimitsFromTracker(t *testing.T) {
+	service, camera := newTestCommandService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected the camera not to be called, got %s", r.URL.Path)
+	}))
+	tracker := WithPTZClient(context.Background(), PTZClientTracker)
+	_, err := service.PTZLimits(tracker, camera, &PTZLimitsRequest{
+		ChannelId: "1",
+		Software:  &PTZSoftLimits{Enabled: false},
+	})
+	if !errors.Is(err, custerror.ErrorPermissionDenied) {
+		t.Errorf("expected the tracker not to lift the software limits, got %v", err)
+	}
+	if limits := service.softLimitsOf(camera, "1"); limits != nil {
+		t.Errorf("expected the software limits to be left alone, got %+v", limits)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	PTZHomeActionSet  = "set"
+	PTZHomeActionGoto = "goto"
+)
+
+type PTZHomeRequest struct {
+	Action    string `json:"action"`
+	ChannelId string `json:"channelId,omitempty"`
+}
+
+// PTZHome saves the current position as the home position or moves back to it
+func (s *CommandService) PTZHome(ctx context.Context, camera *db.Camera, req *PTZHomeRequest) error {
+	logger.SInfo("requested PTZ home position",
+		zap.String("camera_id", camera.CameraId),
+		zap.String("action", req.Action))
+	client := s.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	capabilities, err := client.Capabilities(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve PTZ capabilities",
+			zap.Error(err))
+		return err
+	}
+	if !capabilities.HomePositionSupport {
+		return custerror.FormatUnimplemented("camera does not support a home position")
+	}
+
+	switch req.Action {
+	case PTZHomeActionSet:
+		err = client.SetHomePosition(ctx, channelId)
+	case PTZHomeActionGoto:
+		if err := s.claimPTZ(ctx, camera); err != nil {
+			return err
+		}
+		s.supersedeMoves(camera, channelId)
+		err = client.GotoHomePosition(ctx, channelId)
+	default:
+		return custerror.FormatInvalidArgument("unknown home position action %q", req.Action)
+	}
+	if err != nil {
+		logger.SError("failed to execute PTZ home position action",
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+type PTZParkActionRequest struct {
+	ChannelId string                   `json:"channelId,omitempty"`
+	Settings  *hikvision.PTZParkAction `json:"settings,omitempty"`
+}
+
+// PTZParkAction applies the park action when given and returns the park action of the channel
+func (s *CommandService) PTZParkAction(ctx context.Context, camera *db.Camera, req *PTZParkActionRequest) (*hikvision.PTZParkAction, error) {
+	client := s.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	if req.Settings != nil {
+		logger.SInfo("requested updating PTZ park action",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("channel_id", channelId))
+		capabilities, err := client.Capabilities(ctx, channelId)
+		if err != nil {
+			logger.SError("failed to retrieve PTZ capabilities",
+				zap.Error(err))
+			return nil, err
+		}
+		if capabilities.ParkAction == nil {
+			return nil, custerror.FormatUnimplemented("camera does not support park actions")
+		}
+		if req.Settings.ParkTime <= 0 {
+			return nil, custerror.FormatInvalidArgument("park time must be positive, got %d", req.Settings.ParkTime)
+		}
+		if err := capabilities.ValidateAction(&req.Settings.Action); err != nil {
+			return nil, err
+		}
+		if err := client.SetParkAction(ctx, channelId, req.Settings); err != nil {
+			logger.SError("failed to update PTZ park action",
+				zap.Error(err))
+			return nil, err
+		}
+	}
+
+	parkAction, err := client.ParkAction(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve PTZ park action",
+			zap.Error(err))
+		return nil, err
+	}
+	return parkAction, nil
+}
+
+type PTZTimeTaskRequest struct {
+	ChannelId string                 `json:"channelId,omitempty"`
+	Settings  *hikvision.PTZTimeTask `json:"settings,omitempty"`
+}
+
+// PTZTimeTasks replaces the scheduled tasks when given and returns the schedule of the channel
+func (s *CommandService) PTZTimeTasks(ctx context.Context, camera *db.Camera, req *PTZTimeTaskRequest) (*hikvision.PTZTimeTask, error) {
+	client := s.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	if req.Settings != nil {
+		logger.SInfo("requested updating PTZ time tasks",
+			zap.String("camera_id", camera.CameraId),
+			zap.String("channel_id", channelId))
+		capabilities, err := client.Capabilities(ctx, channelId)
+		if err != nil {
+			logger.SError("failed to retrieve PTZ capabilities",
+				zap.Error(err))
+			return nil, err
+		}
+		if capabilities.TimeTaskList == nil {
+			return nil, custerror.FormatUnimplemented("camera does not support time tasks")
+		}
+		if err := capabilities.ValidateTimeTask(req.Settings); err != nil {
+			return nil, err
+		}
+		if err := client.SetTimeTask(ctx, channelId, req.Settings); err != nil {
+			logger.SError("failed to update PTZ time tasks",
+				zap.Error(err))
+			return nil, err
+		}
+	}
+
+	timeTask, err := client.TimeTask(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve PTZ time tasks",
+			zap.Error(err))
+		return nil, err
+	}
+	return timeTask, nil
+}
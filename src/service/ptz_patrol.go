@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	PTZPatrolActionList   = "list"
+	PTZPatrolActionSet    = "set"
+	PTZPatrolActionDelete = "delete"
+	PTZPatrolActionStart  = "start"
+	PTZPatrolActionStop   = "stop"
+)
+
+const (
+	PTZPatternActionRecordStart = "record_start"
+	PTZPatternActionRecordStop  = "record_stop"
+	PTZPatternActionRun         = "run"
+	PTZPatternActionStop        = "stop"
+)
+
+// PTZPatrolStop is a preset of the patrol, visited in order
+type PTZPatrolStop struct {
+	PresetId int `json:"presetId"`
+	// Dwell is how long in seconds the camera stays on the preset
+	Dwell int `json:"dwell"`
+	Speed int `json:"speed"`
+}
+
+type PTZPatrolRequest struct {
+	Action    string          `json:"action"`
+	ChannelId string          `json:"channelId,omitempty"`
+	PatrolId  int             `json:"patrolId"`
+	Name      string          `json:"name,omitempty"`
+	Stops     []PTZPatrolStop `json:"stops,omitempty"`
+}
+
+type PTZPatternRequest struct {
+	Action    string `json:"action"`
+	ChannelId string `json:"channelId,omitempty"`
+	PatternId int    `json:"patternId"`
+}
+
+var patternCommands = map[string]string{
+	PTZPatternActionRecordStart: hikvision.PTZPatternRecordStart,
+	PTZPatternActionRecordStop:  hikvision.PTZPatternRecordStop,
+	PTZPatternActionRun:         hikvision.PTZPatternRun,
+	PTZPatternActionStop:        hikvision.PTZPatternStop,
+}
+
+func (s *CommandService) PTZPatrols(ctx context.Context, camera *db.Camera, channelId string) (*hikvision.PTZPatrolList, error) {
+	logger.SDebug("requested listing PTZ patrols",
+		zap.String("camera_id", camera.CameraId))
+	patrols, err := s.hikvisionClient.
+		PtzCtrl(credentialsOf(camera)).
+		Patrols(ctx, s.channelIdOf(camera, channelId))
+	if err != nil {
+		logger.SError("failed to list PTZ patrols",
+			zap.Error(err))
+		return nil, err
+	}
+	return patrols, nil
+}
+
+// PTZSetPatrol defines the patrol from the ordered presets of the request
+func (s *CommandService) PTZSetPatrol(ctx context.Context, camera *db.Camera, req *PTZPatrolRequest) error {
+	logger.SInfo("requested saving PTZ patrol",
+		zap.String("camera_id", camera.CameraId),
+		zap.Int("patrol_id", req.PatrolId))
+	client := s.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	capabilities, err := patrolCapabilitiesOf(ctx, client, channelId)
+	if err != nil {
+		return err
+	}
+	patrol := &hikvision.PTZPatrol{
+		ID:         req.PatrolId,
+		PatrolName: req.Name,
+	}
+	for _, stop := range req.Stops {
+		patrol.Sequence = append(patrol.Sequence, &hikvision.PTZPatrolSequence{
+			PresetID: stop.PresetId,
+			Speed:    stop.Speed,
+			Delay:    stop.Dwell,
+		})
+	}
+	if err := capabilities.ValidatePatrol(patrol); err != nil {
+		return err
+	}
+	if err := client.SetPatrol(ctx, &hikvision.PtzCtrlSetPatrolRequest{
+		ChannelId: channelId,
+		Patrol:    patrol,
+	}); err != nil {
+		logger.SError("failed to save PTZ patrol",
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// PTZPatrolCommand deletes, starts or stops a patrol
+func (s *CommandService) PTZPatrolCommand(ctx context.Context, camera *db.Camera, req *PTZPatrolRequest) error {
+	logger.SInfo("requested PTZ patrol command",
+		zap.String("camera_id", camera.CameraId),
+		zap.String("action", req.Action),
+		zap.Int("patrol_id", req.PatrolId))
+	client := s.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	patrolReq := &hikvision.PtzCtrlPatrolRequest{
+		ChannelId: s.channelIdOf(camera, req.ChannelId),
+		PatrolId:  req.PatrolId,
+	}
+	capabilities, err := patrolCapabilitiesOf(ctx, client, patrolReq.ChannelId)
+	if err != nil {
+		return err
+	}
+	if err := capabilities.ValidateAction(&hikvision.PTZAction{
+		ActionType: hikvision.PTZActionPatrol,
+		ActionNum:  req.PatrolId,
+	}); err != nil {
+		return err
+	}
+
+	switch req.Action {
+	case PTZPatrolActionDelete:
+		err = client.DeletePatrol(ctx, patrolReq)
+	case PTZPatrolActionStart:
+		if err := s.claimPTZ(ctx, camera); err != nil {
+			return err
+		}
+		s.supersedeMoves(camera, patrolReq.ChannelId)
+		err = client.StartPatrol(ctx, patrolReq)
+	case PTZPatrolActionStop:
+		if err := s.claimPTZ(ctx, camera); err != nil {
+			return err
+		}
+		err = client.StopPatrol(ctx, patrolReq)
+	default:
+		return custerror.FormatInvalidArgument("unknown PTZ patrol action %q", req.Action)
+	}
+	if err != nil {
+		logger.SError("failed to execute PTZ patrol command",
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func patrolCapabilitiesOf(ctx context.Context, client hikvision.PtzApiClientInterface, channelId string) (*hikvision.PTZChannelCapabilities, error) {
+	capabilities, err := client.Capabilities(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve PTZ capabilities",
+			zap.Error(err))
+		return nil, err
+	}
+	if capabilities.MaxPatrolNum == 0 && !capabilities.IsSupportCruise {
+		return nil, custerror.FormatUnimplemented("camera does not support patrols")
+	}
+	return capabilities, nil
+}
+
+// PTZPattern records or plays back a pattern, recording starts from the current position
+// and keeps the moves made until the recording is stopped
+func (s *CommandService) PTZPattern(ctx context.Context, camera *db.Camera, req *PTZPatternRequest) error {
+	logger.SInfo("requested PTZ pattern command",
+		zap.String("camera_id", camera.CameraId),
+		zap.String("action", req.Action),
+		zap.Int("pattern_id", req.PatternId))
+	command, ok := patternCommands[req.Action]
+	if !ok {
+		return custerror.FormatInvalidArgument("unknown PTZ pattern action %q", req.Action)
+	}
+	client := s.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	channelId := s.channelIdOf(camera, req.ChannelId)
+	capabilities, err := client.Capabilities(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve PTZ capabilities",
+			zap.Error(err))
+		return err
+	}
+	if capabilities.MaxPatternNum == 0 {
+		return custerror.FormatUnimplemented("camera does not support patterns")
+	}
+	if err := capabilities.ValidatePattern(req.PatternId); err != nil {
+		return err
+	}
+	if err := s.claimPTZ(ctx, camera); err != nil {
+		return err
+	}
+	if command == hikvision.PTZPatternRun {
+		s.supersedeMoves(camera, channelId)
+	}
+	if err := client.Pattern(ctx, &hikvision.PtzCtrlPatternRequest{
+		ChannelId: channelId,
+		PatternId: req.PatternId,
+		Command:   command,
+	}); err != nil {
+		logger.SError("failed to execute PTZ pattern command",
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
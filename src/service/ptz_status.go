@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	PTZStatusSourceTrack   = "track_status"
+	PTZStatusSourceSampler = "sampler"
+)
+
+const (
+	ptzSampleInterval = 200 * time.Millisecond
+	ptzSampleHistory  = 2 * time.Second
+	// a channel whose position changed within the window is moving,
+	// long enough to notice slow pans between two samples
+	ptzMotionWindow = time.Second
+	// samplers nobody asked about for this long stop polling the camera
+	ptzSamplerIdle = 30 * time.Second
+)
+
+var errSamplerStopped = custerror.FormatUnavailable("PTZ status sampler stopped")
+
+// PTZVelocity is in position units per second, tenths of a degree for azimuth
+// and elevation and zoom steps for zoom
+type PTZVelocity struct {
+	Azimuth   float64 `json:"azimuth"`
+	Elevation float64 `json:"elevation"`
+	Zoom      float64 `json:"zoom"`
+}
+
+type PTZStatusResponse struct {
+	Moving    bool                    `json:"moving"`
+	Position  *hikvision.AbsoluteHigh `json:"position,omitempty"`
+	Velocity  *PTZVelocity            `json:"velocity,omitempty"`
+	Source    string                  `json:"source"`
+	SampledAt time.Time               `json:"sampledAt"`
+}
+
+type ptzSample struct {
+	at       time.Time
+	position hikvision.AbsoluteHigh
+}
+
+// azimuthDelta is the shortest signed turn between two azimuths
+func azimuthDelta(from int, to int) int {
+	return ((to-from)%3600+5400)%3600 - 1800
+}
+
+// estimateMotion derives the motion of the channel from its samples, oldest first,
+// the sample before the motion window is compared when the window only holds the latest
+func estimateMotion(samples []ptzSample, now time.Time) *PTZStatusResponse {
+	if len(samples) == 0 {
+		return &PTZStatusResponse{Source: PTZStatusSourceSampler}
+	}
+	latest := samples[len(samples)-1]
+	position := latest.position
+	resp := &PTZStatusResponse{
+		Position:  &position,
+		Velocity:  &PTZVelocity{},
+		Source:    PTZStatusSourceSampler,
+		SampledAt: latest.at,
+	}
+	start := len(samples) - 1
+	for i, sample := range samples {
+		if now.Sub(sample.at) <= ptzMotionWindow {
+			start = i
+			break
+		}
+	}
+	if start == len(samples)-1 && start > 0 {
+		start--
+	}
+	for _, sample := range samples[start:] {
+		if sample.position != latest.position {
+			resp.Moving = true
+			break
+		}
+	}
+	oldest := samples[start]
+	elapsed := latest.at.Sub(oldest.at).Seconds()
+	if elapsed > 0 {
+		resp.Velocity.Azimuth = float64(azimuthDelta(oldest.position.Azimuth, latest.position.Azimuth)) / elapsed
+		resp.Velocity.Elevation = float64(latest.position.Elevation-oldest.position.Elevation) / elapsed
+		resp.Velocity.Zoom = float64(latest.position.AbsoluteZoom-oldest.position.AbsoluteZoom) / elapsed
+	}
+	return resp
+}
+
+// ptzSampler polls the position of a channel in the background so status
+// requests are answered from its recent history, channels reporting their
+// track status are not polled
+type ptzSampler struct {
+	ready chan struct{}
+	err   error
+	// ctx ends the polling, it is cancelled by stopSamplers even while starting
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	trackStatus bool
+
+	mu        sync.Mutex
+	samples   []ptzSample
+	queriedAt time.Time
+	// pollErr is the error of the last poll, cleared by the next sample
+	pollErr error
+	// updated is closed and replaced whenever a poll ends
+	updated chan struct{}
+}
+
+func newPTZSampler() *ptzSampler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ptzSampler{
+		ready:     make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		queriedAt: time.Now(),
+		updated:   make(chan struct{}),
+	}
+}
+
+func (p *ptzSampler) add(sample ptzSample) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.samples = append(p.samples, sample)
+	trimmed := 0
+	for trimmed < len(p.samples)-1 && sample.at.Sub(p.samples[trimmed].at) > ptzSampleHistory {
+		trimmed++
+	}
+	p.samples = p.samples[trimmed:]
+	p.pollErr = nil
+	p.notify()
+}
+
+func (p *ptzSampler) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pollErr = err
+	p.notify()
+}
+
+// notify wakes up the requests waiting for a poll, p.mu must be held
+func (p *ptzSampler) notify() {
+	if p.updated != nil {
+		close(p.updated)
+	}
+	p.updated = make(chan struct{})
+}
+
+// estimate waits until the latest sample is recent and has one before it to be compared with,
+// it fails when the last poll failed and the samples are too old to tell the motion
+func (p *ptzSampler) estimate(ctx context.Context) (*PTZStatusResponse, error) {
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		p.queriedAt = now
+		fresh := len(p.samples) > 0 && now.Sub(p.samples[len(p.samples)-1].at) <= ptzMotionWindow
+		if fresh && len(p.samples) > 1 {
+			resp := estimateMotion(p.samples, now)
+			p.mu.Unlock()
+			return resp, nil
+		}
+		if !fresh && p.pollErr != nil {
+			err := p.pollErr
+			p.mu.Unlock()
+			return nil, err
+		}
+		updated := p.updated
+		p.mu.Unlock()
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// velocity is estimated from the positions read by the status requests of channels
+// with track status, it is unknown until two of them were made within the sample history
+func (p *ptzSampler) velocity() *PTZVelocity {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.samples) < 2 {
+		return nil
+	}
+	return estimateMotion(p.samples, p.samples[len(p.samples)-1].at).Velocity
+}
+
+func (p *ptzSampler) idle(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return now.Sub(p.queriedAt) > ptzSamplerIdle
+}
+
+// samplerOf returns the running sampler of the channel, starting it on the first request
+func (s *CommandService) samplerOf(ctx context.Context, client hikvision.PtzApiClientInterface, camera *db.Camera, channelId string) (*ptzSampler, error) {
+	key := ptzKeyOf(camera, channelId)
+	s.samplersMu.Lock()
+	sampler, found := s.samplers[key]
+	if !found {
+		sampler = newPTZSampler()
+		s.samplers[key] = sampler
+	}
+	s.samplersMu.Unlock()
+
+	if found {
+		select {
+		case <-sampler.ready:
+			return sampler, sampler.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if err := s.startSampler(ctx, client, key, channelId, sampler); err != nil {
+		sampler.cancel()
+		s.samplersMu.Lock()
+		if s.samplers[key] == sampler {
+			delete(s.samplers, key)
+		}
+		s.samplersMu.Unlock()
+		sampler.err = err
+		close(sampler.ready)
+		return nil, err
+	}
+	close(sampler.ready)
+	return sampler, nil
+}
+
+func (s *CommandService) startSampler(ctx context.Context, client hikvision.PtzApiClientInterface, key string, channelId string, sampler *ptzSampler) error {
+	capabilities, err := client.Capabilities(ctx, channelId)
+	if err != nil {
+		logger.SError("failed to retrieve PTZ capabilities",
+			zap.Error(err))
+		return err
+	}
+	if sampler.ctx.Err() != nil {
+		return errSamplerStopped
+	}
+	sampler.trackStatus = capabilities.IsSupportPTZTrackStatus
+	if sampler.trackStatus {
+		logger.SDebug("PTZ status is read from the track status",
+			zap.String("key", key))
+		return nil
+	}
+
+	logger.SDebug("started PTZ status sampler",
+		zap.String("key", key))
+	go func() {
+		defer func() {
+			sampler.cancel()
+			sampler.fail(errSamplerStopped)
+			s.samplersMu.Lock()
+			if s.samplers[key] == sampler {
+				delete(s.samplers, key)
+			}
+			s.samplersMu.Unlock()
+		}()
+		ticker := time.NewTicker(ptzSampleInterval)
+		defer ticker.Stop()
+		for {
+			status, err := client.Status(sampler.ctx, &hikvision.PtzCtrlStatusRequest{ChannelId: channelId})
+			if err != nil {
+				if sampler.ctx.Err() != nil {
+					return
+				}
+				logger.SDebug("failed to sample PTZ status",
+					zap.String("key", key),
+					zap.Error(err))
+				sampler.fail(err)
+			} else {
+				sampler.add(ptzSample{at: time.Now(), position: status.AbsoluteHigh})
+			}
+			select {
+			case <-sampler.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if sampler.idle(time.Now()) {
+				logger.SDebug("stopped idle PTZ status sampler",
+					zap.String("key", key))
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// stopSamplers stops every sampler, including the ones still starting
+func (s *CommandService) stopSamplers() {
+	s.samplersMu.Lock()
+	defer s.samplersMu.Unlock()
+	for key, sampler := range s.samplers {
+		sampler.cancel()
+		delete(s.samplers, key)
+	}
+}
+
+// PTZStatus reports whether the channel is moving along with its position and velocity,
+// the track status of the camera decides when supported and the sampled positions otherwise,
+// with track status the velocity is estimated from the positions of the previous requests
+func (s *CommandService) PTZStatus(ctx context.Context, camera *db.Camera, req *hikvision.PtzCtrlStatusRequest) (*PTZStatusResponse, error) {
+	ptzCtrl := s.hikvisionClient.PtzCtrl(credentialsOf(camera))
+	req.ChannelId = s.channelIdOf(camera, req.ChannelId)
+
+	sampler, err := s.samplerOf(ctx, ptzCtrl, camera, req.ChannelId)
+	if err != nil {
+		return nil, err
+	}
+	if !sampler.trackStatus {
+		resp, err := sampler.estimate(ctx)
+		if err != nil {
+			logger.SError("failed to sample PTZ status", zap.Error(err))
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	// both are read at once, the track status alone does not give the position
+	var trackStatus *hikvision.PTZTrackStatus
+	var trackErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		trackStatus, trackErr = ptzCtrl.TrackStatus(ctx, req.ChannelId)
+	}()
+	status, err := ptzCtrl.Status(ctx, req)
+	<-done
+	if trackErr != nil {
+		logger.SError("failed to retrieve PTZ track status", zap.Error(trackErr))
+		return nil, trackErr
+	}
+	if err != nil {
+		logger.SError("failed to retrieve PTZ status", zap.Error(err))
+		return nil, err
+	}
+	now := time.Now()
+	position := status.AbsoluteHigh
+	resp := &PTZStatusResponse{
+		Moving:    trackStatus.Moving(),
+		Position:  &position,
+		Source:    PTZStatusSourceTrack,
+		SampledAt: now,
+	}
+	// the positions read by the requests are the history the velocity is estimated from
+	sampler.add(ptzSample{at: now, position: position})
+	if resp.Moving {
+		resp.Velocity = sampler.velocity()
+	} else {
+		resp.Velocity = &PTZVelocity{}
+	}
+	return resp, nil
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+)
+
+func samplesOf(now time.Time, positions ...hikvision.AbsoluteHigh) []ptzSample {
+	samples := make([]ptzSample, 0, len(positions))
+	for i, position := range positions {
+		at := now.Add(-time.Duration(len(positions)-1-i) * ptzSampleInterval)
+		samples = append(samples, ptzSample{at: at, position: position})
+	}
+	return samples
+}
+
+func TestEstimateMotion(t *testing.T) {
+	now := time.Now()
+	still := hikvision.AbsoluteHigh{Azimuth: 100, Elevation: 50, AbsoluteZoom: 10}
+
+	resp := estimateMotion(samplesOf(now, still, still, still, still), now)
+	if resp.Moving {
+		t.Errorf("expected a still channel not to be moving")
+	}
+	if resp.Position == nil || *resp.Position != still {
+		t.Errorf("expected the latest position, got %+v", resp.Position)
+	}
+
+	zoomed := still
+	zoomed.AbsoluteZoom = 20
+	resp = estimateMotion(samplesOf(now, still, still, still, zoomed), now)
+	if !resp.Moving {
+		t.Errorf("expected a zoom-only move to be moving")
+	}
+	if resp.Velocity.Zoom <= 0 {
+		t.Errorf("expected a positive zoom velocity, got %v", resp.Velocity.Zoom)
+	}
+
+	panned := still
+	panned.Azimuth = 101
+	resp = estimateMotion(samplesOf(now, still, still, still, still, panned, panned), now)
+	if !resp.Moving {
+		t.Errorf("expected a slow pan to be moving")
+	}
+}
+
+func TestEstimateMotion_SparseSamples(t *testing.T) {
+	now := time.Now()
+	still := hikvision.AbsoluteHigh{Azimuth: 100, Elevation: 50, AbsoluteZoom: 10}
+	panned := still
+	panned.Azimuth = 110
+	// slow polls leave only the latest sample in the motion window
+	samples := []ptzSample{
+		{at: now.Add(-2 * ptzMotionWindow), position: still},
+		{at: now, position: panned},
+	}
+	if resp := estimateMotion(samples, now); !resp.Moving {
+		t.Errorf("expected the latest sample to be compared with the one before the window")
+	}
+}
+
+func TestEstimateMotion_AzimuthWrap(t *testing.T) {
+	now := time.Now()
+	resp := estimateMotion(samplesOf(now,
+		hikvision.AbsoluteHigh{Azimuth: 3590},
+		hikvision.AbsoluteHigh{Azimuth: 10},
+	), now)
+	want := 20 / ptzSampleInterval.Seconds()
+	if resp.Velocity.Azimuth != want {
+		t.Errorf("expected an azimuth velocity of %v across north, got %v", want, resp.Velocity.Azimuth)
+	}
+}
+
+func TestPTZSampler_History(t *testing.T) {
+	sampler := &ptzSampler{}
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		sampler.add(ptzSample{at: start.Add(time.Duration(i) * ptzSampleInterval)})
+	}
+	oldest := sampler.samples[0].at
+	latest := sampler.samples[len(sampler.samples)-1].at
+	if latest.Sub(oldest) > ptzSampleHistory {
+		t.Errorf("expected at most %s of history, got %s", ptzSampleHistory, latest.Sub(oldest))
+	}
+}
+
+func TestPTZSampler_Estimate(t *testing.T) {
+	still := hikvision.AbsoluteHigh{Azimuth: 100}
+	sampler := newPTZSampler()
+	sampler.add(ptzSample{at: time.Now(), position: still})
+
+	go func() {
+		time.Sleep(ptzSampleInterval)
+		sampler.add(ptzSample{at: time.Now(), position: still})
+	}()
+	resp, err := sampler.estimate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Moving {
+		t.Errorf("expected a still channel not to be moving")
+	}
+
+	stale := newPTZSampler()
+	stale.add(ptzSample{at: time.Now().Add(-2 * ptzMotionWindow), position: still})
+	stale.add(ptzSample{at: time.Now().Add(-ptzMotionWindow - ptzSampleInterval), position: still})
+	stale.fail(custerror.ErrorTimeout)
+	if _, err := stale.estimate(context.Background()); !errors.Is(err, custerror.ErrorTimeout) {
+		t.Errorf("expected stale samples to fail with the poll error, got %v", err)
+	}
+
+	single := newPTZSampler()
+	single.add(ptzSample{at: time.Now(), position: still})
+	ctx, cancel := context.WithTimeout(context.Background(), ptzSampleInterval)
+	defer cancel()
+	if _, err := single.estimate(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a single sample not to be answered, got %v", err)
+	}
+}
+
+// ptzCamera serves the PTZ status of a channel, with or without track status
+type ptzCamera struct {
+	trackStatus   bool
+	capabilities  chan struct{}
+	statusFails   atomic.Bool
+	statusQueries atomic.Int32
+	// azimuth is added to the reported azimuth of 100
+	azimuth atomic.Int32
+}
+
+func (c *ptzCamera) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/xml")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/capabilities"):
+		if c.capabilities != nil {
+			<-c.capabilities
+		}
+		if c.trackStatus {
+			w.Write([]byte(`<PTZChanelCap><isSupportPTZTrackStatus>true</isSupportPTZTrackStatus></PTZChanelCap>`))
+			return
+		}
+		w.Write([]byte(`<PTZChanelCap></PTZChanelCap>`))
+	case strings.HasSuffix(r.URL.Path, "/status"):
+		c.statusQueries.Add(1)
+		if c.statusFails.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `<PTZStatus><AbsoluteHigh><elevation>50</elevation><azimuth>%d</azimuth><absoluteZoom>10</absoluteZoom></AbsoluteHigh></PTZStatus>`, 100+c.azimuth.Load())
+	case strings.HasSuffix(r.URL.Path, "/PTZTrackStatus"):
+		w.Write([]byte(`<PTZTrackStatus><trackStatus>followMove</trackStatus></PTZTrackStatus>`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestCommandService_PTZStatus_Sampler(t *testing.T) {
+	camera := &ptzCamera{}
+	service, cam := newTestCommandService(t, camera)
+
+	resp, err := service.PTZStatus(context.Background(), cam, &hikvision.PtzCtrlStatusRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Source != PTZStatusSourceSampler || resp.Moving || resp.Position.Azimuth != 100 {
+		t.Errorf("expected a still channel from the sampler, got %+v", resp)
+	}
+
+	camera.statusFails.Store(true)
+	time.Sleep(ptzMotionWindow + 2*ptzSampleInterval)
+	if _, err := service.PTZStatus(context.Background(), cam, &hikvision.PtzCtrlStatusRequest{}); !errors.Is(err, custerror.ErrorUnavailable) {
+		t.Errorf("expected failed polls to fail the status, got %v", err)
+	}
+}
+
+func TestCommandService_PTZStatus_TrackStatus(t *testing.T) {
+	camera := &ptzCamera{trackStatus: true}
+	service, cam := newTestCommandService(t, camera)
+
+	resp, err := service.PTZStatus(context.Background(), cam, &hikvision.PtzCtrlStatusRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Source != PTZStatusSourceTrack || !resp.Moving || resp.Position.Azimuth != 100 {
+		t.Errorf("expected a moving channel from the track status, got %+v", resp)
+	}
+	if resp.Velocity != nil {
+		t.Errorf("expected no velocity from a single position, got %+v", resp.Velocity)
+	}
+	time.Sleep(3 * ptzSampleInterval)
+	if queries := camera.statusQueries.Load(); queries != 1 {
+		t.Errorf("expected no sampler polling a channel with track status, got %d status queries", queries)
+	}
+
+	camera.azimuth.Store(60)
+	resp, err = service.PTZStatus(context.Background(), cam, &hikvision.PtzCtrlStatusRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Velocity == nil || resp.Velocity.Azimuth <= 0 || resp.Velocity.Elevation != 0 {
+		t.Errorf("expected the velocity from the previous position, got %+v", resp.Velocity)
+	}
+}
+
+func TestCommandService_StopStartingSampler(t *testing.T) {
+	camera := &ptzCamera{capabilities: make(chan struct{})}
+	service, cam := newTestCommandService(t, camera)
+
+	done := make(chan error)
+	go func() {
+		_, err := service.PTZStatus(context.Background(), cam, &hikvision.PtzCtrlStatusRequest{})
+		done <- err
+	}()
+	// the sampler is starting once it is registered
+	for {
+		service.samplersMu.Lock()
+		starting := len(service.samplers) > 0
+		service.samplersMu.Unlock()
+		if starting {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	service.stopSamplers()
+	close(camera.capabilities)
+
+	if err := <-done; !errors.Is(err, custerror.ErrorUnavailable) {
+		t.Errorf("expected the stopped sampler to fail the status, got %v", err)
+	}
+	time.Sleep(3 * ptzSampleInterval)
+	if queries := camera.statusQueries.Load(); queries != 0 {
+		t.Errorf("expected the stopped sampler not to poll, got %d status queries", queries)
+	}
+}
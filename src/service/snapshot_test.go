@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestCommandService_Snapshot(t *testing.T) {
+	var requested string
+	service, camera := newTestCommandService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("jpeg"))
+	}))
+
+	picture, err := service.Snapshot(context.Background(), camera, &SnapshotRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(picture) != "jpeg" {
+		t.Errorf("expected the picture of the camera, got %q", picture)
+	}
+	if requested != "/ISAPI/Streaming/channels/101/picture" {
+		t.Errorf("expected the main stream of the first channel, got %s", requested)
+	}
+
+	if _, err := service.Snapshot(context.Background(), camera, &SnapshotRequest{ChannelId: "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if requested != "/ISAPI/Streaming/channels/301/picture" {
+		t.Errorf("expected the main stream of the requested channel, got %s", requested)
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/CE-Thesis-2023/backend/src/models/web"
+	"github.com/CE-Thesis-2023/ltd/src/internal/configs"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	custff "github.com/CE-Thesis-2023/ltd/src/internal/ffmpeg"
+	custprobe "github.com/CE-Thesis-2023/ltd/src/internal/ffprobe"
+)
+
+// StreamConfiguration is the stream configuration of the control plane with its encoding,
+// settings left unset fall back to the defaults of the device
+type StreamConfiguration struct {
+	web.TranscoderStreamConfiguration
+	configs.FfmpegEncodingConfigs
+}
+
+type GetStreamConfigurationsResponse struct {
+	StreamConfigurations []StreamConfiguration `json:"streamConfigurations"`
+}
+
+// builtinStreamDefaults apply when neither the stream nor the device configure a setting
+var builtinStreamDefaults = configs.FfmpegConfigs{
+	Fps:    20,
+	Width:  1280,
+	Height: 720,
+	FfmpegEncodingConfigs: configs.FfmpegEncodingConfigs{
+		Codec:                "libx264",
+		Preset:               "faster",
+		Tune:                 "zerolatency",
+		Container:            "mpegts",
+		HardwareAcceleration: string(custff.CPU),
+	},
+}
+
+func orDefault[T comparable](value T, defaults ...T) T {
+	var zero T
+	for _, v := range append([]T{value}, defaults...) {
+		if v != zero {
+			return v
+		}
+	}
+	return zero
+}
+
+// withDefaults fills the unset settings from the device defaults, then the builtin ones
+func (s StreamConfiguration) withDefaults(device *configs.FfmpegConfigs) StreamConfiguration {
+	if device == nil {
+		device = &configs.FfmpegConfigs{}
+	}
+	builtin := &builtinStreamDefaults
+	s.Fps = orDefault(s.Fps, device.Fps, builtin.Fps)
+	s.Width = orDefault(s.Width, device.Width, builtin.Width)
+	s.Height = orDefault(s.Height, device.Height, builtin.Height)
+	s.Codec = orDefault(s.Codec, device.Codec, builtin.Codec)
+	s.Preset = orDefault(s.Preset, device.Preset, builtin.Preset)
+	s.Tune = orDefault(s.Tune, device.Tune, builtin.Tune)
+	s.Bitrate = orDefault(s.Bitrate, device.Bitrate, builtin.Bitrate)
+	s.Crf = orDefault(s.Crf, device.Crf, builtin.Crf)
+	s.Gop = orDefault(s.Gop, device.Gop, builtin.Gop)
+	s.Container = orDefault(s.Container, device.Container, builtin.Container)
+	s.HardwareAcceleration = orDefault(s.HardwareAcceleration, device.HardwareAcceleration, builtin.HardwareAcceleration)
+	return s
+}
+
+func (s StreamConfiguration) validate() error {
+	switch custff.FFmpegHardwareAccelerationType(s.HardwareAcceleration) {
+	case "", custff.CPU, custff.VA_API, custff.QUICKSYNC:
+	default:
+		return custerror.FormatInvalidArgument("unknown hardware acceleration %q", s.HardwareAcceleration)
+	}
+	if s.Fps < 0 || s.Width < 0 || s.Height < 0 {
+		return custerror.FormatInvalidArgument("stream size must not be negative, got %dx%d@%d", s.Width, s.Height, s.Fps)
+	}
+	if s.Crf != nil && (*s.Crf < 0 || *s.Crf > 51) {
+		return custerror.FormatInvalidArgument("CRF must be in [0, 51], got %d", *s.Crf)
+	}
+	if s.Gop < 0 {
+		return custerror.FormatInvalidArgument("GOP must not be negative, got %d", s.Gop)
+	}
+	return nil
+}
+
+// Equal compares the configurations by value, the CRF included, configurations
+// are decoded anew on every reconcile so their CRF pointers always differ
+func (s StreamConfiguration) Equal(other StreamConfiguration) bool {
+	if (s.Crf == nil) != (other.Crf == nil) || (s.Crf != nil && *s.Crf != *other.Crf) {
+		return false
+	}
+	s.Crf, other.Crf = nil, nil
+	return s == other
+}
+
+// outputArguments are the FFmpeg encoding arguments of the stream
+func (s StreamConfiguration) outputArguments() []custff.Argument {
+	args := []custff.Argument{
+		custff.Arg("f", s.Container),
+		custff.Arg("c:v", s.Codec),
+	}
+	if s.Preset != "" {
+		args = append(args, custff.Arg("preset:v", s.Preset))
+	}
+	if s.Tune != "" {
+		args = append(args, custff.Arg("tune:v", s.Tune))
+	}
+	if s.Bitrate != "" {
+		args = append(args, custff.Arg("b:v", s.Bitrate))
+	}
+	if s.Crf != nil {
+		args = append(args, custff.Arg("crf", strconv.Itoa(*s.Crf)))
+	}
+	if s.Gop > 0 {
+		args = append(args, custff.Arg("g", strconv.Itoa(s.Gop)))
+	}
+	return args
+}
+
+// codecFamilyOf names the format an encoder or a probed codec produces
+func codecFamilyOf(codec string) string {
+	codec = strings.ToLower(codec)
+	switch {
+	case strings.Contains(codec, "264"):
+		return "h264"
+	case strings.Contains(codec, "265"), strings.Contains(codec, "hevc"):
+		return "hevc"
+	}
+	return codec
+}
+
+// matches tells whether the source already has the codec, size and frame rate of the stream,
+// a bitrate, CRF or GOP can only be applied by encoding so the source never matches with one
+func (s StreamConfiguration) matches(video *custprobe.Stream) bool {
+	if s.Bitrate != "" || s.Crf != nil || s.Gop > 0 {
+		return false
+	}
+	if codecFamilyOf(video.CodecName) != codecFamilyOf(s.Codec) {
+		return false
+	}
+	if video.Width != s.Width || video.Height != s.Height {
+		return false
+	}
+	return math.Abs(video.Fps-float64(s.Fps)) < 0.5
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	custff "github.com/CE-Thesis-2023/ltd/src/internal/ffmpeg"
+)
+
+// streamStatsPeriod is how often FFmpeg reports the progress of a stream
+const streamStatsPeriod = 5 * time.Second
+
+// StreamStats is the live progress of the FFmpeg process of a camera
+type StreamStats struct {
+	CameraId  string    `json:"cameraId"`
+	Running   bool      `json:"running"`
+	StartedAt time.Time `json:"startedAt"`
+	// UpdatedAt is unset until FFmpeg reports its first progress
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// Restarts counts the processes started for the stream after the first one
+	Restarts       int     `json:"restarts"`
+	Frame          int64   `json:"frame"`
+	Fps            float64 `json:"fps"`
+	BitrateKbps    float64 `json:"bitrateKbps"`
+	TotalSize      int64   `json:"totalSize"`
+	OutTimeSeconds float64 `json:"outTimeSeconds"`
+	DupFrames      int64   `json:"dupFrames"`
+	DropFrames     int64   `json:"dropFrames"`
+	Speed          float64 `json:"speed"`
+
+	// process reporting the stats, reports of a replaced process are dropped
+	process *Process
+}
+
+func (s *StreamStats) apply(progress *custff.Progress, now time.Time) {
+	s.UpdatedAt = &now
+	s.Running = !progress.Ended
+	s.Frame = progress.Frame
+	s.Fps = progress.Fps
+	s.BitrateKbps = progress.Bitrate
+	s.TotalSize = progress.TotalSize
+	s.OutTimeSeconds = progress.OutTime.Seconds()
+	s.DupFrames = progress.DupFrames
+	s.DropFrames = progress.DropFrames
+	s.Speed = progress.Speed
+}
+
+// StreamStats returns a copy of the stats of every registered stream, ordered by camera
+func (c *MediaController) StreamStats() []StreamStats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	stats := make([]StreamStats, 0, len(c.stats))
+	for _, s := range c.stats {
+		stat := *s
+		stat.process = nil
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].CameraId < stats[j].CameraId
+	})
+	return stats
+}
+
+// trackStats resets the stats of the camera to the newly started process
+func (c *MediaController) trackStats(cameraId string, p *Process) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	stats := &StreamStats{
+		CameraId:  cameraId,
+		Running:   true,
+		StartedAt: time.Now(),
+		process:   p,
+	}
+	if previous, found := c.stats[cameraId]; found {
+		stats.Restarts = previous.Restarts + 1
+	}
+	c.stats[cameraId] = stats
+}
+
+func (c *MediaController) updateStats(cameraId string, p *Process, progress *custff.Progress) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	stats, found := c.stats[cameraId]
+	if !found || stats.process != p {
+		return
+	}
+	stats.apply(progress, time.Now())
+}
+
+func (c *MediaController) exitedStats(cameraId string, p *Process) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	stats, found := c.stats[cameraId]
+	if !found || stats.process != p {
+		return
+	}
+	stats.Running = false
+}
+
+func (c *MediaController) dropStats(cameraId string) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	delete(c.stats, cameraId)
+}
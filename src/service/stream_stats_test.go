@@ -0,0 +1,58 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	custff "github.com/CE-Thesis-2023/ltd/src/internal/ffmpeg"
+)
+
+func TestMediaController_StreamStats(t *testing.T) {
+	c := NewMediaController(nil)
+	first := &Process{cameraId: "camera-1"}
+	c.trackStats("camera-1", first)
+	c.updateStats("camera-1", first, &custff.Progress{
+		Frame:   100,
+		Fps:     25,
+		Bitrate: 1200,
+		OutTime: 4 * time.Second,
+		Speed:   1,
+	})
+
+	stats := c.StreamStats()
+	if len(stats) != 1 {
+		t.Fatalf("expected the stats of one stream, got %d", len(stats))
+	}
+	if !stats[0].Running || stats[0].Frame != 100 || stats[0].OutTimeSeconds != 4 || stats[0].UpdatedAt == nil {
+		t.Errorf("unexpected stats %+v", stats[0])
+	}
+
+	// a restarted stream drops the reports of the process it replaced
+	second := &Process{cameraId: "camera-1"}
+	c.trackStats("camera-1", second)
+	c.updateStats("camera-1", first, &custff.Progress{Frame: 500})
+	c.exitedStats("camera-1", first)
+	stats = c.StreamStats()
+	if stats[0].Restarts != 1 || !stats[0].Running || stats[0].Frame != 0 {
+		t.Errorf("expected the stats of the new process only, got %+v", stats[0])
+	}
+	payload, err := json.Marshal(stats[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(payload), "updatedAt") {
+		t.Errorf("expected no update time before the first report, got %s", payload)
+	}
+
+	c.exitedStats("camera-1", second)
+	if stats := c.StreamStats(); stats[0].Running {
+		t.Errorf("expected the stream to be stopped once its process exited")
+	}
+
+	c.dropStats("camera-1")
+	if stats := c.StreamStats(); len(stats) != 0 {
+		t.Errorf("expected no stats once the stream is removed, got %+v", stats)
+	}
+}
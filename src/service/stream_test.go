@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CE-Thesis-2023/ltd/src/internal/configs"
+	custff "github.com/CE-Thesis-2023/ltd/src/internal/ffmpeg"
+	custprobe "github.com/CE-Thesis-2023/ltd/src/internal/ffprobe"
+)
+
+func TestStreamConfiguration_Decode(t *testing.T) {
+	body := `{"cameraId":"camera-1","sourceUrl":"rtsp://camera","publishUrl":"srt://server","fps":15,"width":640,"height":360,"codec":"h264_vaapi","hardwareAcceleration":"vaapi","gop":30}`
+	var stream StreamConfiguration
+	if err := json.Unmarshal([]byte(body), &stream); err != nil {
+		t.Fatalf("failed to decode stream configuration: %v", err)
+	}
+	if stream.CameraId != "camera-1" || stream.Fps != 15 || stream.Height != 360 {
+		t.Errorf("expected the control plane fields, got %+v", stream.TranscoderStreamConfiguration)
+	}
+	if stream.Codec != "h264_vaapi" || stream.HardwareAcceleration != "vaapi" || stream.Gop != 30 {
+		t.Errorf("expected the encoding fields, got %+v", stream.FfmpegEncodingConfigs)
+	}
+}
+
+func TestStreamConfiguration_WithDefaults(t *testing.T) {
+	var stream StreamConfiguration
+	stream.Width = 640
+	stream.Preset = "veryfast"
+	device := &configs.FfmpegConfigs{
+		Width:  1920,
+		Height: 1080,
+		FfmpegEncodingConfigs: configs.FfmpegEncodingConfigs{
+			Preset:  "medium",
+			Bitrate: "2M",
+		},
+	}
+
+	settings := stream.withDefaults(device)
+	if settings.Width != 640 || settings.Preset != "veryfast" {
+		t.Errorf("expected the stream settings to win, got %dpx %s", settings.Width, settings.Preset)
+	}
+	if settings.Height != 1080 || settings.Bitrate != "2M" {
+		t.Errorf("expected the device defaults, got %dpx %s", settings.Height, settings.Bitrate)
+	}
+	if settings.Fps != builtinStreamDefaults.Fps || settings.Container != "mpegts" || settings.Codec != "libx264" {
+		t.Errorf("expected the builtin defaults, got %+v", settings)
+	}
+
+	want := []custff.Argument{
+		custff.Arg("f", "mpegts"),
+		custff.Arg("c:v", "libx264"),
+		custff.Arg("preset:v", "veryfast"),
+		custff.Arg("tune:v", "zerolatency"),
+		custff.Arg("b:v", "2M"),
+	}
+	if args := settings.outputArguments(); !reflect.DeepEqual(args, want) {
+		t.Errorf("expected output arguments %v, got %v", want, args)
+	}
+}
+
+func TestStreamConfiguration_Validate(t *testing.T) {
+	var stream StreamConfiguration
+	stream.HardwareAcceleration = "cuda"
+	if err := stream.validate(); err == nil {
+		t.Errorf("expected an unknown hardware acceleration to be rejected")
+	}
+	stream.HardwareAcceleration = "vaapi"
+	crf := 60
+	stream.Crf = &crf
+	if err := stream.validate(); err == nil {
+		t.Errorf("expected an out of range CRF to be rejected")
+	}
+	crf = 0
+	if err := stream.validate(); err != nil {
+		t.Errorf("expected a lossless CRF to be accepted, got %v", err)
+	}
+	want := custff.Arg("crf", "0")
+	if args := stream.outputArguments(); args[len(args)-1] != want {
+		t.Errorf("expected a CRF of 0 to be passed to FFmpeg, got %v", args)
+	}
+}
+
+func TestMediaController_NeedReconcile(t *testing.T) {
+	c := NewMediaController(nil)
+	var old StreamConfiguration
+	old.Width, old.Height = 1280, 720
+	new := old
+	new.Height = 1080
+	if !c.needReconcile(old, new) {
+		t.Errorf("expected a height change to restart the stream")
+	}
+	new = old
+	new.Bitrate = "4M"
+	if !c.needReconcile(old, new) {
+		t.Errorf("expected an encoding change to restart the stream")
+	}
+	oldCrf, newCrf := 23, 23
+	old.Crf = &oldCrf
+	new = old
+	new.Crf = &newCrf
+	if c.needReconcile(old, new) {
+		t.Errorf("expected the same CRF decoded twice not to restart the stream")
+	}
+	newCrf = 0
+	if !c.needReconcile(old, new) {
+		t.Errorf("expected a CRF change to restart the stream")
+	}
+	if c.needReconcile(old, old) {
+		t.Errorf("expected an unchanged stream to keep running")
+	}
+}
+
+func TestStreamConfiguration_Matches(t *testing.T) {
+	var stream StreamConfiguration
+	stream.Fps, stream.Width, stream.Height = 25, 1280, 720
+	stream = stream.withDefaults(nil)
+	source := &custprobe.Stream{
+		CodecType: custprobe.CodecTypeVideo,
+		CodecName: "h264",
+		Width:     1280,
+		Height:    720,
+		Fps:       25,
+	}
+	if !stream.matches(source) {
+		t.Errorf("expected an H.264 source at the target size and rate to be copied")
+	}
+	source.CodecName = "hevc"
+	if stream.matches(source) {
+		t.Errorf("expected an HEVC source to be transcoded to H.264")
+	}
+	source.CodecName = "h264"
+	source.Height = 1080
+	if stream.matches(source) {
+		t.Errorf("expected a larger source to be scaled")
+	}
+	source.Height = 720
+
+	encoded := stream
+	encoded.Bitrate = "1M"
+	if encoded.matches(source) {
+		t.Errorf("expected a bitrate to be applied by transcoding")
+	}
+	crf := 23
+	encoded = stream
+	encoded.Crf = &crf
+	if encoded.matches(source) {
+		t.Errorf("expected a CRF to be applied by transcoding")
+	}
+	encoded = stream
+	encoded.Gop = 50
+	if encoded.matches(source) {
+		t.Errorf("expected a GOP to be applied by transcoding")
+	}
+}
+
+func TestMediaService_PassthroughWithG711Audio(t *testing.T) {
+	var stream StreamConfiguration
+	stream.SourceUrl = "rtsp://192.168.1.64:554/Streaming/Channels/101"
+	stream.PublishUrl = "srt://server:8890?streamid=publish:camera"
+	stream.Fps, stream.Width, stream.Height = 25, 1280, 720
+	stream = stream.withDefaults(nil)
+	source := &custprobe.ProbeResult{Streams: []*custprobe.Stream{
+		{CodecType: custprobe.CodecTypeVideo, CodecName: "h264", Width: 1280, Height: 720, Fps: 25},
+		{CodecType: custprobe.CodecTypeAudio, CodecName: "pcm_mulaw", SampleRate: 8000, Channels: 1},
+	}}
+	if !sourceMatches(source, &stream) {
+		t.Fatalf("expected the video of the source to be copied whatever its audio")
+	}
+
+	cmd := (&mediaService{}).buildFfmpegRestreamingCommand(context.Background(), &stream, true, false)
+	args := strings.Join(cmd.Args, " ")
+	if !strings.Contains(args, " -c:v copy ") {
+		t.Errorf("expected the video to be copied, got %s", args)
+	}
+	if strings.Contains(args, " -c copy ") {
+		t.Errorf("expected the G.711 audio not to be copied into MPEG-TS, got %s", args)
+	}
+}
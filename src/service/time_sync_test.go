@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
+)
+
+// timeCamera serves the time of a camera in UTC+7 whose clock is an hour ahead
+type timeCamera struct {
+	setTime      *hikvision.SystemTime
+	setNTPServer *hikvision.NTPServer
+}
+
+func (c *timeCamera) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/xml")
+	switch {
+	case r.URL.Path == "/ISAPI/System/time" && r.Method == http.MethodGet:
+		localTime := time.Now().Add(time.Hour).In(time.FixedZone("CST", 7*3600)).Format("2006-01-02T15:04:05")
+		w.Write([]byte(`<Time><timeMode>manual</timeMode><localTime>` + localTime + `</localTime><timeZone>CST-7:00:00</timeZone></Time>`))
+	case r.URL.Path == "/ISAPI/System/time" && r.Method == http.MethodPut:
+		c.setTime = &hikvision.SystemTime{}
+		body, _ := io.ReadAll(r.Body)
+		xml.Unmarshal(body, c.setTime)
+	case r.URL.Path == "/ISAPI/System/time/ntpServers/1" && r.Method == http.MethodPut:
+		c.setNTPServer = &hikvision.NTPServer{}
+		body, _ := io.ReadAll(r.Body)
+		xml.Unmarshal(body, c.setNTPServer)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestCommandService_TimeSync_Manual(t *testing.T) {
+	camera := &timeCamera{}
+	service, cam := newTestCommandService(t, camera)
+
+	resp, err := service.TimeSync(context.Background(), cam, &TimeSyncRequest{Mode: TimeSyncModeManual})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Drift < 3590 || resp.Drift > 3610 {
+		t.Errorf("expected the camera to be an hour ahead, got a drift of %v", resp.Drift)
+	}
+	if camera.setTime == nil {
+		t.Fatalf("expected the camera time to be set")
+	}
+	if camera.setTime.TimeMode != hikvision.TimeModeManual || camera.setTime.TimeZone != "CST-7:00:00" {
+		t.Errorf("expected the manual mode in the time zone of the camera, got %+v", camera.setTime)
+	}
+	written, err := time.Parse(time.RFC3339, camera.setTime.LocalTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := written.Zone(); offset != 7*3600 {
+		t.Errorf("expected the local time in the time zone of the camera, got %s", camera.setTime.LocalTime)
+	}
+	if d := time.Since(written); d < -10*time.Second || d > 10*time.Second {
+		t.Errorf("expected the current time, got %s", camera.setTime.LocalTime)
+	}
+	if camera.setNTPServer != nil {
+		t.Errorf("expected the NTP server to be left alone")
+	}
+
+	if _, err := service.TimeSync(context.Background(), cam, &TimeSyncRequest{TimeZone: "EST+5:00:00"}); err != nil {
+		t.Fatal(err)
+	}
+	written, _ = time.Parse(time.RFC3339, camera.setTime.LocalTime)
+	if _, offset := written.Zone(); offset != -5*3600 || camera.setTime.TimeZone != "EST+5:00:00" {
+		t.Errorf("expected the local time in the requested time zone, got %+v", camera.setTime)
+	}
+
+	_, err = service.TimeSync(context.Background(), cam, &TimeSyncRequest{TimeZone: "+5"})
+	if !errors.Is(err, custerror.ErrorInvalidArgument) {
+		t.Errorf("expected a malformed time zone to be rejected, got %v", err)
+	}
+}
+
+func TestCommandService_TimeSync_NTP(t *testing.T) {
+	camera := &timeCamera{}
+	service, cam := newTestCommandService(t, camera)
+
+	_, err := service.TimeSync(context.Background(), cam, &TimeSyncRequest{Mode: TimeSyncModeNTP})
+	if !errors.Is(err, custerror.ErrorInvalidArgument) || camera.setTime != nil {
+		t.Errorf("expected the ntp mode without a server to be rejected, got %v", err)
+	}
+
+	if _, err := service.TimeSync(context.Background(), cam, &TimeSyncRequest{
+		Mode:         TimeSyncModeNTP,
+		NtpServer:    "pool.ntp.org",
+		SyncInterval: 60,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if camera.setNTPServer == nil || camera.setNTPServer.HostName != "pool.ntp.org" {
+		t.Fatalf("expected the NTP server to be set, got %+v", camera.setNTPServer)
+	}
+	if camera.setTime == nil || camera.setTime.TimeMode != hikvision.TimeModeNTP || camera.setTime.LocalTime != "" {
+		t.Errorf("expected the NTP mode without a local time, got %+v", camera.setTime)
+	}
+
+	_, err = service.TimeSync(context.Background(), cam, &TimeSyncRequest{Mode: "gps"})
+	if !errors.Is(err, custerror.ErrorInvalidArgument) {
+		t.Errorf("expected an unknown mode to be rejected, got %v", err)
+	}
+}
+
+func TestNtpServerOf(t *testing.T) {
+	tests := []struct {
+		req  TimeSyncRequest
+		want hikvision.NTPServer
+	}{
+		{
+			TimeSyncRequest{NtpServer: "pool.ntp.org"},
+			hikvision.NTPServer{ID: "1", AddressingFormatType: hikvision.AddressingFormatHostname, HostName: "pool.ntp.org", PortNo: 123},
+		},
+		{
+			TimeSyncRequest{NtpServer: "10.0.0.1", NtpPort: 1123, SyncInterval: 30},
+			hikvision.NTPServer{ID: "1", AddressingFormatType: hikvision.AddressingFormatIpAddress, IpAddress: "10.0.0.1", PortNo: 1123, SynchronizeInterval: 30},
+		},
+		{
+			TimeSyncRequest{NtpServer: "fe80::1"},
+			hikvision.NTPServer{ID: "1", AddressingFormatType: hikvision.AddressingFormatIpAddress, IpAddress: "fe80::1", PortNo: 123},
+		},
+	}
+	for _, tt := range tests {
+		if got := ntpServerOf(&tt.req); *got != tt.want {
+			t.Errorf("server %q, expected %+v, got %+v", tt.req.NtpServer, tt.want, *got)
+		}
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"path"
+	"strconv"
 	"time"
 
-	"github.com/CE-Thesis-2023/backend/src/models/events"
+	"github.com/CE-Thesis-2023/backend/src/models/db"
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
 	"github.com/CE-Thesis-2023/ltd/src/internal/hikvision"
 	"github.com/CE-Thesis-2023/ltd/src/internal/logger"
 	"github.com/CE-Thesis-2023/ltd/src/reconciler"
@@ -16,15 +19,17 @@ import (
 )
 
 type HttpSidecar struct {
-	server         *http.Server
-	commandService *service.CommandService
-	metadata       reconciler.Metadata
+	server          *http.Server
+	commandService  *service.CommandService
+	mediaController *service.MediaController
+	metadata        reconciler.Metadata
 }
 
-func NewHttpSidecar(commandService *service.CommandService, metadata reconciler.Metadata) *HttpSidecar {
+func NewHttpSidecar(commandService *service.CommandService, mediaController *service.MediaController, metadata reconciler.Metadata) *HttpSidecar {
 	s := &HttpSidecar{
-		commandService: commandService,
-		metadata:       metadata,
+		commandService:  commandService,
+		mediaController: mediaController,
+		metadata:        metadata,
 	}
 	s.init()
 	return s
@@ -34,10 +39,51 @@ func (s *HttpSidecar) init() {
 	s.server = &http.Server{
 		Addr:        ":5600",
 		ReadTimeout: 5 * time.Second,
-		Handler:     s.newServeMux(),
+		Handler:     trackerHandler(s.newServeMux()),
 	}
 }
 
+// trackerHandler marks the requests as coming from the OpenGate tracker,
+// which yields PTZ control to operators
+func trackerHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(service.WithPTZClient(r.Context(), service.PTZClientTracker)))
+	})
+}
+
+// writePTZError answers with the lease when PTZ control is held by an operator
+func writePTZError(w http.ResponseWriter, err error) {
+	var leaseErr *service.PTZLeaseError
+	if errors.As(err, &leaseErr) {
+		resp, err := json.Marshal(leaseErr.Lease)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().
+			Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		w.Write(resp)
+		return
+	}
+	writeError(w, err)
+}
+
+// writeError answers with the status of a custom error, other errors are internal,
+// timeouts are of the camera or the stream behind the sidecar and answered as such
+func writeError(w http.ResponseWriter, err error) {
+	var customErr *custerror.CustomError
+	if errors.As(err, &customErr) && customErr.Code >= 400 && customErr.Code < 600 {
+		if customErr.Code == http.StatusRequestTimeout {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(int(customErr.Code))
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
 func (s *HttpSidecar) Start() error {
 	logger.SInfo("Starting HTTP sidecar",
 		zap.String("addr", s.server.Addr))
@@ -66,8 +112,27 @@ func (s *HttpSidecar) newServeMux() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/ptz/status", s.handlePtzStatus)
 	mux.HandleFunc("/ptz/relative", s.handlePtzRelative)
+	mux.HandleFunc("/ptz/absolute", s.handlePtzAbsolute)
 	mux.HandleFunc("/ptz/capabilities", s.handlePtzCapabilities)
 	mux.HandleFunc("/ptz/continuous", s.handlePtzContinuous)
+	mux.HandleFunc("/ptz/presets", s.handlePtzPresets)
+	mux.HandleFunc("/ptz/presets/goto", s.handlePtzGotoPreset)
+	mux.HandleFunc("/ptz/home", s.handlePtzHome)
+	mux.HandleFunc("/ptz/home/goto", s.handlePtzHome)
+	mux.HandleFunc("/ptz/park", s.handlePtzPark)
+	mux.HandleFunc("/ptz/timetasks", s.handlePtzTimeTasks)
+	mux.HandleFunc("/ptz/patrols", s.handlePtzPatrols)
+	mux.HandleFunc("/ptz/patrols/start", s.handlePtzPatrolCommand)
+	mux.HandleFunc("/ptz/patrols/stop", s.handlePtzPatrolCommand)
+	mux.HandleFunc("/ptz/patterns/record_start", s.handlePtzPattern)
+	mux.HandleFunc("/ptz/patterns/record_stop", s.handlePtzPattern)
+	mux.HandleFunc("/ptz/patterns/run", s.handlePtzPattern)
+	mux.HandleFunc("/ptz/patterns/stop", s.handlePtzPattern)
+	mux.HandleFunc("/ptz/limits", s.handlePtzLimits)
+	mux.HandleFunc("/snapshot", s.handleSnapshot)
+	mux.HandleFunc("/channels", s.handleChannels)
+	mux.HandleFunc("/probe", s.handleProbe)
+	mux.HandleFunc("/streams", s.handleStreams)
 	return mux
 }
 
@@ -83,7 +148,7 @@ func (s *HttpSidecar) handlePtzContinuous(w http.ResponseWriter, r *http.Request
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	var req events.PTZCtrlRequest
+	var req service.PTZCtrlRequest
 	if err := json.
 		NewDecoder(r.Body).
 		Decode(&req); err != nil {
@@ -94,7 +159,7 @@ func (s *HttpSidecar) handlePtzContinuous(w http.ResponseWriter, r *http.Request
 	if err := s.commandService.PtzCtrl(r.Context(), camera, &req); err != nil {
 		logger.SError("failed to send PTZ continuous command",
 			zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writePTZError(w, err)
 		return
 	}
 
@@ -115,13 +180,13 @@ func (s *HttpSidecar) handlePtzStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	info, err := s.commandService.PTZStatus(
-		context.Background(),
+		r.Context(),
 		camera,
 		&hikvision.PtzCtrlStatusRequest{
-			ChannelId: "1",
+			ChannelId: query.Get("channel"),
 		})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 	resp, err := json.Marshal(info)
@@ -157,7 +222,7 @@ func (s *HttpSidecar) handlePtzRelative(w http.ResponseWriter, r *http.Request)
 	if err := s.commandService.PTZRelative(r.Context(), camera, &req); err != nil {
 		logger.SError("failed to send PTZ relative command",
 			zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writePTZError(w, err)
 		return
 	}
 
@@ -176,7 +241,7 @@ func (s *HttpSidecar) handlePtzCapabilities(w http.ResponseWriter, r *http.Reque
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	capabilities, err := s.commandService.PTZCapabilties(r.Context(), camera)
+	capabilities, err := s.commandService.PTZCapabilties(r.Context(), camera, query.Get("channel"))
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -190,3 +255,452 @@ func (s *HttpSidecar) handlePtzCapabilities(w http.ResponseWriter, r *http.Reque
 	w.Header().
 		Add("Content-Type", "application/json")
 }
+
+func (s *HttpSidecar) cameraFromQuery(w http.ResponseWriter, r *http.Request) (*db.Camera, bool) {
+	cameraName := r.URL.Query().Get("name")
+	if len(cameraName) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	camera, err := s.metadata.GetCameraByName(cameraName)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+	return camera, true
+}
+
+func (s *HttpSidecar) handlePtzPresets(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		presets, err := s.commandService.PTZPresets(r.Context(), camera, r.URL.Query().Get("channel"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		resp, err := json.Marshal(presets)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().
+			Add("Content-Type", "application/json")
+		w.Write(resp)
+	case http.MethodPut, http.MethodPost:
+		var req service.PTZPresetRequest
+		if err := json.
+			NewDecoder(r.Body).
+			Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := s.commandService.PTZSetPreset(r.Context(), camera, &req); err != nil {
+			logger.SError("failed to save PTZ preset",
+				zap.Error(err))
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		presetId, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := s.commandService.PTZDeletePreset(r.Context(), camera, r.URL.Query().Get("channel"), presetId); err != nil {
+			logger.SError("failed to delete PTZ preset",
+				zap.Error(err))
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *HttpSidecar) handlePtzGotoPreset(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	presetId, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := s.commandService.PTZGotoPreset(r.Context(), camera, r.URL.Query().Get("channel"), presetId); err != nil {
+		logger.SError("failed to move to PTZ preset",
+			zap.Error(err))
+		writePTZError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *HttpSidecar) handlePtzPatrols(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		patrols, err := s.commandService.PTZPatrols(r.Context(), camera, r.URL.Query().Get("channel"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		resp, err := json.Marshal(patrols)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().
+			Add("Content-Type", "application/json")
+		w.Write(resp)
+	case http.MethodPut, http.MethodPost:
+		var req service.PTZPatrolRequest
+		if err := json.
+			NewDecoder(r.Body).
+			Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := s.commandService.PTZSetPatrol(r.Context(), camera, &req); err != nil {
+			logger.SError("failed to save PTZ patrol",
+				zap.Error(err))
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		s.ptzPatrolCommand(w, r, camera, service.PTZPatrolActionDelete)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePtzPatrolCommand starts or stops the patrol, the action is the last path segment
+func (s *HttpSidecar) handlePtzPatrolCommand(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	s.ptzPatrolCommand(w, r, camera, path.Base(r.URL.Path))
+}
+
+func (s *HttpSidecar) ptzPatrolCommand(w http.ResponseWriter, r *http.Request, camera *db.Camera, action string) {
+	patrolId, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := s.commandService.PTZPatrolCommand(r.Context(), camera, &service.PTZPatrolRequest{
+		Action:    action,
+		ChannelId: r.URL.Query().Get("channel"),
+		PatrolId:  patrolId,
+	}); err != nil {
+		logger.SError("failed to execute PTZ patrol command",
+			zap.Error(err))
+		writePTZError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlePtzPattern records or plays back the pattern, the action is the last path segment
+func (s *HttpSidecar) handlePtzPattern(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	patternId, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := s.commandService.PTZPattern(r.Context(), camera, &service.PTZPatternRequest{
+		Action:    path.Base(r.URL.Path),
+		ChannelId: r.URL.Query().Get("channel"),
+		PatternId: patternId,
+	}); err != nil {
+		logger.SError("failed to execute PTZ pattern command",
+			zap.Error(err))
+		writePTZError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handlePtzLimits returns the limits of the camera, they are read only to the tracker
+// since they keep it away from positions
+func (s *HttpSidecar) handlePtzLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	limits, err := s.commandService.PTZLimits(r.Context(), camera, &service.PTZLimitsRequest{
+		ChannelId: r.URL.Query().Get("channel"),
+	})
+	if err != nil {
+		logger.SError("failed to retrieve PTZ limits",
+			zap.Error(err))
+		writeError(w, err)
+		return
+	}
+	resp, err := json.Marshal(limits)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().
+		Add("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// handlePtzHome saves the current position as home on /ptz/home
+// and moves back to it on /ptz/home/goto
+func (s *HttpSidecar) handlePtzHome(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	req := service.PTZHomeRequest{
+		Action:    service.PTZHomeActionSet,
+		ChannelId: r.URL.Query().Get("channel"),
+	}
+	if r.URL.Path == "/ptz/home/goto" {
+		req.Action = service.PTZHomeActionGoto
+	}
+	if err := s.commandService.PTZHome(r.Context(), camera, &req); err != nil {
+		logger.SError("failed to execute PTZ home position action",
+			zap.Error(err))
+		writePTZError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *HttpSidecar) handlePtzPark(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	req := service.PTZParkActionRequest{
+		ChannelId: r.URL.Query().Get("channel"),
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		if err := json.
+			NewDecoder(r.Body).
+			Decode(&req.Settings); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	parkAction, err := s.commandService.PTZParkAction(r.Context(), camera, &req)
+	if err != nil {
+		logger.SError("failed to handle PTZ park action",
+			zap.Error(err))
+		writeError(w, err)
+		return
+	}
+	resp, err := json.Marshal(parkAction)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().
+		Add("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (s *HttpSidecar) handlePtzTimeTasks(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	req := service.PTZTimeTaskRequest{
+		ChannelId: r.URL.Query().Get("channel"),
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		if err := json.
+			NewDecoder(r.Body).
+			Decode(&req.Settings); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	timeTasks, err := s.commandService.PTZTimeTasks(r.Context(), camera, &req)
+	if err != nil {
+		logger.SError("failed to handle PTZ time tasks",
+			zap.Error(err))
+		writeError(w, err)
+		return
+	}
+	resp, err := json.Marshal(timeTasks)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().
+		Add("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (s *HttpSidecar) handlePtzAbsolute(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	var req service.PTZAbsoluteRequest
+	if err := json.
+		NewDecoder(r.Body).
+		Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := s.commandService.PTZAbsolute(r.Context(), camera, &req); err != nil {
+		logger.SError("failed to send PTZ absolute command",
+			zap.Error(err))
+		writePTZError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *HttpSidecar) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	req := service.SnapshotRequest{
+		ChannelId: query.Get("channel"),
+	}
+	var err error
+	if width := query.Get("width"); width != "" {
+		req.Width, err = strconv.Atoi(width)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if height := query.Get("height"); height != "" {
+		req.Height, err = strconv.Atoi(height)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	jpegImg, err := s.commandService.Snapshot(r.Context(), camera, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().
+		Add("Content-Type", "image/jpeg")
+	w.Write(jpegImg)
+}
+
+func (s *HttpSidecar) handleChannels(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	channels, err := s.commandService.Channels(r.Context(), camera)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp, err := json.Marshal(channels)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().
+		Add("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (s *HttpSidecar) handleProbe(w http.ResponseWriter, r *http.Request) {
+	camera, ok := s.cameraFromQuery(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	req := service.ProbeRequest{
+		ChannelId: query.Get("channel"),
+	}
+	if stream := query.Get("stream"); stream != "" {
+		var err error
+		req.Stream, err = strconv.Atoi(stream)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	probe, err := s.commandService.Probe(r.Context(), camera, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp, err := json.Marshal(probe)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().
+		Add("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// handleStreams lists the FFmpeg progress of every stream, or of the named camera only
+func (s *HttpSidecar) handleStreams(w http.ResponseWriter, r *http.Request) {
+	stats := s.mediaController.StreamStats()
+	if cameraName := r.URL.Query().Get("name"); cameraName != "" {
+		camera, err := s.metadata.GetCameraByName(cameraName)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		filtered := []service.StreamStats{}
+		for _, stat := range stats {
+			if stat.CameraId == camera.CameraId {
+				filtered = append(filtered, stat)
+			}
+		}
+		stats = filtered
+	}
+	resp, err := json.Marshal(stats)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().
+		Add("Content-Type", "application/json")
+	w.Write(resp)
+}
@@ -0,0 +1,29 @@
+package sidecar
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	custerror "github.com/CE-Thesis-2023/ltd/src/internal/error"
+)
+
+func TestWriteError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{err: custerror.FormatInvalidArgument("preset id must be positive"), want: http.StatusBadRequest},
+		{err: custerror.FormatNotFound("no preset 3"), want: http.StatusNotFound},
+		{err: custerror.FormatTimeout("probing timed out"), want: http.StatusGatewayTimeout},
+		{err: errors.New("connection reset"), want: http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		writeError(w, c.err)
+		if w.Code != c.want {
+			t.Errorf("expected %d for %q, got %d", c.want, c.err, w.Code)
+		}
+	}
+}